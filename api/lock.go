@@ -0,0 +1,60 @@
+package api
+
+import (
+	"sync"
+
+	"github.com/danesparza/appupgrade/history"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	packageLocksMu sync.Mutex
+	packageLocks   = map[string]string{} // The status of each locked package
+)
+
+// lockPackage locks the package for a change (an update, install or remove), so only one change to a package
+// runs at a time.  It returns false if the package is already locked.  Call the returned func to unlock it
+func lockPackage(packageName string, status string) (func(), bool) {
+	packageLocksMu.Lock()
+	defer packageLocksMu.Unlock()
+
+	if _, locked := packageLocks[packageName]; locked {
+		return nil, false
+	}
+
+	packageLocks[packageName] = status
+
+	return func() {
+		packageLocksMu.Lock()
+		defer packageLocksMu.Unlock()
+		delete(packageLocks, packageName)
+	}, true
+}
+
+// setPackageStatus sets what the change to a locked package is doing right now
+func setPackageStatus(packageName string, status string) {
+	packageLocksMu.Lock()
+	defer packageLocksMu.Unlock()
+
+	if _, locked := packageLocks[packageName]; locked {
+		packageLocks[packageName] = status
+	}
+}
+
+// getPackageStatus gets what the change to a package is doing right now.  It's blank if nothing is changing the package
+func getPackageStatus(packageName string) string {
+	packageLocksMu.Lock()
+	defer packageLocksMu.Unlock()
+
+	return packageLocks[packageName]
+}
+
+// recordHistory records a package operation in the history.  A problem recording it is logged (but doesn't fail the operation)
+func recordHistory(entry history.Entry) {
+	if err := history.Record(entry); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"package":   entry.Package,
+			"operation": entry.Operation,
+		}).Error("problem recording the operation in the history")
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/danesparza/appupgrade/config"
+	"github.com/danesparza/appupgrade/history"
+	"github.com/danesparza/appupgrade/journal"
+	"github.com/danesparza/appupgrade/pkgmgr"
+	"github.com/danesparza/appupgrade/source"
+	log "github.com/sirupsen/logrus"
+)
+
+// RecoverInterruptedOperations finishes the package changes that were interrupted (by a power loss, or appupgrade being
+// killed).  Packages left half done are configured first.  Then an update or install that got its version installed is
+// completed, and one that didn't is rolled back.  A remove that didn't finish is run again.  Each recovery is recorded in
+// the history.  Call it on start, before any new changes are accepted
+func RecoverInterruptedOperations() {
+	operations, err := journal.GetUnfinished()
+	if err != nil {
+		log.WithError(err).Error("problem reading the in-flight operation records")
+		return
+	}
+
+	for _, operation := range operations {
+		log.WithFields(log.Fields{
+			"package":   operation.Package,
+			"operation": operation.Operation,
+			"version":   operation.Version,
+			"started":   operation.Started,
+		}).Warn("found a package change that was interrupted - recovering it")
+
+		message, success := recoverOperation(operation)
+
+		log.WithFields(log.Fields{
+			"package":   operation.Package,
+			"operation": operation.Operation,
+			"recovered": success,
+			"message":   message,
+		}).Info("recovered interrupted package change")
+
+		recordHistory(history.Entry{
+			Package:         operation.Package,
+			Operation:       history.OperationRecover,
+			Version:         operation.Version,
+			PreviousVersion: operation.PreviousVersion,
+			Success:         success,
+			Message:         message,
+		})
+
+		journal.Finish(operation.Package)
+	}
+}
+
+// recoverOperation recovers a single interrupted operation.  It returns what it did, and whether it worked
+func recoverOperation(operation journal.Operation) (string, bool) {
+	messages := []string{}
+
+	pkg, packageIsMonitored, err := config.GetPackage(operation.Package)
+	if err != nil || !packageIsMonitored {
+		pkg = config.Package{Name: operation.Package}
+	}
+
+	packageManager, err := pkgmgr.New(operation.PackageManager, pkg)
+	if err != nil {
+		return fmt.Sprintf("interrupted %s: problem with the package manager: %v", operation.Operation, err), false
+	}
+
+	//	Finish configuring anything the interruption left half done
+	if repairer, ok := packageManager.(pkgmgr.Repairer); ok {
+		if err := pkgmgr.WaitForLock(packageManager, nil); err != nil {
+			return fmt.Sprintf("interrupted %s: %v", operation.Operation, err), false
+		}
+
+		repaired, err := repairer.RepairPackages()
+		if err != nil {
+			return fmt.Sprintf("interrupted %s: %v", operation.Operation, err), false
+		}
+
+		if len(repaired) > 0 {
+			messages = append(messages, "configured "+strings.Join(repaired, ", "))
+		}
+	}
+
+	installedVersion, err := packageManager.GetCurrentVersionForPackage(operation.Package)
+	isInstalled := err == nil
+	if err != nil && !errors.Is(err, pkgmgr.ErrNotInstalled) {
+		return fmt.Sprintf("interrupted %s: problem getting the installed version: %v", operation.Operation, err), false
+	}
+
+	switch operation.Operation {
+	case history.OperationRemove, history.OperationPurge:
+		if !isInstalled && operation.Operation == history.OperationRemove {
+			messages = append(messages, "completed remove")
+			return recoveryMessage(operation, messages), true
+		}
+
+		//	Run the remove again (a purge is always run again, since the configuration might still be there)
+		purger, canPurge := packageManager.(pkgmgr.Purger)
+		if operation.Operation == history.OperationPurge && canPurge {
+			_, err = purger.PurgePackage(operation.Package)
+		} else {
+			_, err = packageManager.RemovePackage(operation.Package)
+		}
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("problem running the %s again: %v", operation.Operation, err))
+			return recoveryMessage(operation, messages), false
+		}
+
+		messages = append(messages, fmt.Sprintf("ran the %s again", operation.Operation))
+		return recoveryMessage(operation, messages), true
+	}
+
+	//	An update or install: if the new version got installed (and checks out), it's done
+	if isInstalled && pkgmgr.VerifyInstall(packageManager, operation.Package, operation.Version) == nil {
+		messages = append(messages, fmt.Sprintf("completed %s: version %s is installed", operation.Operation, installedVersion))
+		return recoveryMessage(operation, messages), true
+	}
+
+	//	Otherwise put back what was there before
+	if !packageIsMonitored {
+		messages = append(messages, "can't roll back: the package isn't monitored any more")
+		return recoveryMessage(operation, messages), false
+	}
+
+	releaseSource, err := source.ForPackage(pkg)
+	if err != nil {
+		messages = append(messages, fmt.Sprintf("can't roll back: problem with the release source: %v", err))
+		return recoveryMessage(operation, messages), false
+	}
+
+	conffilePolicy, _ := pkg.GetConffilePolicy()
+	request := pkgmgr.InstallRequest{
+		Package:        operation.Package,
+		Version:        operation.Version,
+		ConffilePolicy: conffilePolicy,
+		Preseed:        pkg.Preseed,
+	}
+
+	restored := restorePackage(packageManager, releaseSource, request, operation.WasInstalled, operation.PreviousVersion)
+	messages = append(messages, "rolled back: "+restored)
+
+	//	Check the roll back worked
+	installedVersion, err = packageManager.GetCurrentVersionForPackage(operation.Package)
+	if operation.WasInstalled {
+		return recoveryMessage(operation, messages), err == nil && pkgmgr.VersionMatches(installedVersion, operation.PreviousVersion)
+	}
+
+	return recoveryMessage(operation, messages), errors.Is(err, pkgmgr.ErrNotInstalled)
+}
+
+// recoveryMessage describes the recovery of an interrupted operation
+func recoveryMessage(operation journal.Operation, messages []string) string {
+	return fmt.Sprintf("interrupted %s: %s", operation.Operation, strings.Join(messages, "; "))
+}
@@ -0,0 +1,210 @@
+package api_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danesparza/appupgrade/api"
+	"github.com/danesparza/appupgrade/history"
+	"github.com/danesparza/appupgrade/journal"
+	"github.com/danesparza/appupgrade/pkgmgr"
+	"github.com/spf13/viper"
+)
+
+// setupTarballPackage configures daydash as a tarball package (under a temp directory) with the given
+// versions unpacked, and the installed version recorded in its state (if there is one).  It returns the
+// install directory and a cleanup func
+func setupTarballPackage(t *testing.T, installedVersion string, unpackedVersions ...string) (string, func()) {
+	dir, err := ioutil.TempDir("", "appupgrade-recover-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+
+	installDir := filepath.Join(dir, "opt", "daydash")
+	stateDir := filepath.Join(dir, "state")
+
+	viper.Set("state.path", stateDir)
+	viper.Set("packages", map[string]interface{}{
+		"daydash": map[string]interface{}{
+			"url":             "https://github.com/danesparza/daydash",
+			"package-manager": "tarball",
+			"install-dir":     installDir,
+		},
+	})
+
+	for _, version := range unpackedVersions {
+		releaseDir := filepath.Join(installDir, "releases", version)
+		os.MkdirAll(releaseDir, 0755)
+		ioutil.WriteFile(filepath.Join(releaseDir, "daydash"), []byte(version), 0755)
+	}
+
+	if installedVersion != "" {
+		releaseDir := filepath.Join(installDir, "releases", installedVersion)
+		os.Symlink(releaseDir, filepath.Join(installDir, "current"))
+
+		data, _ := json.Marshal(pkgmgr.TarballState{Version: installedVersion, Path: releaseDir})
+		os.MkdirAll(filepath.Join(stateDir, "tarball"), 0755)
+		ioutil.WriteFile(filepath.Join(stateDir, "tarball", "daydash.json"), data, 0644)
+	}
+
+	return installDir, func() {
+		viper.Set("state.path", "")
+		viper.Set("packages", nil)
+		os.RemoveAll(dir)
+	}
+}
+
+// recoveredEntry gets the history entry recorded for the recovery of daydash
+func recoveredEntry(t *testing.T) history.Entry {
+	entries, err := history.GetEntriesForPackage("daydash")
+	if err != nil {
+		t.Fatalf("GetEntriesForPackage - Should read the history without error, but got: %s", err)
+	}
+
+	for _, entry := range entries {
+		if entry.Operation == history.OperationRecover {
+			return entry
+		}
+	}
+
+	t.Fatalf("RecoverInterruptedOperations - Expected the recovery to be recorded in the history, but got: %+v", entries)
+	return history.Entry{}
+}
+
+func TestRecoverInterruptedOperations_UpdateInstalled_IsCompleted(t *testing.T) {
+
+	//	Arrange
+	installDir, cleanup := setupTarballPackage(t, "1.0.2", "1.0.1", "1.0.2")
+	defer cleanup()
+
+	journal.Begin(journal.Operation{Package: "daydash", Operation: history.OperationUpdate, Version: "1.0.2", PreviousVersion: "1.0.1", WasInstalled: true, PackageManager: "tarball"})
+
+	//	Act
+	api.RecoverInterruptedOperations()
+
+	//	Assert
+	entry := recoveredEntry(t)
+	if !entry.Success || !strings.Contains(entry.Message, "completed update") {
+		t.Errorf("RecoverInterruptedOperations - Expected the update to be completed, but got: %+v", entry)
+	}
+
+	if current, _ := os.Readlink(filepath.Join(installDir, "current")); current != filepath.Join(installDir, "releases", "1.0.2") {
+		t.Errorf("RecoverInterruptedOperations - Expected 1.0.2 to stay current, but got: %s", current)
+	}
+
+	if unfinished, _ := journal.GetUnfinished(); len(unfinished) != 0 {
+		t.Errorf("RecoverInterruptedOperations - Expected the in-flight record to be finished, but got: %+v", unfinished)
+	}
+}
+
+func TestRecoverInterruptedOperations_UpdateNotInstalled_RollsBack(t *testing.T) {
+
+	//	Arrange
+	//	A replace update that was interrupted after the old version was removed, but before the new one was installed
+	installDir, cleanup := setupTarballPackage(t, "", "1.0.1")
+	defer cleanup()
+
+	journal.Begin(journal.Operation{Package: "daydash", Operation: history.OperationUpdate, Version: "1.0.2", PreviousVersion: "1.0.1", WasInstalled: true, PackageManager: "tarball"})
+
+	//	Act
+	api.RecoverInterruptedOperations()
+
+	//	Assert
+	entry := recoveredEntry(t)
+	if !entry.Success || !strings.Contains(entry.Message, "rolled back: restored version 1.0.1") {
+		t.Errorf("RecoverInterruptedOperations - Expected the update to be rolled back, but got: %+v", entry)
+	}
+
+	if current, _ := os.Readlink(filepath.Join(installDir, "current")); current != filepath.Join(installDir, "releases", "1.0.1") {
+		t.Errorf("RecoverInterruptedOperations - Expected 1.0.1 to be current again, but got: %s", current)
+	}
+
+	if unfinished, _ := journal.GetUnfinished(); len(unfinished) != 0 {
+		t.Errorf("RecoverInterruptedOperations - Expected the in-flight record to be finished, but got: %+v", unfinished)
+	}
+}
+
+func TestRecoverInterruptedOperations_InstallNotInstalled_NothingToRestore(t *testing.T) {
+
+	//	Arrange
+	_, cleanup := setupTarballPackage(t, "")
+	defer cleanup()
+
+	journal.Begin(journal.Operation{Package: "daydash", Operation: history.OperationInstall, Version: "1.0.2", WasInstalled: false, PackageManager: "tarball"})
+
+	//	Act
+	api.RecoverInterruptedOperations()
+
+	//	Assert
+	entry := recoveredEntry(t)
+	if !entry.Success || !strings.Contains(entry.Message, "nothing to restore") {
+		t.Errorf("RecoverInterruptedOperations - Expected the install to be rolled back to not installed, but got: %+v", entry)
+	}
+}
+
+func TestRecoverInterruptedOperations_RemoveNotFinished_RunsAgain(t *testing.T) {
+
+	//	Arrange
+	installDir, cleanup := setupTarballPackage(t, "1.0.1", "1.0.1")
+	defer cleanup()
+
+	journal.Begin(journal.Operation{Package: "daydash", Operation: history.OperationRemove, PreviousVersion: "1.0.1", WasInstalled: true, PackageManager: "tarball"})
+
+	//	Act
+	api.RecoverInterruptedOperations()
+
+	//	Assert
+	entry := recoveredEntry(t)
+	if !entry.Success || !strings.Contains(entry.Message, "ran the remove again") {
+		t.Errorf("RecoverInterruptedOperations - Expected the remove to be run again, but got: %+v", entry)
+	}
+
+	if _, err := os.Lstat(filepath.Join(installDir, "current")); !os.IsNotExist(err) {
+		t.Errorf("RecoverInterruptedOperations - Expected the package to be removed, but the current symlink is still there")
+	}
+}
+
+func TestRecoverInterruptedOperations_RemoveFinished_IsCompleted(t *testing.T) {
+
+	//	Arrange
+	_, cleanup := setupTarballPackage(t, "", "1.0.1")
+	defer cleanup()
+
+	journal.Begin(journal.Operation{Package: "daydash", Operation: history.OperationRemove, PreviousVersion: "1.0.1", WasInstalled: true, PackageManager: "tarball"})
+
+	//	Act
+	api.RecoverInterruptedOperations()
+
+	//	Assert
+	entry := recoveredEntry(t)
+	if !entry.Success || !strings.Contains(entry.Message, "completed remove") {
+		t.Errorf("RecoverInterruptedOperations - Expected the remove to be completed, but got: %+v", entry)
+	}
+}
+
+func TestRecoverInterruptedOperations_PackageNotMonitored_CantRollBack(t *testing.T) {
+
+	//	Arrange
+	_, cleanup := setupTarballPackage(t, "", "1.0.1")
+	defer cleanup()
+	viper.Set("packages", map[string]interface{}{})
+
+	journal.Begin(journal.Operation{Package: "daydash", Operation: history.OperationUpdate, Version: "1.0.2", PreviousVersion: "1.0.1", WasInstalled: true, PackageManager: "tarball"})
+
+	//	Act
+	api.RecoverInterruptedOperations()
+
+	//	Assert
+	entry := recoveredEntry(t)
+	if entry.Success || !strings.Contains(entry.Message, "isn't monitored") {
+		t.Errorf("RecoverInterruptedOperations - Expected the roll back to fail for a package that isn't monitored, but got: %+v", entry)
+	}
+
+	if unfinished, _ := journal.GetUnfinished(); len(unfinished) != 0 {
+		t.Errorf("RecoverInterruptedOperations - Expected the in-flight record to be finished, but got: %+v", unfinished)
+	}
+}
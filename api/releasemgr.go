@@ -2,17 +2,22 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 
-	"github.com/alexfacciorusso/ghurlparse"
-	"github.com/danesparza/appupgrade/dpkg"
-	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/config"
+	"github.com/danesparza/appupgrade/history"
+	"github.com/danesparza/appupgrade/journal"
+	"github.com/danesparza/appupgrade/pkgmgr"
+	"github.com/danesparza/appupgrade/preflight"
+	"github.com/danesparza/appupgrade/source"
 	"github.com/gorilla/mux"
 	"github.com/hashicorp/go-version"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 )
 
 // VersionReport defines version information for a given package
@@ -22,7 +27,34 @@ type VersionReport struct {
 	LatestVersion     string            `json:"latestversion"`     // The latest available version of the package
 	UpdateDownloadUrl string            `json:"latestdownloadurl"` // The url to get the latest update
 	PreviousVersions  map[string]string `json:"previousversions"`  // Previous versions available
+	Installed         bool              `json:"installed"`         // 'true' if the package is installed
 	UpgradeAvailable  bool              `json:"upgradeavailable"`  // 'true' if there is an upgrade available
+	Source            string            `json:"source"`            // The source that answered the version request
+	Status            string            `json:"status,omitempty"`  // What the change to the package is doing (if one is running)
+}
+
+// UpdateResult describes the result of a package update
+type UpdateResult struct {
+	Name            string                  `json:"name"`                // The package name
+	Version         string                  `json:"version"`             // The version that was installed
+	PreviousVersion string                  `json:"previousversion"`     // The version that was installed before
+	Message         string                  `json:"message"`             // What happened
+	Conffiles       []pkgmgr.ConffileChange `json:"conffiles,omitempty"` // The configuration files the new version changed, and whether they were kept or replaced
+}
+
+// DryRunReport describes what a package change would do, without doing it
+type DryRunReport struct {
+	Name              string            `json:"name"`                  // The package name
+	Operation         string            `json:"operation"`             // The change: update, install, remove or purge
+	Version           string            `json:"version,omitempty"`     // The version that would be installed
+	PreviousVersion   string            `json:"previousversion"`       // The version that is installed now
+	Strategy          string            `json:"strategy,omitempty"`    // The upgrade strategy that would be used
+	DownloadUrl       string            `json:"downloadurl,omitempty"` // Where the release was downloaded (and verified) from
+	Simulated         bool              `json:"simulated"`             // 'true' if the package manager simulated the change.  Otherwise the changes are just the requested version change
+	WouldSucceed      bool              `json:"wouldsucceed"`          // 'true' if nothing found a problem with the change
+	Problem           string            `json:"problem,omitempty"`     // What would go wrong (if something would)
+	Preflight         *preflight.Report `json:"preflight,omitempty"`   // The preflight checks
+	pkgmgr.Simulation                   // What the package manager would do
 }
 
 // GetVersionInfoForPackage godoc
@@ -49,9 +81,11 @@ func (service Service) GetVersionInfoForPackage(rw http.ResponseWriter, req *htt
 	packageName := vars["package"]
 	if strings.TrimSpace(packageName) == "" {
 		sendErrorResponse(rw, fmt.Errorf("package is a required parameter and should not be blank"), http.StatusBadRequest)
+		return
 	}
 
 	retval.Name = packageName
+	retval.Status = getPackageStatus(packageName)
 
 	//	Log our request
 	log.WithFields(log.Fields{
@@ -59,86 +93,111 @@ func (service Service) GetVersionInfoForPackage(rw http.ResponseWriter, req *htt
 		"package": packageName,
 	}).Debug("version info request")
 
-	//	Get the list of packages (and their github urls)
-	monitorPackages := viper.GetStringMap("packages")
+	//	Get the configuration for the package
+	pkg, packageIsMonitored, err := config.GetPackage(packageName)
+	if err != nil {
+		log.WithError(err).Error("problem reading the package configuration")
+		sendErrorResponse(rw, fmt.Errorf("problem reading the package configuration"), http.StatusInternalServerError)
+		return
+	}
 
-	if packageRepo, packageIsMonitored := monitorPackages[packageName]; packageIsMonitored {
-		//	Get currently installed package version
-		currentVersion, err := dpkg.GetCurrentVersionForPackage(packageName)
+	if packageIsMonitored {
+		//	Get the package manager for the package
+		packageManager, err := pkgmgr.ForPackage(pkg)
 		if err != nil {
-			if err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"package": packageName,
-				}).Error("problem getting current version for package")
-				sendErrorResponse(rw, fmt.Errorf("problem getting current version for package: %s", packageName), http.StatusInternalServerError)
-				return
-			}
+			log.WithError(err).WithFields(log.Fields{
+				"package": packageName,
+			}).Error("problem with the package manager configured for package")
+			sendErrorResponse(rw, fmt.Errorf("problem with the package manager configured for package %s: %v", packageName, err), http.StatusInternalServerError)
+			return
+		}
+
+		//	Get currently installed package version (if it's installed)
+		currentVersion, err := packageManager.GetCurrentVersionForPackage(packageName)
+		if err != nil && !errors.Is(err, pkgmgr.ErrNotInstalled) {
+			log.WithError(err).WithFields(log.Fields{
+				"package": packageName,
+			}).Error("problem getting current version for package")
+			sendErrorResponse(rw, fmt.Errorf("problem getting current version for package: %s", packageName), http.StatusInternalServerError)
+			return
 		}
 
+		retval.Installed = err == nil
 		retval.InstalledVersion = currentVersion
 
-		//	... parse the repo information
-		valid, user, repo := ghurlparse.DestructureRepoURL(fmt.Sprintf("%s", packageRepo))
-		if valid {
-			releases, err := github.GetVersionsForRepo(user, repo)
+		//	Get the releases from the package's release source
+		releaseSource, err := source.ForPackage(pkg)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"package": packageName,
+			}).Error("problem with the release source configured for package")
+			sendErrorResponse(rw, fmt.Errorf("problem with the release source configured for package %s: %v", packageName, err), http.StatusInternalServerError)
+			return
+		}
 
-			if err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"user": user,
-					"repo": repo,
-				}).Error("problem getting versions for repo")
-				sendErrorResponse(rw, fmt.Errorf("problem getting versions for repo: %s/%s", user, repo), http.StatusFailedDependency)
-				return
-			}
+		releases, err := releaseSource.ListReleases()
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"package": packageName,
+				"source":  releaseSource.Name(),
+			}).Error("problem getting versions for package")
+			sendErrorResponse(rw, fmt.Errorf("problem getting versions for package: %s", packageName), http.StatusFailedDependency)
+			return
+		}
 
-			//	If we seem to have a list of releases, print the latest release information
-			if len(releases) > 0 {
-				retval.LatestVersion = releases[0].Version
-				retval.UpdateDownloadUrl = releases[0].DownloadUrl
+		retval.Source = releaseSource.Name()
 
-				log.WithFields(log.Fields{
-					"package":    packageName,
-					"version":    releases[0].Version,
-					"releaseUrl": releases[0].DownloadUrl,
-				}).Debug("Found latest release for package.")
+		//	If we seem to have a list of releases, print the latest release information
+		if len(releases) > 0 {
+			retval.LatestVersion = releases[0].Version
+			retval.UpdateDownloadUrl = releases[0].DownloadUrl
 
-				//	Set previous versions as well
-				for _, v := range releases {
-					retval.PreviousVersions[v.Version] = v.DownloadUrl
-				}
-			}
+			log.WithFields(log.Fields{
+				"package":    packageName,
+				"source":     retval.Source,
+				"version":    releases[0].Version,
+				"releaseUrl": releases[0].DownloadUrl,
+			}).Debug("Found latest release for package.")
 
-			//	See if the latest version is greater than the installed version.  If so, an update is available
-			verInstalled, err := version.NewVersion(retval.InstalledVersion)
-			if err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"user":           user,
-					"repo":           repo,
-					"package":        packageName,
-					"currentversion": retval.InstalledVersion,
-					"latestversion":  retval.LatestVersion,
-				}).Error("failed to parse current version")
-				sendErrorResponse(rw, fmt.Errorf("failed to parse current version: %s", retval.InstalledVersion), http.StatusInternalServerError)
-				return
+			//	Set previous versions as well
+			for _, v := range releases {
+				retval.PreviousVersions[v.Version] = v.DownloadUrl
 			}
+		}
 
-			verLatest, err := version.NewVersion(retval.LatestVersion)
-			if err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"user":           user,
-					"repo":           repo,
-					"package":        packageName,
-					"currentversion": retval.InstalledVersion,
-					"latestversion":  retval.LatestVersion,
-				}).Error("failed to parse latest version")
-				sendErrorResponse(rw, fmt.Errorf("failed to parse latest version: %s", retval.LatestVersion), http.StatusInternalServerError)
-				return
-			}
+		//	See if the latest version is greater than the installed version.  If so, an update is available
+		//	(a package that isn't installed can't be upgraded -- it has to be installed)
+		if !retval.Installed || len(releases) == 0 {
+			sendVersionReport(rw, retval)
+			return
+		}
 
-			if verLatest.GreaterThan(verInstalled) {
-				retval.UpgradeAvailable = true
-			}
+		verInstalled, err := version.NewVersion(retval.InstalledVersion)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"source":         retval.Source,
+				"package":        packageName,
+				"currentversion": retval.InstalledVersion,
+				"latestversion":  retval.LatestVersion,
+			}).Error("failed to parse current version")
+			sendErrorResponse(rw, fmt.Errorf("failed to parse current version: %s", retval.InstalledVersion), http.StatusInternalServerError)
+			return
+		}
+
+		verLatest, err := version.NewVersion(retval.LatestVersion)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"source":         retval.Source,
+				"package":        packageName,
+				"currentversion": retval.InstalledVersion,
+				"latestversion":  retval.LatestVersion,
+			}).Error("failed to parse latest version")
+			sendErrorResponse(rw, fmt.Errorf("failed to parse latest version: %s", retval.LatestVersion), http.StatusInternalServerError)
+			return
+		}
 
+		if verLatest.GreaterThan(verInstalled) {
+			retval.UpgradeAvailable = true
 		}
 	} else {
 		//	We're not monitoring the requested package:  Return an error
@@ -146,10 +205,15 @@ func (service Service) GetVersionInfoForPackage(rw http.ResponseWriter, req *htt
 		return
 	}
 
+	sendVersionReport(rw, retval)
+}
+
+// sendVersionReport sends back version information
+func sendVersionReport(rw http.ResponseWriter, report VersionReport) {
 	//	Our return value
 	response := SystemResponse{
 		Message: "Version data fetched",
-		Data:    retval,
+		Data:    report,
 	}
 
 	//	Serialize to JSON & return the response:
@@ -165,13 +229,44 @@ func (service Service) GetVersionInfoForPackage(rw http.ResponseWriter, req *htt
 // @Produce  json
 // @Param package path string true "The package to update"
 // @Param version path string true "The version to update to"
+// @Param dryrun query bool false "Report what would happen, without changing anything"
 // @Success 200 {object} api.SystemResponse
 // @Failure 404 {object} api.ErrorResponse
+// @Failure 409 {object} api.ErrorResponse
+// @Failure 423 {object} api.ErrorResponse
 // @Failure 424 {object} api.ErrorResponse
 // @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
 // @Router /package/{package}/updatetoversion/{version} [post]
 func (service Service) UpdatePackageToVersion(rw http.ResponseWriter, req *http.Request) {
-	retval := ""
+	service.installPackageVersion(rw, req, false)
+}
+
+// InstallPackageVersion godoc
+// @Summary installs the specified version of a package that isn't installed yet
+// @Description installs the specified version of a package that isn't installed yet
+// @Tags package
+// @Accept  json
+// @Produce  json
+// @Param package path string true "The package to install"
+// @Param version path string true "The version to install"
+// @Param dryrun query bool false "Report what would happen, without changing anything"
+// @Success 200 {object} api.SystemResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 409 {object} api.ErrorResponse
+// @Failure 423 {object} api.ErrorResponse
+// @Failure 424 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Router /package/{package}/install/{version} [post]
+func (service Service) InstallPackageVersion(rw http.ResponseWriter, req *http.Request) {
+	service.installPackageVersion(rw, req, true)
+}
+
+// installPackageVersion installs the requested version of a package.  A fresh install is only
+// allowed if the package isn't installed, and an update is only allowed if it is
+func (service Service) installPackageVersion(rw http.ResponseWriter, req *http.Request, freshInstall bool) {
+	retval := UpdateResult{}
 
 	//	Parse the request
 	vars := mux.Vars(req)
@@ -180,16 +275,24 @@ func (service Service) UpdatePackageToVersion(rw http.ResponseWriter, req *http.
 	packageName := vars["package"]
 	if strings.TrimSpace(packageName) == "" {
 		sendErrorResponse(rw, fmt.Errorf("package is a required parameter and should not be blank"), http.StatusBadRequest)
+		return
 	}
 
 	reqVersion := vars["version"]
 	if strings.TrimSpace(reqVersion) == "" {
 		sendErrorResponse(rw, fmt.Errorf("version is a required parameter and should not be blank"), http.StatusBadRequest)
+		return
 	}
 
-	versionRequested, err := version.NewVersion(reqVersion)
-	if err != nil {
+	if _, err := version.NewVersion(reqVersion); err != nil {
 		sendErrorResponse(rw, fmt.Errorf("version is a required parameter and should be in a format similar to v1.23"), http.StatusBadRequest)
+		return
+	}
+
+	dryRun, err := getBoolQueryParam(req, "dryrun")
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
 	}
 
 	//	Log our request
@@ -197,23 +300,64 @@ func (service Service) UpdatePackageToVersion(rw http.ResponseWriter, req *http.
 		"route":   req.URL.RequestURI(),
 		"package": packageName,
 		"version": reqVersion,
+		"install": freshInstall,
+		"dryrun":  dryRun,
 	}).Debug("package update request")
 
-	//	Get the list of packages (and their github urls)
-	monitorPackages := viper.GetStringMap("packages")
+	//	Get the configuration for the package
+	pkg, packageIsMonitored, err := config.GetPackage(packageName)
+	if err != nil {
+		log.WithError(err).Error("problem reading the package configuration")
+		sendErrorResponse(rw, fmt.Errorf("problem reading the package configuration"), http.StatusInternalServerError)
+		return
+	}
 
 	//	Make sure the requested package is being monitored ...
-	if packageRepo, packageIsMonitored := monitorPackages[packageName]; packageIsMonitored {
-		//	Get currently installed package version
-		currentVersion, err := dpkg.GetCurrentVersionForPackage(packageName)
-		if err != nil {
-			if err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"package": packageName,
-				}).Error("problem getting current version for package")
-				sendErrorResponse(rw, fmt.Errorf("problem getting current version for package: %s", packageName), http.StatusInternalServerError)
+	if packageIsMonitored {
+		//	Only one change to a package at a time (a dry run doesn't change anything)
+		operation := history.OperationUpdate
+		if freshInstall {
+			operation = history.OperationInstall
+		}
+
+		if !dryRun {
+			unlock, locked := lockPackage(packageName, fmt.Sprintf("starting %s to %s", operation, reqVersion))
+			if !locked {
+				sendErrorResponse(rw, fmt.Errorf("package %s is already being changed (%s)", packageName, getPackageStatus(packageName)), http.StatusLocked)
 				return
 			}
+			defer unlock()
+		}
+
+		//	Get the package manager for the package
+		packageManager, err := pkgmgr.ForPackage(pkg)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"package": packageName,
+			}).Error("problem with the package manager configured for package")
+			sendErrorResponse(rw, fmt.Errorf("problem with the package manager configured for package %s: %v", packageName, err), http.StatusInternalServerError)
+			return
+		}
+
+		//	Get currently installed package version (if it's installed)
+		currentVersion, err := packageManager.GetCurrentVersionForPackage(packageName)
+		if err != nil && !errors.Is(err, pkgmgr.ErrNotInstalled) {
+			log.WithError(err).WithFields(log.Fields{
+				"package": packageName,
+			}).Error("problem getting current version for package")
+			sendErrorResponse(rw, fmt.Errorf("problem getting current version for package: %s", packageName), http.StatusInternalServerError)
+			return
+		}
+
+		installed := err == nil
+		if freshInstall && installed {
+			sendErrorResponse(rw, fmt.Errorf("package %s is already installed (version %s) - use updatetoversion to change versions", packageName, currentVersion), http.StatusConflict)
+			return
+		}
+
+		if !freshInstall && !installed {
+			sendErrorResponse(rw, fmt.Errorf("package %s is not installed - use install to install it", packageName), http.StatusConflict)
+			return
 		}
 
 		log.WithFields(log.Fields{
@@ -221,83 +365,260 @@ func (service Service) UpdatePackageToVersion(rw http.ResponseWriter, req *http.
 			"currentVersion": currentVersion,
 		}).Debug("Found current version")
 
-		//	... parse the repo information
-		valid, user, repo := ghurlparse.DestructureRepoURL(fmt.Sprintf("%s", packageRepo))
-		if valid {
-			releases, err := github.GetVersionsForRepo(user, repo)
+		//	Get the upgrade strategy and conffile policy for the package
+		strategy, err := pkg.GetStrategy()
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"package": packageName,
+			}).Error("problem with the strategy configured for package")
+			sendErrorResponse(rw, err, http.StatusInternalServerError)
+			return
+		}
+
+		conffilePolicy, err := pkg.GetConffilePolicy()
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"package": packageName,
+			}).Error("problem with the conffiles policy configured for package")
+			sendErrorResponse(rw, err, http.StatusInternalServerError)
+			return
+		}
 
+		//	Find the requested version
+		releaseSource, err := source.ForPackage(pkg)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"package": packageName,
+			}).Error("problem with the release source configured for package")
+			sendErrorResponse(rw, fmt.Errorf("problem with the release source configured for package %s: %v", packageName, err), http.StatusInternalServerError)
+			return
+		}
+
+		release, err := releaseSource.ResolveVersion(reqVersion)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"package": packageName,
+				"source":  releaseSource.Name(),
+				"version": reqVersion,
+			}).Error("problem finding the requested version")
+
+			if err == source.ErrVersionNotFound {
+				sendErrorResponse(rw, fmt.Errorf("version %s not found for package: %s", reqVersion, packageName), http.StatusNotFound)
+				return
+			}
+
+			sendErrorResponse(rw, fmt.Errorf("problem getting versions for package: %s", packageName), http.StatusFailedDependency)
+			return
+		}
+
+		log.WithFields(log.Fields{
+			"package":     packageName,
+			"source":      releaseSource.Name(),
+			"version":     release.Version,
+			"downloadurl": release.DownloadUrl,
+		}).Debug("found requested version information")
+
+		//	Wait for anything else that's changing packages (apt or unattended-upgrades, for example) to finish
+		if !dryRun {
+			err = pkgmgr.WaitForLock(packageManager, func() {
+				setPackageStatus(packageName, "waiting for another process to finish changing packages")
+			})
 			if err != nil {
 				log.WithError(err).WithFields(log.Fields{
-					"user":    user,
-					"repo":    repo,
 					"package": packageName,
-				}).Error("problem getting versions for repo")
-				sendErrorResponse(rw, fmt.Errorf("problem getting versions for repo: %s/%s", user, repo), http.StatusFailedDependency)
+				}).Error("problem waiting for the package manager")
+				sendBusyOrErrorResponse(rw, err)
 				return
 			}
+		}
 
-			//	Look for the requested version in the list of versions
-			for _, release := range releases {
-				versionFound, err := version.NewVersion(release.Version)
-				if err != nil {
-					log.WithError(err).WithFields(log.Fields{
-						"user":           user,
-						"repo":           repo,
-						"package":        packageName,
-						"releaseVersion": release.Version,
-					}).Warn("problem parsing a found release version - skipping to next version")
-					continue
-				}
+		//	Make sure the system is fit to be changed before starting
+		preflightReport := preflight.CheckSystem(packageManager)
+		preflightReport.Add(preflight.ReleaseFound(release))
+		if !preflightReport.Passed && !dryRun {
+			log.WithFields(log.Fields{
+				"package":  packageName,
+				"failures": preflightReport.Failures(),
+			}).Error("preflight checks failed")
+			sendErrorResponse(rw, fmt.Errorf("preflight checks failed: %s", preflightReport.Failures()), http.StatusConflict)
+			return
+		}
+
+		//	Download the file (container images are pulled by the package manager instead)
+		setPackageStatus(packageName, fmt.Sprintf("downloading %s", release.DownloadUrl))
+		packageFile := ""
+		if packageManager.PackageFormat() != pkgmgr.FormatImage {
+			packageFile, err = source.DownloadAsset(releaseSource, release)
+		}
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"package":        packageName,
+				"source":         releaseSource.Name(),
+				"releaseVersion": release.Version,
+				"downloadurl":    release.DownloadUrl,
+			}).Error("problem downloading the package file for release")
+			sendErrorResponse(rw, fmt.Errorf("problem downloading the package file for release: %s", release.DownloadUrl), http.StatusFailedDependency)
+			return
+		}
+
+		log.WithFields(log.Fields{
+			"package":     packageName,
+			"source":      releaseSource.Name(),
+			"version":     release.Version,
+			"packageFile": packageFile,
+		}).Debug("downloaded requested version")
+
+		//	For a dry run, stop here and report what the package manager would do
+		if dryRun {
+			if packageFile != "" {
+				defer os.Remove(packageFile)
+			}
+
+			report := DryRunReport{
+				Name:            packageName,
+				Operation:       operation,
+				Version:         release.Version,
+				PreviousVersion: currentVersion,
+				Strategy:        strategy,
+				DownloadUrl:     release.DownloadUrl,
+				Preflight:       &preflightReport,
+			}
+
+			request := pkgmgr.InstallRequest{
+				Package:        packageName,
+				Version:        release.Version,
+				Path:           packageFile,
+				ConffilePolicy: conffilePolicy,
+				Preseed:        pkg.Preseed,
+			}
+
+			change := pkgmgr.PackageChange{Package: packageName, Action: pkgmgr.ChangeInstall, Version: release.Version}
+			if installed {
+				change.Action = pkgmgr.ChangeUpdate
+				change.PreviousVersion = currentVersion
+			}
+
+			simulateChange(&report, packageManager, change, func(simulator pkgmgr.Simulator) (pkgmgr.Simulation, error) {
+				return simulator.SimulateInstall(request)
+			})
+			checkPreflight(&report)
 
-				//	If we found the version...
-				if versionRequested.Equal(versionFound) {
-					log.WithFields(log.Fields{
-						"user":        user,
-						"repo":        repo,
-						"package":     packageName,
-						"version":     release.Version,
-						"downloadurl": release.DownloadUrl,
-					}).Debug("found requested version information")
-
-					//	Download the file
-					packageFile, err := github.DownloadFile(release.DownloadUrl)
-					if err != nil {
-						log.WithError(err).WithFields(log.Fields{
-							"user":           user,
-							"repo":           repo,
-							"package":        packageName,
-							"releaseVersion": release.Version,
-							"downloadurl":    release.DownloadUrl,
-						}).Error("problem downloading the package file for release")
-						sendErrorResponse(rw, fmt.Errorf("problem downloading the package file for release: %s", release.DownloadUrl), http.StatusInternalServerError)
-						return
-					}
-
-					//	Remove the previous package
-					_, err = dpkg.RemovePackage(packageName)
-					if err != nil {
-						log.WithError(err).WithFields(log.Fields{
-							"package": packageName,
-						}).Error("problem removing the old package")
-						sendErrorResponse(rw, fmt.Errorf("problem removing the package: %s", packageName), http.StatusInternalServerError)
-						return
-					}
-
-					//	Install the new package
-					_, err = dpkg.InstallPackage(packageFile)
-					if err != nil {
-						log.WithError(err).WithFields(log.Fields{
-							"package":     packageName,
-							"packageFile": packageFile,
-						}).Error("problem installing the package")
-						sendErrorResponse(rw, fmt.Errorf("problem installing the package: %s", packageFile), http.StatusInternalServerError)
-						return
-					}
-
-					retval = fmt.Sprintf("Installed %s version %s", packageName, reqVersion)
+			sendDryRunReport(rw, report)
+			return
+		}
+
+		//	Keep track of the configuration files, so we can report what happened to them
+		conffilesBefore := map[string]string{}
+		reporter, tracksConffiles := packageManager.(pkgmgr.ConffileReporter)
+		if tracksConffiles {
+			conffilesBefore, _ = reporter.GetConffiles(packageName)
+		}
+
+		setPackageStatus(packageName, fmt.Sprintf("installing version %s", release.Version))
+
+		//	Record the change before making it, so it can be recovered if appupgrade is interrupted
+		if err := journal.Begin(journal.Operation{
+			Package:         packageName,
+			Operation:       operation,
+			Version:         release.Version,
+			PreviousVersion: currentVersion,
+			WasInstalled:    installed,
+			PackageManager:  packageManager.Name(),
+		}); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"package": packageName,
+			}).Error("problem recording the in-flight operation")
+			sendErrorResponse(rw, fmt.Errorf("problem recording the in-flight operation: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer journal.Finish(packageName)
+
+		//	With the replace strategy, remove the previous package first.  Otherwise the new package is installed
+		//	over it, so the package manager does a real upgrade (and keeps conffiles).  Containers are always recreated
+		removedFirst := false
+		if installed && strategy == config.StrategyReplace && packageManager.PackageFormat() != pkgmgr.FormatImage {
+			_, err = packageManager.RemovePackage(packageName)
+			if err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"package": packageName,
+				}).Error("problem removing the old package")
+				recordHistory(history.Entry{Package: packageName, Operation: operation, Version: release.Version, PreviousVersion: currentVersion, Message: fmt.Sprintf("problem removing the old package: %v", err)})
+				if errors.Is(err, pkgmgr.ErrBusy) {
+					sendBusyOrErrorResponse(rw, err)
+					return
 				}
+				sendErrorResponse(rw, fmt.Errorf("problem removing the package: %s", packageName), http.StatusInternalServerError)
+				return
 			}
+			removedFirst = true
 		}
+
+		//	Install the new package
+		request := pkgmgr.InstallRequest{
+			Package:        packageName,
+			Version:        release.Version,
+			Path:           packageFile,
+			ConffilePolicy: conffilePolicy,
+			Preseed:        pkg.Preseed,
+		}
+
+		_, err = packageManager.InstallPackage(request)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"package":     packageName,
+				"packageFile": packageFile,
+			}).Error("problem installing the package")
+			recordHistory(history.Entry{Package: packageName, Operation: operation, Version: release.Version, PreviousVersion: currentVersion, Message: fmt.Sprintf("problem installing the package: %v", err)})
+			//	If another process got the lock first nothing was changed -- unless the old package was already removed
+			if errors.Is(err, pkgmgr.ErrBusy) && !removedFirst {
+				sendBusyOrErrorResponse(rw, err)
+				return
+			}
+
+			setPackageStatus(packageName, fmt.Sprintf("restoring version %s", currentVersion))
+			restored := restorePackage(packageManager, releaseSource, request, installed, currentVersion)
+			if errors.Is(err, pkgmgr.ErrBusy) {
+				sendErrorResponse(rw, fmt.Errorf("%v (%s)", err, restored), http.StatusServiceUnavailable)
+				return
+			}
+			sendErrorResponse(rw, fmt.Errorf("problem installing the package: %s (%s)", packageFile, restored), http.StatusInternalServerError)
+			return
+		}
+
+		//	Make sure the requested version is what actually got installed
+		setPackageStatus(packageName, fmt.Sprintf("verifying version %s", release.Version))
+		if err := pkgmgr.VerifyInstall(packageManager, packageName, release.Version); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"package": packageName,
+				"version": release.Version,
+			}).Error("problem verifying the installed package")
+			recordHistory(history.Entry{Package: packageName, Operation: operation, Version: release.Version, PreviousVersion: currentVersion, Message: err.Error()})
+
+			setPackageStatus(packageName, fmt.Sprintf("restoring version %s", currentVersion))
+			restored := restorePackage(packageManager, releaseSource, request, installed, currentVersion)
+			sendErrorResponse(rw, fmt.Errorf("%v (%s)", err, restored), http.StatusInternalServerError)
+			return
+		}
+
+		retval.Name = packageName
+		retval.Version = reqVersion
+		retval.PreviousVersion = currentVersion
+		retval.Message = fmt.Sprintf("Installed %s version %s", packageName, reqVersion)
+
+		if tracksConffiles {
+			conffilesAfter, err := reporter.GetConffiles(packageName)
+			if err == nil {
+				retval.Conffiles = pkgmgr.CompareConffiles(conffilesBefore, conffilesAfter)
+			}
+
+			log.WithFields(log.Fields{
+				"package":   packageName,
+				"policy":    conffilePolicy,
+				"conffiles": retval.Conffiles,
+			}).Debug("configuration file changes")
+		}
+
+		recordHistory(history.Entry{Package: packageName, Operation: operation, Version: release.Version, PreviousVersion: currentVersion, Success: true, Message: retval.Message, Conffiles: retval.Conffiles})
 	} else {
 		//	We're not monitoring the requested package:  Return an error
 		sendErrorResponse(rw, fmt.Errorf("not monitoring the package %s", packageName), http.StatusNotFound)
@@ -310,7 +631,426 @@ func (service Service) UpdatePackageToVersion(rw http.ResponseWriter, req *http.
 		Data:    retval,
 	}
 
+	if freshInstall {
+		response.Message = "Package installed"
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// GetPreflightForPackage godoc
+// @Summary runs the preflight checks for updating a package to the specified version
+// @Description checks that the system is fit to be changed (the dpkg lock is free, dpkg --audit is clean, no packages are half configured and there's enough disk space) and that the version can be found for this architecture
+// @Tags package
+// @Accept  json
+// @Produce  json
+// @Param package path string true "The package to check"
+// @Param version path string true "The version to check"
+// @Success 200 {object} api.SystemResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Router /package/{package}/preflight/{version} [get]
+func (service Service) GetPreflightForPackage(rw http.ResponseWriter, req *http.Request) {
+	//	Parse the request
+	vars := mux.Vars(req)
+
+	//	Get the package name:
+	packageName := vars["package"]
+	if strings.TrimSpace(packageName) == "" {
+		sendErrorResponse(rw, fmt.Errorf("package is a required parameter and should not be blank"), http.StatusBadRequest)
+		return
+	}
+
+	reqVersion := vars["version"]
+	if _, err := version.NewVersion(reqVersion); err != nil {
+		sendErrorResponse(rw, fmt.Errorf("version is a required parameter and should be in a format similar to v1.23"), http.StatusBadRequest)
+		return
+	}
+
+	//	Log our request
+	log.WithFields(log.Fields{
+		"route":   req.URL.RequestURI(),
+		"package": packageName,
+		"version": reqVersion,
+	}).Debug("preflight request")
+
+	//	Get the configuration for the package
+	pkg, packageIsMonitored, err := config.GetPackage(packageName)
+	if err != nil {
+		log.WithError(err).Error("problem reading the package configuration")
+		sendErrorResponse(rw, fmt.Errorf("problem reading the package configuration"), http.StatusInternalServerError)
+		return
+	}
+
+	if !packageIsMonitored {
+		//	We're not monitoring the requested package:  Return an error
+		sendErrorResponse(rw, fmt.Errorf("not monitoring the package %s", packageName), http.StatusNotFound)
+		return
+	}
+
+	packageManager, err := pkgmgr.ForPackage(pkg)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"package": packageName,
+		}).Error("problem with the package manager configured for package")
+		sendErrorResponse(rw, fmt.Errorf("problem with the package manager configured for package %s: %v", packageName, err), http.StatusInternalServerError)
+		return
+	}
+
+	releaseSource, err := source.ForPackage(pkg)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"package": packageName,
+		}).Error("problem with the release source configured for package")
+		sendErrorResponse(rw, fmt.Errorf("problem with the release source configured for package %s: %v", packageName, err), http.StatusInternalServerError)
+		return
+	}
+
+	report, _ := preflight.Run(packageManager, releaseSource, reqVersion)
+
+	//	Our return value
+	response := SystemResponse{
+		Message: "Preflight checks passed",
+		Data:    report,
+	}
+
+	if !report.Passed {
+		response.Message = "Preflight checks failed"
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// RemovePackage godoc
+// @Summary removes a package
+// @Description removes a package.  With purge, its configuration files are removed as well
+// @Tags package
+// @Accept  json
+// @Produce  json
+// @Param package path string true "The package to remove"
+// @Param purge query bool false "Also remove the package's configuration"
+// @Param dryrun query bool false "Report what would happen, without changing anything"
+// @Success 200 {object} api.SystemResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 409 {object} api.ErrorResponse
+// @Failure 423 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Router /package/{package} [delete]
+func (service Service) RemovePackage(rw http.ResponseWriter, req *http.Request) {
+	retval := UpdateResult{}
+
+	//	Parse the request
+	vars := mux.Vars(req)
+
+	//	Get the package name:
+	packageName := vars["package"]
+	if strings.TrimSpace(packageName) == "" {
+		sendErrorResponse(rw, fmt.Errorf("package is a required parameter and should not be blank"), http.StatusBadRequest)
+		return
+	}
+
+	purge, err := getBoolQueryParam(req, "purge")
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	dryRun, err := getBoolQueryParam(req, "dryrun")
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Log our request
+	log.WithFields(log.Fields{
+		"route":   req.URL.RequestURI(),
+		"package": packageName,
+		"purge":   purge,
+		"dryrun":  dryRun,
+	}).Debug("package remove request")
+
+	//	Get the configuration for the package
+	pkg, packageIsMonitored, err := config.GetPackage(packageName)
+	if err != nil {
+		log.WithError(err).Error("problem reading the package configuration")
+		sendErrorResponse(rw, fmt.Errorf("problem reading the package configuration"), http.StatusInternalServerError)
+		return
+	}
+
+	if !packageIsMonitored {
+		//	We're not monitoring the requested package:  Return an error
+		sendErrorResponse(rw, fmt.Errorf("not monitoring the package %s", packageName), http.StatusNotFound)
+		return
+	}
+
+	operation := history.OperationRemove
+	if purge {
+		operation = history.OperationPurge
+	}
+
+	//	Only one change to a package at a time (a dry run doesn't change anything)
+	if !dryRun {
+		unlock, locked := lockPackage(packageName, fmt.Sprintf("starting %s", operation))
+		if !locked {
+			sendErrorResponse(rw, fmt.Errorf("package %s is already being changed (%s)", packageName, getPackageStatus(packageName)), http.StatusLocked)
+			return
+		}
+		defer unlock()
+	}
+
+	//	Get the package manager for the package
+	packageManager, err := pkgmgr.ForPackage(pkg)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"package": packageName,
+		}).Error("problem with the package manager configured for package")
+		sendErrorResponse(rw, fmt.Errorf("problem with the package manager configured for package %s: %v", packageName, err), http.StatusInternalServerError)
+		return
+	}
+
+	purger, canPurge := packageManager.(pkgmgr.Purger)
+	if purge && !canPurge {
+		sendErrorResponse(rw, fmt.Errorf("the %s package manager can't purge packages", packageManager.Name()), http.StatusBadRequest)
+		return
+	}
+
+	//	Get currently installed package version (if it's installed)
+	currentVersion, err := packageManager.GetCurrentVersionForPackage(packageName)
+	if err != nil && !errors.Is(err, pkgmgr.ErrNotInstalled) {
+		log.WithError(err).WithFields(log.Fields{
+			"package": packageName,
+		}).Error("problem getting current version for package")
+		sendErrorResponse(rw, fmt.Errorf("problem getting current version for package: %s", packageName), http.StatusInternalServerError)
+		return
+	}
+
+	//	A package that isn't installed can still be purged (its configuration files might have been left behind)
+	if err != nil && !purge {
+		sendErrorResponse(rw, fmt.Errorf("package %s is not installed", packageName), http.StatusConflict)
+		return
+	}
+
+	//	For a dry run, report what the package manager would do
+	if dryRun {
+		preflightReport := preflight.CheckSystem(packageManager)
+		report := DryRunReport{
+			Name:            packageName,
+			Operation:       operation,
+			PreviousVersion: currentVersion,
+			Preflight:       &preflightReport,
+		}
+
+		change := pkgmgr.PackageChange{Package: packageName, Action: pkgmgr.ChangeRemove, PreviousVersion: currentVersion}
+		if purge {
+			change.Action = pkgmgr.ChangePurge
+		}
+
+		simulateChange(&report, packageManager, change, func(simulator pkgmgr.Simulator) (pkgmgr.Simulation, error) {
+			return simulator.SimulateRemove(packageName, purge)
+		})
+		checkPreflight(&report)
+
+		sendDryRunReport(rw, report)
+		return
+	}
+
+	//	Wait for anything else that's changing packages to finish
+	err = pkgmgr.WaitForLock(packageManager, func() {
+		setPackageStatus(packageName, "waiting for another process to finish changing packages")
+	})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"package": packageName,
+		}).Error("problem waiting for the package manager")
+		sendBusyOrErrorResponse(rw, err)
+		return
+	}
+
+	//	Record the change before making it, so it can be recovered if appupgrade is interrupted
+	if err := journal.Begin(journal.Operation{
+		Package:         packageName,
+		Operation:       operation,
+		PreviousVersion: currentVersion,
+		WasInstalled:    currentVersion != "",
+		PackageManager:  packageManager.Name(),
+	}); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"package": packageName,
+		}).Error("problem recording the in-flight operation")
+		sendErrorResponse(rw, fmt.Errorf("problem recording the in-flight operation: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer journal.Finish(packageName)
+
+	//	Remove the package
+	setPackageStatus(packageName, fmt.Sprintf("running %s", operation))
+	if purge {
+		_, err = purger.PurgePackage(packageName)
+	} else {
+		_, err = packageManager.RemovePackage(packageName)
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"package": packageName,
+			"purge":   purge,
+		}).Error("problem removing the package")
+		recordHistory(history.Entry{Package: packageName, Operation: operation, PreviousVersion: currentVersion, Message: fmt.Sprintf("problem removing the package: %v", err)})
+		if errors.Is(err, pkgmgr.ErrBusy) {
+			sendBusyOrErrorResponse(rw, err)
+			return
+		}
+		sendErrorResponse(rw, fmt.Errorf("problem removing the package: %s", packageName), http.StatusInternalServerError)
+		return
+	}
+
+	retval.Name = packageName
+	retval.PreviousVersion = currentVersion
+	retval.Message = fmt.Sprintf("Removed %s", packageName)
+	if purge {
+		retval.Message = fmt.Sprintf("Purged %s", packageName)
+	}
+
+	recordHistory(history.Entry{Package: packageName, Operation: operation, PreviousVersion: currentVersion, Success: true, Message: retval.Message})
+
+	//	Our return value
+	response := SystemResponse{
+		Message: "Package removed",
+		Data:    retval,
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// simulateChange fills in the dry run report with what the package manager would do.  If the package
+// manager can't simulate changes, the report just has the requested change
+func simulateChange(report *DryRunReport, packageManager pkgmgr.PackageManager, change pkgmgr.PackageChange, simulate func(simulator pkgmgr.Simulator) (pkgmgr.Simulation, error)) {
+	report.WouldSucceed = true
+
+	simulator, canSimulate := packageManager.(pkgmgr.Simulator)
+	if !canSimulate {
+		report.Changes = []pkgmgr.PackageChange{change}
+		return
+	}
+
+	simulation, err := simulate(simulator)
+	report.Simulated = true
+	report.Simulation = simulation
+
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"package": report.Name,
+			"output":  simulation.Output,
+		}).Debug("package change simulation failed")
+
+		report.WouldSucceed = false
+		report.Problem = fmt.Sprintf("the %s simulation failed: %v", packageManager.Name(), err)
+	}
+}
+
+// checkPreflight marks the dry run report as failing if a blocking preflight check failed
+func checkPreflight(report *DryRunReport) {
+	if report.Preflight == nil || report.Preflight.Passed {
+		return
+	}
+
+	report.WouldSucceed = false
+	if report.Problem == "" {
+		report.Problem = "preflight checks failed: " + report.Preflight.Failures()
+	}
+}
+
+// sendDryRunReport sends back a dry run report
+func sendDryRunReport(rw http.ResponseWriter, report DryRunReport) {
+	//	Our return value
+	response := SystemResponse{
+		Message: "Dry run - nothing was changed",
+		Data:    report,
+	}
+
 	//	Serialize to JSON & return the response:
 	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(rw).Encode(response)
 }
+
+// GetHistoryForPackage godoc
+// @Summary gets the history of changes to the given package
+// @Description gets the updates, installs, removes, restores and recoveries of the given package (oldest first).  The history is kept after a package stops being monitored
+// @Tags package
+// @Accept  json
+// @Produce  json
+// @Param package path string true "The package to get the history of"
+// @Success 200 {object} api.SystemResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Router /package/{package}/history [get]
+func (service Service) GetHistoryForPackage(rw http.ResponseWriter, req *http.Request) {
+	//	Parse the request
+	vars := mux.Vars(req)
+
+	//	Get the package name:
+	packageName := vars["package"]
+	if strings.TrimSpace(packageName) == "" {
+		sendErrorResponse(rw, fmt.Errorf("package is a required parameter and should not be blank"), http.StatusBadRequest)
+		return
+	}
+
+	//	Log our request
+	log.WithFields(log.Fields{
+		"route":   req.URL.RequestURI(),
+		"package": packageName,
+	}).Debug("history request")
+
+	entries, err := history.GetEntriesForPackage(packageName)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"package": packageName,
+		}).Error("problem reading the history")
+		sendErrorResponse(rw, fmt.Errorf("problem reading the history for package %s", packageName), http.StatusInternalServerError)
+		return
+	}
+
+	//	Our return value
+	response := SystemResponse{
+		Message: fmt.Sprintf("%d history entries for %s", len(entries), packageName),
+		Data:    entries,
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// getBoolQueryParam gets an optional true/false query parameter.  It's false if it isn't set
+func getBoolQueryParam(req *http.Request, name string) (bool, error) {
+	value := req.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+
+	retval, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s should be true or false", name)
+	}
+
+	return retval, nil
+}
+
+// sendBusyOrErrorResponse sends back a package manager busy error (if another process held the package manager
+// lock for too long), or a generic error
+func sendBusyOrErrorResponse(rw http.ResponseWriter, err error) {
+	if errors.Is(err, pkgmgr.ErrBusy) {
+		sendErrorResponse(rw, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	sendErrorResponse(rw, fmt.Errorf("problem waiting for the package manager: %v", err), http.StatusInternalServerError)
+}
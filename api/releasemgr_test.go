@@ -0,0 +1,397 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/danesparza/appupgrade/api"
+	"github.com/danesparza/appupgrade/config"
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/history"
+	"github.com/danesparza/appupgrade/pkgmgr"
+	"github.com/danesparza/appupgrade/source"
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+)
+
+// fakePackageManager keeps the installed version in memory.  Installs can be made to fail, or to wait
+// until they're released (so a second request can be sent while one is running)
+type fakePackageManager struct {
+	sync.Mutex
+	installed  string
+	installErr error
+	removeErr  error
+	installs   []string // The contents of each package file installed
+	removes    []string // remove or purge, for each removal
+	started    chan bool
+	release    chan bool
+}
+
+func (f *fakePackageManager) Name() string                        { return "fake" }
+func (f *fakePackageManager) PackageFormat() string               { return "fake" }
+func (f *fakePackageManager) CanInstallFile(fileName string) bool { return true }
+
+func (f *fakePackageManager) GetCurrentVersionForPackage(packageName string) (string, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.installed == "" {
+		return "", pkgmgr.ErrNotInstalled
+	}
+	return f.installed, nil
+}
+
+func (f *fakePackageManager) InstallPackage(request pkgmgr.InstallRequest) (string, error) {
+	if f.started != nil {
+		f.started <- true
+		<-f.release
+	}
+
+	contents, _ := ioutil.ReadFile(request.Path)
+
+	f.Lock()
+	defer f.Unlock()
+
+	f.installs = append(f.installs, string(contents))
+	if f.installErr != nil {
+		return "", f.installErr
+	}
+
+	f.installed = request.Version
+	return "installed", nil
+}
+
+func (f *fakePackageManager) RemovePackage(packageName string) (string, error) {
+	return f.remove("remove")
+}
+
+func (f *fakePackageManager) PurgePackage(packageName string) (string, error) {
+	return f.remove("purge")
+}
+
+func (f *fakePackageManager) remove(action string) (string, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.removes = append(f.removes, action)
+	if f.removeErr != nil {
+		return "", f.removeErr
+	}
+
+	f.installed = ""
+	return "removed", nil
+}
+
+// fakeReleaseSource has versions 1.0.1 and 1.0.2 of daydash
+type fakeReleaseSource struct{}
+
+func (f fakeReleaseSource) Name() string {
+	return "fake://daydash"
+}
+
+func (f fakeReleaseSource) ListReleases() ([]github.Release, error) {
+	return []github.Release{
+		{Version: "1.0.2", Name: "daydash_1.0.2.fake", DownloadUrl: "fake://daydash/1.0.2"},
+		{Version: "1.0.1", Name: "daydash_1.0.1.fake", DownloadUrl: "fake://daydash/1.0.1"},
+	}, nil
+}
+
+func (f fakeReleaseSource) ResolveVersion(requestedVersion string) (github.Release, error) {
+	releases, _ := f.ListReleases()
+	for _, release := range releases {
+		if release.Version == requestedVersion {
+			return release, nil
+		}
+	}
+
+	return github.Release{}, source.ErrVersionNotFound
+}
+
+func (f fakeReleaseSource) OpenAsset(release github.Release) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("package " + release.Version)), nil
+}
+
+// setupFakePackage configures daydash with the fake package manager and release source, and
+// returns a router with the package routes
+func setupFakePackage(t *testing.T, fake *fakePackageManager) (*mux.Router, func()) {
+	dir, err := ioutil.TempDir("", "appupgrade-api-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+
+	pkgmgr.Register("fake", func(pkg config.Package) (pkgmgr.PackageManager, error) {
+		return fake, nil
+	})
+	source.Register("fake", func(pkg config.Package, src config.Source) (source.ReleaseSource, error) {
+		return fakeReleaseSource{}, nil
+	})
+
+	viper.Set("state.path", dir)
+	viper.Set("packages", map[string]interface{}{
+		"daydash": map[string]interface{}{
+			"url":             "fake://daydash",
+			"type":            "fake",
+			"package-manager": "fake",
+		},
+	})
+
+	service := api.Service{}
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/package/{package}/updatetoversion/{version}", service.UpdatePackageToVersion).Methods("POST")
+	router.HandleFunc("/v1/package/{package}/install/{version}", service.InstallPackageVersion).Methods("POST")
+	router.HandleFunc("/v1/package/{package}", service.RemovePackage).Methods("DELETE")
+
+	return router, func() {
+		viper.Set("state.path", "")
+		viper.Set("packages", nil)
+		os.RemoveAll(dir)
+	}
+}
+
+// sendRequest sends a request to the router and returns the response
+func sendRequest(router *mux.Router, method, url string) *httptest.ResponseRecorder {
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(method, url, nil))
+	return response
+}
+
+func TestInstallPackageVersion_NotInstalled_InstallsIt(t *testing.T) {
+
+	//	Arrange
+	fake := &fakePackageManager{}
+	router, cleanup := setupFakePackage(t, fake)
+	defer cleanup()
+
+	//	Act
+	response := sendRequest(router, "POST", "/v1/package/daydash/install/1.0.2")
+	again := sendRequest(router, "POST", "/v1/package/daydash/install/1.0.2")
+
+	//	Assert
+	if response.Code != http.StatusOK {
+		t.Fatalf("InstallPackageVersion - Expected 200 but got: %d %s", response.Code, response.Body.String())
+	}
+
+	if len(fake.installs) != 1 || fake.installs[0] != "package 1.0.2" || fake.installed != "1.0.2" {
+		t.Errorf("InstallPackageVersion - Expected the downloaded 1.0.2 package to be installed, but got: %v", fake.installs)
+	}
+
+	if again.Code != http.StatusConflict {
+		t.Errorf("InstallPackageVersion - Expected 409 for a package that's already installed, but got: %d %s", again.Code, again.Body.String())
+	}
+
+	entries, _ := history.GetEntriesForPackage("daydash")
+	if len(entries) != 1 || entries[0].Operation != history.OperationInstall || !entries[0].Success {
+		t.Errorf("InstallPackageVersion - Expected the install to be recorded in the history, but got: %+v", entries)
+	}
+}
+
+func TestUpdatePackageToVersion_DryRun_ChangesNothing(t *testing.T) {
+
+	//	Arrange
+	fake := &fakePackageManager{installed: "1.0.1"}
+	router, cleanup := setupFakePackage(t, fake)
+	defer cleanup()
+
+	//	Act
+	response := sendRequest(router, "POST", "/v1/package/daydash/updatetoversion/1.0.2?dryrun=true")
+
+	//	Assert
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), "Dry run") {
+		t.Fatalf("UpdatePackageToVersion - Expected a dry run report but got: %d %s", response.Code, response.Body.String())
+	}
+
+	if len(fake.installs) != 0 || fake.installed != "1.0.1" {
+		t.Errorf("UpdatePackageToVersion - Expected a dry run not to install anything, but got: %v", fake.installs)
+	}
+
+	if entries, _ := history.GetEntriesForPackage("daydash"); len(entries) != 0 {
+		t.Errorf("UpdatePackageToVersion - Expected a dry run not to be recorded in the history, but got: %+v", entries)
+	}
+}
+
+func TestUpdatePackageToVersion_PackageManagerBusy_Returns503(t *testing.T) {
+
+	//	Arrange
+	fake := &fakePackageManager{installed: "1.0.1", installErr: fmt.Errorf("%w: held by unattended-upgr", pkgmgr.ErrBusy)}
+	router, cleanup := setupFakePackage(t, fake)
+	defer cleanup()
+
+	//	Act
+	response := sendRequest(router, "POST", "/v1/package/daydash/updatetoversion/1.0.2")
+
+	//	Assert
+	if response.Code != http.StatusServiceUnavailable {
+		t.Fatalf("UpdatePackageToVersion - Expected 503 but got: %d %s", response.Code, response.Body.String())
+	}
+
+	//	Nothing was changed, so nothing is restored
+	if len(fake.installs) != 1 || fake.installed != "1.0.1" {
+		t.Errorf("UpdatePackageToVersion - Expected a single install attempt, but got: %v", fake.installs)
+	}
+}
+
+func TestUpdatePackageToVersion_AlreadyChanging_Returns423(t *testing.T) {
+
+	//	Arrange
+	fake := &fakePackageManager{installed: "1.0.1", started: make(chan bool), release: make(chan bool)}
+	router, cleanup := setupFakePackage(t, fake)
+	defer cleanup()
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- sendRequest(router, "POST", "/v1/package/daydash/updatetoversion/1.0.2")
+	}()
+	<-fake.started
+
+	//	Act
+	update := sendRequest(router, "POST", "/v1/package/daydash/updatetoversion/1.0.2")
+	remove := sendRequest(router, "DELETE", "/v1/package/daydash")
+
+	fake.release <- true
+	first := <-done
+
+	//	Assert
+	if update.Code != http.StatusLocked || remove.Code != http.StatusLocked {
+		t.Errorf("UpdatePackageToVersion - Expected 423 while the package is changing, but got: %d and %d", update.Code, remove.Code)
+	}
+
+	if first.Code != http.StatusOK {
+		t.Errorf("UpdatePackageToVersion - Expected the first update to finish, but got: %d %s", first.Code, first.Body.String())
+	}
+}
+
+func TestRemovePackage_RemoveAndPurge(t *testing.T) {
+
+	//	Arrange
+	fake := &fakePackageManager{installed: "1.0.1"}
+	router, cleanup := setupFakePackage(t, fake)
+	defer cleanup()
+
+	//	Act
+	dryRun := sendRequest(router, "DELETE", "/v1/package/daydash?purge=true&dryrun=true")
+	remove := sendRequest(router, "DELETE", "/v1/package/daydash")
+	removeAgain := sendRequest(router, "DELETE", "/v1/package/daydash")
+	purge := sendRequest(router, "DELETE", "/v1/package/daydash?purge=true")
+
+	//	Assert
+	if dryRun.Code != http.StatusOK || !strings.Contains(dryRun.Body.String(), "Dry run") {
+		t.Errorf("RemovePackage - Expected a dry run report but got: %d %s", dryRun.Code, dryRun.Body.String())
+	}
+
+	if remove.Code != http.StatusOK {
+		t.Errorf("RemovePackage - Expected 200 but got: %d %s", remove.Code, remove.Body.String())
+	}
+
+	if removeAgain.Code != http.StatusConflict {
+		t.Errorf("RemovePackage - Expected 409 for a package that isn't installed, but got: %d %s", removeAgain.Code, removeAgain.Body.String())
+	}
+
+	//	A package that isn't installed can still be purged
+	if purge.Code != http.StatusOK {
+		t.Errorf("RemovePackage - Expected the purge to work, but got: %d %s", purge.Code, purge.Body.String())
+	}
+
+	if strings.Join(fake.removes, ",") != "remove,purge" {
+		t.Errorf("RemovePackage - Expected a remove and a purge (and nothing for the dry run), but got: %v", fake.removes)
+	}
+
+	entries, _ := history.GetEntriesForPackage("daydash")
+	if len(entries) != 2 || entries[0].Operation != history.OperationRemove || entries[1].Operation != history.OperationPurge {
+		t.Errorf("RemovePackage - Expected the remove and purge to be recorded in the history, but got: %+v", entries)
+	}
+}
+
+func TestRemovePackage_PackageManagerBusy_Returns503(t *testing.T) {
+
+	//	Arrange
+	fake := &fakePackageManager{installed: "1.0.1", removeErr: fmt.Errorf("%w: held by apt", pkgmgr.ErrBusy)}
+	router, cleanup := setupFakePackage(t, fake)
+	defer cleanup()
+
+	//	Act
+	response := sendRequest(router, "DELETE", "/v1/package/daydash")
+
+	//	Assert
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("RemovePackage - Expected 503 but got: %d %s", response.Code, response.Body.String())
+	}
+
+	if fake.installed != "1.0.1" {
+		t.Errorf("RemovePackage - Expected the package to still be installed, but got: %s", fake.installed)
+	}
+}
+
+func TestGetHistoryForPackage_ReturnsPackageEntries(t *testing.T) {
+
+	//	Arrange
+	dir, err := ioutil.TempDir("", "appupgrade-history-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("state.path", dir)
+	defer viper.Set("state.path", "")
+
+	history.Record(history.Entry{Package: "daydash", Operation: history.OperationUpdate, Version: "1.0.2", PreviousVersion: "1.0.1", Success: true})
+	history.Record(history.Entry{Package: "otherapp", Operation: history.OperationInstall, Version: "3.0.0", Success: true})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/package/{package}/history", api.Service{}.GetHistoryForPackage).Methods("GET")
+
+	//	Act
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest("GET", "/v1/package/daydash/history", nil))
+
+	//	Assert
+	if response.Code != http.StatusOK {
+		t.Fatalf("GetHistoryForPackage - Expected 200 but got: %d %s", response.Code, response.Body.String())
+	}
+
+	result := struct {
+		Data []history.Entry `json:"data"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		t.Fatalf("GetHistoryForPackage - Should decode the response without error, but got: %s", err)
+	}
+
+	if len(result.Data) != 1 || result.Data[0].Package != "daydash" || result.Data[0].Version != "1.0.2" {
+		t.Errorf("GetHistoryForPackage - Expected only the daydash entry, but got: %+v", result.Data)
+	}
+}
+
+func TestInstallPackageVersion_BlankPackage_SendsOneBadRequest(t *testing.T) {
+
+	//	Arrange
+	//	Without the router, the package and version are blank
+	handlers := map[string]http.HandlerFunc{
+		"InstallPackageVersion":    api.Service{}.InstallPackageVersion,
+		"UpdatePackageToVersion":   api.Service{}.UpdatePackageToVersion,
+		"GetVersionInfoForPackage": api.Service{}.GetVersionInfoForPackage,
+	}
+
+	for name, handler := range handlers {
+		//	Act
+		response := httptest.NewRecorder()
+		handler(response, httptest.NewRequest("GET", "/v1/package//info", nil))
+
+		//	Assert
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("%s - Expected 400 but got: %d", name, response.Code)
+		}
+
+		decoder := json.NewDecoder(response.Body)
+		first, second := api.ErrorResponse{}, api.ErrorResponse{}
+		if err := decoder.Decode(&first); err != nil || decoder.Decode(&second) == nil {
+			t.Errorf("%s - Expected a single error response, but got: %s", name, response.Body.String())
+		}
+	}
+}
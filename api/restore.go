@@ -0,0 +1,94 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/danesparza/appupgrade/history"
+	"github.com/danesparza/appupgrade/pkgmgr"
+	"github.com/danesparza/appupgrade/source"
+	log "github.com/sirupsen/logrus"
+)
+
+// restorePackage puts a package back the way it was before a failed update: the previous version is reinstalled
+// (or a package that wasn't installed before is removed).  The restore is recorded in the history.  It returns what it did
+func restorePackage(packageManager pkgmgr.PackageManager, releaseSource source.ReleaseSource, request pkgmgr.InstallRequest, wasInstalled bool, previousVersion string) string {
+	retval := ""
+	entry := history.Entry{Package: request.Package, Operation: history.OperationRestore, Version: previousVersion, PreviousVersion: request.Version}
+
+	installedVersion, err := packageManager.GetCurrentVersionForPackage(request.Package)
+	isInstalled := err == nil
+
+	switch {
+	case !wasInstalled && !isInstalled && errors.Is(err, pkgmgr.ErrNotInstalled):
+		return "nothing to restore: the package isn't installed"
+	case wasInstalled && isInstalled && pkgmgr.VersionMatches(installedVersion, previousVersion):
+		return fmt.Sprintf("nothing to restore: version %s is still installed", installedVersion)
+	case !wasInstalled:
+		//	It wasn't installed before, so restoring it means removing it
+		if _, err := packageManager.RemovePackage(request.Package); err != nil {
+			retval = fmt.Sprintf("problem removing the package: %v", err)
+		} else {
+			entry.Success = true
+			retval = "removed the package"
+		}
+	default:
+		err = reinstallVersion(packageManager, releaseSource, request, previousVersion)
+		if err != nil {
+			retval = fmt.Sprintf("problem restoring version %s: %v", previousVersion, err)
+		} else {
+			entry.Success = true
+			retval = fmt.Sprintf("restored version %s", previousVersion)
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"package":         request.Package,
+		"failedVersion":   request.Version,
+		"previousVersion": previousVersion,
+		"restored":        entry.Success,
+		"message":         retval,
+	}).Warn("restored package after a failed change")
+
+	entry.Message = retval
+	recordHistory(entry)
+
+	return retval
+}
+
+// reinstallVersion downloads and installs the given version of a package (with the same settings as the request), and verifies it.
+// A package manager that still has the version (a Switcher) just switches back to it
+func reinstallVersion(packageManager pkgmgr.PackageManager, releaseSource source.ReleaseSource, request pkgmgr.InstallRequest, requestedVersion string) error {
+	if switcher, ok := packageManager.(pkgmgr.Switcher); ok {
+		_, err := switcher.SwitchVersion(request.Package, requestedVersion)
+		if err == nil {
+			return pkgmgr.VerifyInstall(packageManager, request.Package, requestedVersion)
+		}
+
+		if !errors.Is(err, pkgmgr.ErrVersionNotKept) {
+			return err
+		}
+	}
+
+	release, err := releaseSource.ResolveVersion(requestedVersion)
+	if err != nil {
+		return err
+	}
+
+	packageFile := ""
+	if packageManager.PackageFormat() != pkgmgr.FormatImage {
+		packageFile, err = source.DownloadAsset(releaseSource, release)
+		if err != nil {
+			return err
+		}
+	}
+
+	request.Version = release.Version
+	request.Path = packageFile
+
+	if _, err := packageManager.InstallPackage(request); err != nil {
+		return err
+	}
+
+	return pkgmgr.VerifyInstall(packageManager, request.Package, release.Version)
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/history"
+	"github.com/danesparza/appupgrade/pkgmgr"
+	"github.com/danesparza/appupgrade/source"
+	"github.com/spf13/viper"
+)
+
+// fakeSource is a release source with a single version of a binary release
+type fakeSource struct {
+	opened []string
+}
+
+func (f *fakeSource) Name() string {
+	return "fake"
+}
+
+func (f *fakeSource) ListReleases() ([]github.Release, error) {
+	return []github.Release{{Version: "1.0.1", Name: "daydash_linux_arm64"}}, nil
+}
+
+func (f *fakeSource) ResolveVersion(requestedVersion string) (github.Release, error) {
+	if requestedVersion != "1.0.1" {
+		return github.Release{}, source.ErrVersionNotFound
+	}
+
+	return github.Release{Version: "1.0.1", Name: "daydash_linux_arm64"}, nil
+}
+
+func (f *fakeSource) OpenAsset(release github.Release) (io.ReadCloser, error) {
+	f.opened = append(f.opened, release.Version)
+	return ioutil.NopCloser(strings.NewReader("daydash " + release.Version)), nil
+}
+
+// newTestTarball creates a tarball package manager under a temp directory, with the given version installed
+func newTestTarball(t *testing.T, installedVersion string) (pkgmgr.Tarball, func()) {
+	dir, err := ioutil.TempDir("", "appupgrade-restore-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+
+	viper.Set("state.path", filepath.Join(dir, "state"))
+	tarball := pkgmgr.Tarball{Root: filepath.Join(dir, "opt", "daydash"), StateDir: filepath.Join(dir, "state", "tarball")}
+
+	if installedVersion != "" {
+		releaseDir := filepath.Join(tarball.Root, "releases", installedVersion)
+		os.MkdirAll(releaseDir, 0755)
+		os.Symlink(releaseDir, filepath.Join(tarball.Root, "current"))
+
+		data, _ := json.Marshal(pkgmgr.TarballState{Version: installedVersion, Path: releaseDir})
+		os.MkdirAll(tarball.StateDir, 0755)
+		ioutil.WriteFile(filepath.Join(tarball.StateDir, "daydash.json"), data, 0644)
+	}
+
+	return tarball, func() {
+		viper.Set("state.path", "")
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRestorePackage_VersionNotKept_DownloadsIt(t *testing.T) {
+
+	//	Arrange
+	tarball, cleanup := newTestTarball(t, "1.0.2")
+	defer cleanup()
+	releases := &fakeSource{}
+
+	//	Act
+	message := restorePackage(tarball, releases, pkgmgr.InstallRequest{Package: "daydash", Version: "1.0.2"}, true, "1.0.1")
+
+	//	Assert
+	if message != "restored version 1.0.1" {
+		t.Errorf("restorePackage - Expected version 1.0.1 to be restored, but got: %s", message)
+	}
+
+	if len(releases.opened) != 1 || releases.opened[0] != "1.0.1" {
+		t.Errorf("restorePackage - Expected version 1.0.1 to be downloaded, but got: %v", releases.opened)
+	}
+
+	if contents, _ := ioutil.ReadFile(filepath.Join(tarball.Root, "current", "daydash")); string(contents) != "daydash 1.0.1" {
+		t.Errorf("restorePackage - Expected the downloaded version to be current, but got: %s", contents)
+	}
+
+	entries, _ := history.GetEntriesForPackage("daydash")
+	if len(entries) != 1 || entries[0].Operation != history.OperationRestore || !entries[0].Success || entries[0].Version != "1.0.1" {
+		t.Errorf("restorePackage - Expected the restore to be recorded in the history, but got: %+v", entries)
+	}
+}
+
+func TestRestorePackage_VersionKept_SwitchesWithoutDownloading(t *testing.T) {
+
+	//	Arrange
+	tarball, cleanup := newTestTarball(t, "1.0.2")
+	defer cleanup()
+	os.MkdirAll(filepath.Join(tarball.Root, "releases", "1.0.1"), 0755)
+	releases := &fakeSource{}
+
+	//	Act
+	message := restorePackage(tarball, releases, pkgmgr.InstallRequest{Package: "daydash", Version: "1.0.2"}, true, "1.0.1")
+
+	//	Assert
+	if message != "restored version 1.0.1" {
+		t.Errorf("restorePackage - Expected version 1.0.1 to be restored, but got: %s", message)
+	}
+
+	if len(releases.opened) != 0 {
+		t.Errorf("restorePackage - Expected the kept version to be switched to without a download, but got: %v", releases.opened)
+	}
+}
+
+func TestRestorePackage_NotInstalledBefore_RemovesIt(t *testing.T) {
+
+	//	Arrange
+	tarball, cleanup := newTestTarball(t, "1.0.2")
+	defer cleanup()
+
+	//	Act
+	message := restorePackage(tarball, &fakeSource{}, pkgmgr.InstallRequest{Package: "daydash", Version: "1.0.2"}, false, "")
+
+	//	Assert
+	if message != "removed the package" {
+		t.Errorf("restorePackage - Expected the package to be removed, but got: %s", message)
+	}
+
+	if _, err := tarball.GetCurrentVersionForPackage("daydash"); !errors.Is(err, pkgmgr.ErrNotInstalled) {
+		t.Errorf("restorePackage - Expected the package not to be installed, but got: %v", err)
+	}
+}
+
+func TestRestorePackage_PreviousVersionStillInstalled_DoesNothing(t *testing.T) {
+
+	//	Arrange
+	tarball, cleanup := newTestTarball(t, "1.0.1")
+	defer cleanup()
+	releases := &fakeSource{}
+
+	//	Act
+	message := restorePackage(tarball, releases, pkgmgr.InstallRequest{Package: "daydash", Version: "1.0.2"}, true, "1.0.1")
+
+	//	Assert
+	if message != "nothing to restore: version 1.0.1 is still installed" {
+		t.Errorf("restorePackage - Expected nothing to be restored, but got: %s", message)
+	}
+
+	if entries, _ := history.GetEntriesForPackage("daydash"); len(entries) != 0 {
+		t.Errorf("restorePackage - Expected nothing to be recorded in the history, but got: %+v", entries)
+	}
+}
+
+func TestRestorePackage_VersionNotFound_ReportsProblem(t *testing.T) {
+
+	//	Arrange
+	tarball, cleanup := newTestTarball(t, "1.0.3")
+	defer cleanup()
+
+	//	Act
+	message := restorePackage(tarball, &fakeSource{}, pkgmgr.InstallRequest{Package: "daydash", Version: "1.0.3"}, true, "1.0.0")
+
+	//	Assert
+	if !strings.HasPrefix(message, "problem restoring version 1.0.0") {
+		t.Errorf("restorePackage - Expected a problem restoring a version the source doesn't have, but got: %s", message)
+	}
+
+	entries, _ := history.GetEntriesForPackage("daydash")
+	if len(entries) != 1 || entries[0].Success {
+		t.Errorf("restorePackage - Expected the failed restore to be recorded in the history, but got: %+v", entries)
+	}
+}
@@ -0,0 +1,297 @@
+package aptrepo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/danesparza/appupgrade/dpkg"
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/system"
+	log "github.com/sirupsen/logrus"
+)
+
+// errNotFound is returned when a file doesn't exist in the repository
+var errNotFound = errors.New("not found")
+
+// Repo describes a debian repository (a PPA, an aptly published repo, etc)
+type Repo struct {
+	URL       string // The base url of the repository (the directory that contains dists/ and pool/)
+	Suite     string // The suite or codename (stable, focal, etc)
+	Component string // The component.  Defaults to main
+	Keyring   string // If set, the Release file signature is verified with gpgv against this keyring
+}
+
+// GetVersionsForPackage gets all versions of the given package for this machine's architecture listed
+// in the repository's Packages index.  The Release file is used to find (and check) the index
+func GetVersionsForPackage(repo Repo, packageName string) ([]github.Release, error) {
+	retval := []github.Release{}
+
+	//	Get the Release information (and verify it if we can)
+	releaseData, err := getRelease(repo)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"repo":  repo.URL,
+			"suite": repo.Suite,
+		}).Error("problem getting the repository release file")
+		return retval, err
+	}
+
+	releaseStanzas, err := dpkg.ParseControl(bytes.NewReader(releaseData))
+	if err != nil || len(releaseStanzas) == 0 {
+		return retval, fmt.Errorf("problem parsing the repository release file: %v", err)
+	}
+
+	checksums := parseChecksums(releaseStanzas[0]["SHA256"])
+
+	//	Read the index for our architecture and for arch independent packages
+	for _, arch := range []string{system.GetArchitecture(), "all"} {
+		stanzas, err := getPackagesIndex(repo, arch, checksums)
+		if err == errNotFound {
+			continue
+		}
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"repo":  repo.URL,
+				"suite": repo.Suite,
+				"arch":  arch,
+			}).Error("problem getting the repository packages index")
+			return retval, err
+		}
+
+		for _, stanza := range stanzas {
+			if stanza["Package"] != packageName || !system.ArchitectureMatches(stanza["Architecture"]) {
+				continue
+			}
+
+			filename := stanza["Filename"]
+			newRelease := github.Release{
+				Version:      stanza["Version"],
+				Name:         filename[strings.LastIndex(filename, "/")+1:],
+				DownloadUrl:  repo.baseURL() + "/" + filename,
+				Checksum:     stanza["SHA256"],
+				ReleaseNotes: stanza["Description"],
+			}
+
+			retval = append(retval, newRelease)
+		}
+	}
+
+	github.SortNewestFirst(retval)
+
+	return retval, nil
+}
+
+// getRelease gets the contents of the suite's Release file.  InRelease is tried first, then Release
+func getRelease(repo Repo) ([]byte, error) {
+	distUrl := fmt.Sprintf("%s/dists/%s", repo.baseURL(), repo.Suite)
+
+	inRelease, err := fetch(distUrl + "/InRelease")
+	if err == nil {
+		if repo.Keyring != "" {
+			return verifyClearSigned(repo.Keyring, inRelease)
+		}
+		return stripClearSign(inRelease), nil
+	}
+	if err != errNotFound {
+		return nil, err
+	}
+
+	//	Fall back to Release (and Release.gpg)
+	release, err := fetch(distUrl + "/Release")
+	if err != nil {
+		return nil, err
+	}
+
+	if repo.Keyring != "" {
+		signature, err := fetch(distUrl + "/Release.gpg")
+		if err != nil {
+			return nil, fmt.Errorf("problem getting the Release.gpg signature: %v", err)
+		}
+
+		if err := verifyDetached(repo.Keyring, release, signature); err != nil {
+			return nil, err
+		}
+	}
+
+	return release, nil
+}
+
+// getPackagesIndex gets the parsed Packages index for the given architecture.  The compressed index
+// is preferred.  If the Release file lists a checksum for the index, it is checked.  If the Release
+// file's signature was verified (a keyring is set), an index it doesn't list isn't used
+func getPackagesIndex(repo Repo, arch string, checksums map[string]string) ([]map[string]string, error) {
+	component := repo.Component
+	if component == "" {
+		component = "main"
+	}
+
+	lastErr := errNotFound
+	for _, name := range []string{"Packages.gz", "Packages"} {
+		indexPath := fmt.Sprintf("%s/binary-%s/%s", component, arch, name)
+
+		data, err := fetch(fmt.Sprintf("%s/dists/%s/%s", repo.baseURL(), repo.Suite, indexPath))
+		if err == errNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		expected, ok := checksums[indexPath]
+		if !ok && repo.Keyring != "" {
+			lastErr = fmt.Errorf("%s isn't listed in the signed Release file", indexPath)
+			continue
+		}
+
+		if ok {
+			actual := sha256.Sum256(data)
+			if !strings.EqualFold(hex.EncodeToString(actual[:]), expected) {
+				return nil, fmt.Errorf("checksum mismatch for %s", indexPath)
+			}
+		}
+
+		var reader io.Reader = bytes.NewReader(data)
+		if strings.HasSuffix(name, ".gz") {
+			gzReader, err := gzip.NewReader(reader)
+			if err != nil {
+				return nil, err
+			}
+			defer gzReader.Close()
+			reader = gzReader
+		}
+
+		return dpkg.ParseControl(reader)
+	}
+
+	return nil, lastErr
+}
+
+// parseChecksums parses the SHA256 field of a Release file into a map of path -> checksum
+func parseChecksums(field string) map[string]string {
+	retval := make(map[string]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(field))
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 3 {
+			retval[parts[2]] = parts[0]
+		}
+	}
+
+	return retval
+}
+
+// stripClearSign gets the signed content from a clear signed message without verifying it
+func stripClearSign(data []byte) []byte {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP SIGNED MESSAGE-----")) {
+		return data
+	}
+
+	//	The content starts after the armor headers (the first blank line)
+	start := bytes.Index(data, []byte("\n\n"))
+	end := bytes.Index(data, []byte("-----BEGIN PGP SIGNATURE-----"))
+	if start < 0 || end < start {
+		return data
+	}
+
+	var sb bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data[start+2 : end]))
+	for scanner.Scan() {
+		sb.WriteString(strings.TrimPrefix(scanner.Text(), "- "))
+		sb.WriteString("\n")
+	}
+
+	return sb.Bytes()
+}
+
+// verifyClearSigned verifies a clear signed message with gpgv and returns the signed content
+func verifyClearSigned(keyring string, data []byte) ([]byte, error) {
+	signedFile, err := writeTempFile(data)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(signedFile)
+
+	output, err := exec.Command("gpgv", "--keyring", keyring, "--output", "-", signedFile).Output()
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"keyring": keyring,
+		}).Error("problem verifying the InRelease signature")
+		return nil, fmt.Errorf("problem verifying the InRelease signature: %v", err)
+	}
+
+	return output, nil
+}
+
+// verifyDetached verifies data against a detached signature with gpgv
+func verifyDetached(keyring string, data, signature []byte) error {
+	dataFile, err := writeTempFile(data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dataFile)
+
+	signatureFile, err := writeTempFile(signature)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(signatureFile)
+
+	output, err := exec.Command("gpgv", "--keyring", keyring, signatureFile, dataFile).CombinedOutput()
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"keyring": keyring,
+			"output":  strings.TrimSpace(string(output)),
+		}).Error("problem verifying the Release signature")
+		return fmt.Errorf("problem verifying the Release signature: %v", err)
+	}
+
+	return nil
+}
+
+// fetch gets the contents of a url.  errNotFound is returned for a 404
+func fetch(fileUrl string) ([]byte, error) {
+	resp, err := http.Get(fileUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected response status for %s: %s", fileUrl, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// writeTempFile writes data to a temp file and returns its location
+func writeTempFile(data []byte) (string, error) {
+	tempFile, err := ioutil.TempFile("", "appupgrade-apt-*")
+	if err != nil {
+		return "", err
+	}
+	defer tempFile.Close()
+
+	_, err = tempFile.Write(data)
+	return tempFile.Name(), err
+}
+
+// baseURL gets the repository url without a trailing slash
+func (repo Repo) baseURL() string {
+	return strings.TrimSuffix(repo.URL, "/")
+}
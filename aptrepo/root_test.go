@@ -0,0 +1,176 @@
+package aptrepo_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/danesparza/appupgrade/aptrepo"
+	"github.com/danesparza/appupgrade/system"
+)
+
+func TestAptrepo_GetVersionsForPackage_InRelease_Successful(t *testing.T) {
+
+	//	Arrange
+	arch := system.GetArchitecture()
+
+	packages := fmt.Sprintf(`Package: daydash
+Version: 1.0.1
+Architecture: %[1]s
+Filename: pool/main/d/daydash/daydash_1.0.1_%[1]s.deb
+SHA256: aaaa
+Description: A dashboard
+
+Package: otherapp
+Version: 3.0.0
+Architecture: %[1]s
+Filename: pool/main/o/otherapp/otherapp_3.0.0_%[1]s.deb
+
+Package: daydash
+Version: 1.0.2
+Architecture: %[1]s
+Filename: pool/main/d/daydash/daydash_1.0.2_%[1]s.deb
+SHA256: bbbb
+Description: A dashboard
+ with a longer description
+`, arch)
+
+	var compressed bytes.Buffer
+	gzWriter := gzip.NewWriter(&compressed)
+	gzWriter.Write([]byte(packages))
+	gzWriter.Close()
+
+	indexHash := sha256.Sum256(compressed.Bytes())
+	inRelease := fmt.Sprintf(`-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA256
+
+Origin: Example
+Suite: stable
+SHA256:
+ %s %d main/binary-%s/Packages.gz
+-----BEGIN PGP SIGNATURE-----
+
+notarealsignature
+-----END PGP SIGNATURE-----
+`, hex.EncodeToString(indexHash[:]), compressed.Len(), arch)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/debian/dists/stable/InRelease":
+			fmt.Fprint(rw, inRelease)
+		case fmt.Sprintf("/debian/dists/stable/main/binary-%s/Packages.gz", arch):
+			rw.Write(compressed.Bytes())
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	repo := aptrepo.Repo{
+		URL:   server.URL + "/debian/",
+		Suite: "stable",
+	}
+
+	//	Act
+	releases, err := aptrepo.GetVersionsForPackage(repo, "daydash")
+
+	//	Assert
+	if err != nil {
+		t.Errorf("GetVersionsForPackage - Should get versions without error, but got: %s", err)
+	}
+
+	if len(releases) != 2 {
+		t.Fatalf("GetVersionsForPackage failed: Expected 2 versions of daydash, but got %d", len(releases))
+	}
+
+	if releases[0].Version != "1.0.2" || releases[0].Checksum != "bbbb" {
+		t.Errorf("GetVersionsForPackage failed: Expected the newest version first, but got %+v", releases[0])
+	}
+
+	expectedUrl := fmt.Sprintf("%s/debian/pool/main/d/daydash/daydash_1.0.2_%s.deb", server.URL, arch)
+	if releases[0].DownloadUrl != expectedUrl {
+		t.Errorf("GetVersionsForPackage failed: Expected download url %s but got %s", expectedUrl, releases[0].DownloadUrl)
+	}
+}
+
+func TestAptrepo_GetVersionsForPackage_BadIndexChecksum_ReturnsError(t *testing.T) {
+
+	//	Arrange
+	arch := system.GetArchitecture()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/dists/stable/InRelease":
+			fmt.Fprintf(rw, "Suite: stable\nSHA256:\n 0000 10 main/binary-%s/Packages\n", arch)
+		case fmt.Sprintf("/dists/stable/main/binary-%s/Packages", arch):
+			fmt.Fprint(rw, "Package: daydash\nVersion: 1.0.2\n")
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	//	Act
+	_, err := aptrepo.GetVersionsForPackage(aptrepo.Repo{URL: server.URL, Suite: "stable"}, "daydash")
+
+	//	Assert
+	if err == nil {
+		t.Errorf("GetVersionsForPackage - Should fail when the index doesn't match the Release checksum, but didn't")
+	}
+}
+
+func TestAptrepo_GetVersionsForPackage_Keyring_UnlistedIndex_ReturnsError(t *testing.T) {
+
+	//	Arrange
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "appupgrade-aptrepo-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	//	The fake gpgv accepts every signature and prints the signed file
+	fakeGpgv := "#!/bin/sh\nfor last; do true; done\ncat \"$last\"\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "gpgv"), []byte(fakeGpgv), 0755); err != nil {
+		t.Fatalf("WriteFile - Should write fake gpgv without error, but got: %s", err)
+	}
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	//	The signed Release file doesn't list the Packages index that's served
+	arch := system.GetArchitecture()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/dists/stable/InRelease":
+			fmt.Fprint(rw, "Suite: stable\nSHA256:\n 0000 10 main/binary-all/Packages\n")
+		case fmt.Sprintf("/dists/stable/main/binary-%s/Packages", arch):
+			fmt.Fprintf(rw, "Package: daydash\nVersion: 1.0.2\nArchitecture: %s\nFilename: pool/daydash_1.0.2_%s.deb\n", arch, arch)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	repo := aptrepo.Repo{URL: server.URL, Suite: "stable", Keyring: filepath.Join(dir, "keyring.gpg")}
+
+	//	Act
+	releases, err := aptrepo.GetVersionsForPackage(repo, "daydash")
+
+	//	Assert
+	if err == nil {
+		t.Errorf("GetVersionsForPackage - Should fail when the signed Release file doesn't list the index, but got: %+v", releases)
+	}
+}
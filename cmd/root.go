@@ -62,6 +62,13 @@ func initConfig() {
 	viper.SetDefault("server.port", "3007")
 	viper.SetDefault("server.allowed-origins", "*")
 	viper.SetDefault("log.level", "info")
+	viper.SetDefault("github.api-url", "https://api.github.com")
+	viper.SetDefault("plugins.timeout", "5m")
+	viper.SetDefault("package-manager", "dpkg")
+	viper.SetDefault("state.path", "/var/lib/appupgrade")
+	viper.SetDefault("docker.socket", "/var/run/docker.sock")
+	viper.SetDefault("preflight.min-free-mb", 100)
+	viper.SetDefault("dpkg.lock-timeout", "5m")
 
 	// If a config file is found, read it in
 	viper.ReadInConfig()
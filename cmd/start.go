@@ -45,6 +45,9 @@ func start(cmd *cobra.Command, args []string) {
 		"Monitor packages": monitorPackages,
 	}).Info("Starting up")
 
+	//	Finish any package changes that were interrupted (by a power loss, for example) before taking new ones
+	api.RecoverInterruptedOperations()
+
 	//	Create an api service object
 	apiService := api.Service{
 		StartTime: time.Now(),
@@ -65,6 +68,10 @@ func start(cmd *cobra.Command, args []string) {
 	//	PACKAGE ROUTES
 	restRouter.HandleFunc("/v1/package/{package}/info", apiService.GetVersionInfoForPackage).Methods("GET")                     // Get version data
 	restRouter.HandleFunc("/v1/package/{package}/updatetoversion/{version}", apiService.UpdatePackageToVersion).Methods("POST") // Update app to the specified version
+	restRouter.HandleFunc("/v1/package/{package}/install/{version}", apiService.InstallPackageVersion).Methods("POST")          // Install the specified version of an app that isn't installed
+	restRouter.HandleFunc("/v1/package/{package}/preflight/{version}", apiService.GetPreflightForPackage).Methods("GET")        // Check the system is fit to update an app to the specified version
+	restRouter.HandleFunc("/v1/package/{package}/history", apiService.GetHistoryForPackage).Methods("GET")                      // Get the history of changes to an app
+	restRouter.HandleFunc("/v1/package/{package}", apiService.RemovePackage).Methods("DELETE")                                  // Remove (or purge) an app
 
 	//	SWAGGER ROUTES
 	restRouter.PathPrefix("/v1/swagger").Handler(httpSwagger.WrapHandler)
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// Package upgrade strategies
+const (
+	StrategyUpgrade = "upgrade" // Install the new package over the installed one (a normal package upgrade that keeps conffiles)
+	StrategyReplace = "replace" // Remove the installed package, then install the new one
+)
+
+// Conffile policies: what to do when a new package version changes a configuration file
+const (
+	ConffilesKeepOld      = "keep-old"      // Always keep the installed configuration file, even if it wasn't edited
+	ConffilesTakeNew      = "take-new"      // Always take the package's new configuration file
+	ConffilesKeepModified = "keep-modified" // Take the new configuration file, unless the installed one has been changed
+)
+
+// Source describes a single place that releases for a package can be found
+type Source struct {
+	URL     string `mapstructure:"url" json:"url"`           // The url of the source (a github repo url, for example)
+	Type    string `mapstructure:"type" json:"type"`         // The type of source.  If blank, the type is inferred from the url
+	Token   string `mapstructure:"token" json:"-"`           // The access token to use with the source (if needed)
+	BaseURL string `mapstructure:"base-url" json:"base-url"` // The base url of the source's server, if it can't be inferred from the url
+
+	APIURL      string `mapstructure:"api-url" json:"api-url"`           // Github only: the api url (for github enterprise server)
+	DownloadURL string `mapstructure:"download-url" json:"download-url"` // Github only: the download host for release assets
+
+	Region    string `mapstructure:"region" json:"region"` // S3 only: the region of the bucket
+	AccessKey string `mapstructure:"access-key" json:"-"`  // S3 only: the access key
+	SecretKey string `mapstructure:"secret-key" json:"-"`  // S3 only: the secret key
+	Layout    string `mapstructure:"layout" json:"layout"` // S3 only: the object key layout, like {package}/{version}/{arch}/*.deb
+
+	Suite     string `mapstructure:"suite" json:"suite"`         // APT only: the suite or codename of the repository (stable, focal, etc)
+	Component string `mapstructure:"component" json:"component"` // APT only: the repository component.  Defaults to main
+	Keyring   string `mapstructure:"keyring" json:"keyring"`     // APT only: the keyring used to verify the Release signature
+
+	Username string `mapstructure:"username" json:"username"` // OCI and image only: the registry username
+	Password string `mapstructure:"password" json:"-"`        // OCI and image only: the registry password
+
+	Command string        `mapstructure:"command" json:"command"` // Plugin only: the plugin executable
+	Args    []string      `mapstructure:"args" json:"args"`       // Plugin only: extra arguments for the plugin executable
+	Timeout time.Duration `mapstructure:"timeout" json:"timeout"` // Plugin only: how long the plugin is given to respond
+}
+
+// Preseed is the answer to a debconf question, set before a package is installed
+type Preseed struct {
+	Owner    string `mapstructure:"owner" json:"owner"`       // The package that owns the question.  Defaults to the package being installed
+	Question string `mapstructure:"question" json:"question"` // The question name (like myapp/listen-port)
+	Type     string `mapstructure:"type" json:"type"`         // The question type (string, boolean, select, etc)
+	Value    string `mapstructure:"value" json:"value"`       // The answer
+}
+
+// Package describes the configuration for a single monitored package
+//
+// A package can be configured with just a url:
+//
+//	daydash: https://github.com/danesparza/daydash
+//
+// or with an ordered list of sources that are tried in turn:
+//
+//	daydash:
+//	  - https://github.com/danesparza/daydash
+//	  - https://github.com/danesparza-mirror/daydash
+type Package struct {
+	Name    string `mapstructure:"-"`
+	Source  `mapstructure:",squash"`
+	Sources []Source `mapstructure:"sources"`
+
+	Strategy       string    `mapstructure:"strategy" json:"strategy"`               // How the package is upgraded: upgrade or replace.  Defaults to the global strategy setting (or upgrade)
+	Conffiles      string    `mapstructure:"conffiles" json:"conffiles"`             // What to do with changed configuration files: keep-old, take-new or keep-modified.  Defaults to the global conffiles setting (or keep-modified)
+	Preseed        []Preseed `mapstructure:"preseed" json:"preseed"`                 // Debconf answers to set before the package is installed (deb packages only)
+	PackageManager string    `mapstructure:"package-manager" json:"package-manager"` // The package manager used to install the package (dpkg, apt, rpm, dnf, tarball or container).  Defaults to the global package-manager setting
+
+	InstallDir string `mapstructure:"install-dir" json:"install-dir"` // Tarball only: the directory releases are unpacked under.  Defaults to /opt/<package>
+	Service    string `mapstructure:"service" json:"service"`         // Tarball only: the systemd unit to restart after switching versions
+	Asset      string `mapstructure:"asset" json:"asset"`             // Tarball only: a pattern for the release asset name, like myapp_*_linux_arm64.tar.gz
+
+	Container string `mapstructure:"container" json:"container"` // Container only: the name of the container.  Defaults to the package name
+}
+
+// GetSources returns the ordered list of sources for the package
+func (p Package) GetSources() []Source {
+	retval := []Source{}
+
+	if p.URL != "" {
+		retval = append(retval, p.Source)
+	}
+
+	retval = append(retval, p.Sources...)
+
+	return retval
+}
+
+// GetStrategy returns the upgrade strategy for the package.  If the package doesn't
+// set one, the global strategy setting is used (and if that isn't set, upgrade)
+func (p Package) GetStrategy() (string, error) {
+	retval := p.Strategy
+	if retval == "" {
+		retval = viper.GetString("strategy")
+	}
+
+	switch retval {
+	case "":
+		return StrategyUpgrade, nil
+	case StrategyUpgrade, StrategyReplace:
+		return retval, nil
+	}
+
+	return retval, fmt.Errorf("unknown strategy for package %s: %s", p.Name, retval)
+}
+
+// GetConffilePolicy returns the conffile policy for the package.  If the package doesn't set
+// one, the global conffiles setting is used (and if that isn't set, keep-modified)
+func (p Package) GetConffilePolicy() (string, error) {
+	retval := p.Conffiles
+	if retval == "" {
+		retval = viper.GetString("conffiles")
+	}
+
+	switch retval {
+	case "":
+		return ConffilesKeepModified, nil
+	case ConffilesKeepOld, ConffilesTakeNew, ConffilesKeepModified:
+		return retval, nil
+	}
+
+	return retval, fmt.Errorf("unknown conffiles policy for package %s: %s", p.Name, retval)
+}
+
+// GetPackages returns the configuration for all monitored packages
+func GetPackages() (map[string]Package, error) {
+	retval := make(map[string]Package)
+
+	err := viper.UnmarshalKey("packages", &retval, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		packageHookFunc(),
+	)))
+	if err != nil {
+		return retval, err
+	}
+
+	//	Set the name of each package from its key
+	for name, pkg := range retval {
+		pkg.Name = name
+		retval[name] = pkg
+	}
+
+	return retval, nil
+}
+
+// GetPackage returns the configuration for the given package, and whether the package is monitored
+func GetPackage(packageName string) (Package, bool, error) {
+	packages, err := GetPackages()
+	if err != nil {
+		return Package{}, false, err
+	}
+
+	pkg, packageIsMonitored := packages[packageName]
+	return pkg, packageIsMonitored, nil
+}
+
+// packageHookFunc allows the short forms of package and source configuration
+// (a plain url, or a plain list of sources) to be decoded
+func packageHookFunc() mapstructure.DecodeHookFuncType {
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		switch to {
+		case reflect.TypeOf(Package{}):
+			switch from.Kind() {
+			case reflect.String:
+				return map[string]interface{}{"url": data}, nil
+			case reflect.Slice:
+				return map[string]interface{}{"sources": data}, nil
+			}
+		case reflect.TypeOf(Source{}):
+			if from.Kind() == reflect.String {
+				return map[string]interface{}{"url": data}, nil
+			}
+		}
+
+		return data, nil
+	}
+}
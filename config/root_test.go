@@ -0,0 +1,94 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danesparza/appupgrade/config"
+	"github.com/spf13/viper"
+)
+
+func TestConfig_GetPackages_ShortAndListForms_Successful(t *testing.T) {
+
+	//	Arrange
+	viper.Reset()
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(`
+packages:
+  daydash: https://github.com/danesparza/daydash
+  cloudjournal:
+    - https://github.com/danesparza/cloudjournal
+    - https://github.com/danesparza-mirror/cloudjournal
+`))
+	if err != nil {
+		t.Fatalf("ReadConfig - Should read config without error, but got: %s", err)
+	}
+
+	//	Act
+	packages, err := config.GetPackages()
+
+	//	Assert
+	if err != nil {
+		t.Errorf("GetPackages - Should get packages without error, but got: %s", err)
+	}
+
+	if sources := packages["daydash"].GetSources(); len(sources) != 1 || sources[0].URL != "https://github.com/danesparza/daydash" {
+		t.Errorf("GetPackages failed: Expected a single source for daydash, but got: %+v", sources)
+	}
+
+	sources := packages["cloudjournal"].GetSources()
+	if len(sources) != 2 {
+		t.Fatalf("GetPackages failed: Expected 2 sources for cloudjournal, but got: %+v", sources)
+	}
+
+	if sources[1].URL != "https://github.com/danesparza-mirror/cloudjournal" {
+		t.Errorf("GetPackages failed: Sources should be kept in order, but got: %+v", sources)
+	}
+
+	if packages["cloudjournal"].Name != "cloudjournal" {
+		t.Errorf("GetPackages failed: Expected the package name to be set, but got: %s", packages["cloudjournal"].Name)
+	}
+}
+
+func TestConfig_GetStrategy_DefaultsToUpgrade(t *testing.T) {
+
+	//	Arrange
+	viper.Reset()
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(`
+packages:
+  daydash: https://github.com/danesparza/daydash
+  cloudjournal:
+    url: https://github.com/danesparza/cloudjournal
+    strategy: replace
+  badapp:
+    url: https://github.com/danesparza/badapp
+    strategy: sideways
+`))
+	if err != nil {
+		t.Fatalf("ReadConfig - Should read config without error, but got: %s", err)
+	}
+
+	packages, err := config.GetPackages()
+	if err != nil {
+		t.Fatalf("GetPackages - Should get packages without error, but got: %s", err)
+	}
+
+	//	Act
+	defaultStrategy, defaultErr := packages["daydash"].GetStrategy()
+	replaceStrategy, replaceErr := packages["cloudjournal"].GetStrategy()
+	_, badErr := packages["badapp"].GetStrategy()
+
+	//	Assert
+	if defaultErr != nil || defaultStrategy != config.StrategyUpgrade {
+		t.Errorf("GetStrategy failed: Expected the upgrade strategy by default, but got: %s (%v)", defaultStrategy, defaultErr)
+	}
+
+	if replaceErr != nil || replaceStrategy != config.StrategyReplace {
+		t.Errorf("GetStrategy failed: Expected the replace strategy, but got: %s (%v)", replaceStrategy, replaceErr)
+	}
+
+	if badErr == nil {
+		t.Errorf("GetStrategy failed: Expected an error for an unknown strategy")
+	}
+}
@@ -0,0 +1,399 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultSocket is the default path of the docker engine api socket
+const DefaultSocket = "/var/run/docker.sock"
+
+// ErrNotFound is returned when a container (or image) doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// Client talks to the docker engine api over its unix socket
+type Client struct {
+	Socket string // The path of the docker engine api socket
+}
+
+// Container is the result of inspecting a container.  The configuration is kept as raw
+// json, so a container can be recreated with exactly the settings it was created with
+type Container struct {
+	ID         string                     `json:"Id"`
+	Name       string                     `json:"Name"`
+	Image      string                     `json:"Image"` // The image id
+	Config     map[string]json.RawMessage `json:"Config"`
+	HostConfig json.RawMessage            `json:"HostConfig"`
+	State      struct {
+		Running bool `json:"Running"`
+	} `json:"State"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			Aliases    []string        `json:"Aliases"`
+			IPAMConfig json.RawMessage `json:"IPAMConfig"`
+			Links      []string        `json:"Links"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// Image is the result of inspecting an image.  Only the configuration the image gives its containers is kept
+type Image struct {
+	ID     string                     `json:"Id"`
+	Config map[string]json.RawMessage `json:"Config"`
+}
+
+// Auth is the registry login used to pull images (sent to the engine in the X-Registry-Auth header)
+type Auth struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	RegistryToken string `json:"registrytoken,omitempty"`
+	ServerAddress string `json:"serveraddress,omitempty"`
+}
+
+// imageConfigKeys are the container settings that containers get from their image (unless they're set when the container is created)
+var imageConfigKeys = []string{"Cmd", "Entrypoint", "WorkingDir", "User", "ExposedPorts", "Volumes", "StopSignal", "Healthcheck", "Shell", "OnBuild", "ArgsEscaped"}
+
+// ImageReference gets the image the container was created from (like registry.example.com/myapp:1.0.2)
+func (c Container) ImageReference() string {
+	retval := ""
+	json.Unmarshal(c.Config["Image"], &retval)
+	return retval
+}
+
+// SplitImageReference splits an image reference into its repository and tag.
+// The tag is blank if the reference doesn't have one
+func SplitImageReference(reference string) (string, string) {
+	//	Ignore digests
+	if idx := strings.Index(reference, "@"); idx >= 0 {
+		reference = reference[:idx]
+	}
+
+	//	A colon after the last slash starts the tag (a colon before it is a registry port)
+	idx := strings.LastIndex(reference, ":")
+	if idx < 0 || idx < strings.LastIndex(reference, "/") {
+		return reference, ""
+	}
+
+	return reference[:idx], reference[idx+1:]
+}
+
+// InspectContainer gets the details of the named container
+func (client Client) InspectContainer(name string) (Container, error) {
+	retval := Container{}
+	err := client.do("GET", "/containers/"+url.PathEscape(name)+"/json", nil, nil, &retval)
+	return retval, err
+}
+
+// InspectImage gets the details of the image with the given id (or name)
+func (client Client) InspectImage(id string) (Image, error) {
+	retval := Image{}
+	err := client.do("GET", "/images/"+url.PathEscape(id)+"/json", nil, nil, &retval)
+	return retval, err
+}
+
+// PullImage pulls the given tag of an image repository.  If the auth has a login, it's passed to
+// the engine so it can pull from a private registry
+func (client Client) PullImage(repository, tag string, auth Auth) error {
+	query := url.Values{}
+	query.Set("fromImage", repository)
+	query.Set("tag", tag)
+
+	log.WithFields(log.Fields{
+		"image": repository + ":" + tag,
+	}).Debug("pulling image")
+
+	headers := map[string]string{}
+	if auth.Username != "" || auth.RegistryToken != "" {
+		if auth.ServerAddress == "" {
+			auth.ServerAddress = RegistryHost(repository)
+		}
+
+		authData, err := json.Marshal(auth)
+		if err != nil {
+			return err
+		}
+		headers["X-Registry-Auth"] = base64.URLEncoding.EncodeToString(authData)
+	}
+
+	resp, err := client.requestWithHeaders("POST", "/images/create", query, nil, headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	//	The pull progress is streamed.  Errors show up in the stream (even though the status was ok)
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		message := struct {
+			Error string `json:"error"`
+		}{}
+
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if message.Error != "" {
+			return fmt.Errorf("problem pulling image %s:%s: %s", repository, tag, message.Error)
+		}
+	}
+}
+
+// RegistryHost gets the registry an image repository is pulled from (docker hub if the name doesn't start with a registry host)
+func RegistryHost(repository string) string {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+
+	return "https://index.docker.io/v1/"
+}
+
+// CreateContainer creates a container with the given name, using the configuration of another container
+// (with a different image).  Only the settings the old container was given are copied: settings it got from
+// its image (fromImage) are left out, so the new image's environment, command, labels etc are used.
+// It returns the id of the new container
+func (client Client) CreateContainer(name, image string, from Container, fromImage Image) (string, error) {
+	config := userConfig(from.Config, fromImage.Config)
+
+	imageData, _ := json.Marshal(image)
+	config["Image"] = imageData
+
+	//	Docker sets the hostname to the short container id if one isn't given.  Don't copy that
+	hostname := ""
+	json.Unmarshal(config["Hostname"], &hostname)
+	if len(from.ID) >= 12 && hostname == from.ID[:12] {
+		delete(config, "Hostname")
+	}
+
+	if len(from.HostConfig) > 0 {
+		config["HostConfig"] = from.HostConfig
+	}
+
+	endpoints := map[string]interface{}{}
+	for network, settings := range from.NetworkSettings.Networks {
+		endpoint := map[string]interface{}{
+			"Aliases": settings.Aliases,
+			"Links":   settings.Links,
+		}
+		if len(settings.IPAMConfig) > 0 && string(settings.IPAMConfig) != "null" {
+			endpoint["IPAMConfig"] = settings.IPAMConfig
+		}
+		endpoints[network] = endpoint
+	}
+
+	networkingData, _ := json.Marshal(map[string]interface{}{"EndpointsConfig": endpoints})
+	config["NetworkingConfig"] = networkingData
+
+	query := url.Values{}
+	query.Set("name", name)
+
+	created := struct {
+		ID string `json:"Id"`
+	}{}
+
+	err := client.do("POST", "/containers/create", query, config, &created)
+	return created.ID, err
+}
+
+// userConfig gets the container configuration without the settings that came from its image.  The environment
+// and labels are merged by docker, so only the variables and labels the image doesn't have (or has with
+// a different value) are kept
+func userConfig(containerConfig, imageConfig map[string]json.RawMessage) map[string]json.RawMessage {
+	retval := map[string]json.RawMessage{}
+	for key, value := range containerConfig {
+		retval[key] = value
+	}
+
+	for _, key := range imageConfigKeys {
+		if sameJSON(retval[key], imageConfig[key]) {
+			delete(retval, key)
+		}
+	}
+
+	//	Environment variables
+	containerEnv, imageEnv := []string{}, []string{}
+	json.Unmarshal(retval["Env"], &containerEnv)
+	json.Unmarshal(imageConfig["Env"], &imageEnv)
+
+	fromImage := map[string]bool{}
+	for _, variable := range imageEnv {
+		fromImage[variable] = true
+	}
+
+	env := []string{}
+	for _, variable := range containerEnv {
+		if !fromImage[variable] {
+			env = append(env, variable)
+		}
+	}
+
+	delete(retval, "Env")
+	if len(env) > 0 {
+		retval["Env"], _ = json.Marshal(env)
+	}
+
+	//	Labels
+	containerLabels, imageLabels := map[string]string{}, map[string]string{}
+	json.Unmarshal(retval["Labels"], &containerLabels)
+	json.Unmarshal(imageConfig["Labels"], &imageLabels)
+
+	labels := map[string]string{}
+	for label, value := range containerLabels {
+		if imageValue, ok := imageLabels[label]; !ok || imageValue != value {
+			labels[label] = value
+		}
+	}
+
+	delete(retval, "Labels")
+	if len(labels) > 0 {
+		retval["Labels"], _ = json.Marshal(labels)
+	}
+
+	return retval
+}
+
+// sameJSON returns true if the two json values are equal (a missing value is the same as null)
+func sameJSON(a, b json.RawMessage) bool {
+	var aValue, bValue interface{}
+	json.Unmarshal(a, &aValue)
+	json.Unmarshal(b, &bValue)
+
+	return reflect.DeepEqual(aValue, bValue)
+}
+
+// StartContainer starts the container
+func (client Client) StartContainer(id string) error {
+	return client.do("POST", "/containers/"+url.PathEscape(id)+"/start", nil, nil, nil)
+}
+
+// StopContainer stops the container
+func (client Client) StopContainer(id string) error {
+	return client.do("POST", "/containers/"+url.PathEscape(id)+"/stop", nil, nil, nil)
+}
+
+// RenameContainer renames the container
+func (client Client) RenameContainer(id, name string) error {
+	query := url.Values{}
+	query.Set("name", name)
+	return client.do("POST", "/containers/"+url.PathEscape(id)+"/rename", query, nil, nil)
+}
+
+// RemoveContainer removes the container (but not its image)
+func (client Client) RemoveContainer(id string) error {
+	return client.do("DELETE", "/containers/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// do sends a request to the docker engine api and decodes the response (if there's a target for it)
+func (client Client) do(method, apiPath string, query url.Values, body interface{}, target interface{}) error {
+	resp, err := client.request(method, apiPath, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if target == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// request sends a request to the docker engine api.  Responses that aren't ok are turned into errors
+func (client Client) request(method, apiPath string, query url.Values, body interface{}) (*http.Response, error) {
+	return client.requestWithHeaders(method, apiPath, query, body, nil)
+}
+
+// requestWithHeaders sends a request to the docker engine api with extra request headers
+func (client Client) requestWithHeaders(method, apiPath string, query url.Values, body interface{}, headers map[string]string) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+
+	requestUrl := "http://docker" + apiPath
+	if len(query) > 0 {
+		requestUrl += "?" + query.Encode()
+	}
+
+	clientRequest, err := http.NewRequest(method, requestUrl, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		clientRequest.Header.Set("Content-Type", "application/json")
+	}
+
+	for header, value := range headers {
+		clientRequest.Header.Set(header, value)
+	}
+
+	clientResponse, err := client.httpClient().Do(clientRequest)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"socket": client.socket(),
+		}).Error("problem sending the request to the docker engine api")
+		return nil, err
+	}
+
+	if clientResponse.StatusCode < 200 || clientResponse.StatusCode > 299 {
+		defer clientResponse.Body.Close()
+
+		message := struct {
+			Message string `json:"message"`
+		}{}
+		data, _ := ioutil.ReadAll(clientResponse.Body)
+		json.Unmarshal(data, &message)
+
+		if clientResponse.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, message.Message)
+		}
+
+		return nil, fmt.Errorf("unexpected response status from the docker engine api: %s: %s", clientResponse.Status, message.Message)
+	}
+
+	return clientResponse, nil
+}
+
+// httpClient gets an http client that connects to the docker socket
+func (client Client) httpClient() *http.Client {
+	socket := client.socket()
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dialer := net.Dialer{Timeout: 30 * time.Second}
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+// socket gets the path of the docker socket
+func (client Client) socket() string {
+	if client.Socket == "" {
+		return DefaultSocket
+	}
+
+	return client.Socket
+}
@@ -0,0 +1,142 @@
+package docker_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danesparza/appupgrade/docker"
+)
+
+// fakeEngine serves a docker engine api handler on a unix socket, and returns a client for it
+func fakeEngine(t *testing.T, handler http.HandlerFunc) docker.Client {
+	dir, err := ioutil.TempDir("", "docker-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets are not available: %s", err)
+	}
+
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return docker.Client{Socket: socket}
+}
+
+func TestCreateContainer_ImageSettings_AreNotCopied(t *testing.T) {
+
+	//	Arrange
+	created := map[string]interface{}{}
+	client := fakeEngine(t, func(rw http.ResponseWriter, req *http.Request) {
+		json.NewDecoder(req.Body).Decode(&created)
+		rw.WriteHeader(http.StatusCreated)
+		rw.Write([]byte(`{"Id": "new"}`))
+	})
+
+	from := docker.Container{
+		Config: map[string]json.RawMessage{
+			"Image":      json.RawMessage(`"apps/daydash:1.0.1"`),
+			"Hostname":   json.RawMessage(`"daydash"`),
+			"Env":        json.RawMessage(`["PATH=/usr/bin", "APP_VERSION=1.0.1", "LISTEN=:3000"]`),
+			"Cmd":        json.RawMessage(`["daydash", "start"]`),
+			"Entrypoint": json.RawMessage(`null`),
+			"Labels":     json.RawMessage(`{"org.opencontainers.image.version": "1.0.1", "owner": "kitchen", "tier": "custom"}`),
+		},
+	}
+
+	fromImage := docker.Image{
+		Config: map[string]json.RawMessage{
+			"Env":    json.RawMessage(`["PATH=/usr/bin", "APP_VERSION=1.0.1"]`),
+			"Cmd":    json.RawMessage(`["daydash", "start"]`),
+			"Labels": json.RawMessage(`{"org.opencontainers.image.version": "1.0.1", "tier": "image"}`),
+		},
+	}
+
+	//	Act
+	id, err := client.CreateContainer("daydash", "apps/daydash:1.0.2", from, fromImage)
+
+	//	Assert
+	if err != nil || id != "new" {
+		t.Fatalf("CreateContainer - Should create the container without error, but got: %s %v", id, err)
+	}
+
+	if created["Image"] != "apps/daydash:1.0.2" || created["Hostname"] != "daydash" {
+		t.Errorf("CreateContainer - Expected the new image and the container's own settings, but got: %v", created)
+	}
+
+	if env, _ := json.Marshal(created["Env"]); string(env) != `["LISTEN=:3000"]` {
+		t.Errorf("CreateContainer - Expected only the container's own environment, but got: %s", env)
+	}
+
+	if _, ok := created["Cmd"]; ok {
+		t.Errorf("CreateContainer - Expected the image's command to be left to the new image, but got: %v", created["Cmd"])
+	}
+
+	if labels, _ := json.Marshal(created["Labels"]); string(labels) != `{"owner":"kitchen","tier":"custom"}` {
+		t.Errorf("CreateContainer - Expected only the container's own labels, but got: %s", labels)
+	}
+}
+
+func TestPullImage_WithLogin_SendsRegistryAuth(t *testing.T) {
+
+	//	Arrange
+	authHeader := ""
+	client := fakeEngine(t, func(rw http.ResponseWriter, req *http.Request) {
+		authHeader = req.Header.Get("X-Registry-Auth")
+		rw.Write([]byte(`{"status": "Downloaded newer image"}`))
+	})
+
+	//	Act
+	err := client.PullImage("registry.example.com/apps/daydash", "1.0.2", docker.Auth{Username: "puller", Password: "secret"})
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("PullImage - Should pull without error, but got: %s", err)
+	}
+
+	data, err := base64.URLEncoding.DecodeString(authHeader)
+	if err != nil {
+		t.Fatalf("PullImage - Expected a base64 X-Registry-Auth header, but got: %q", authHeader)
+	}
+
+	auth := docker.Auth{}
+	json.Unmarshal(data, &auth)
+	if auth.Username != "puller" || auth.Password != "secret" || auth.ServerAddress != "registry.example.com" {
+		t.Errorf("PullImage - Expected the login for the image's registry, but got: %+v", auth)
+	}
+}
+
+func TestSplitImageReference_ReturnsRepositoryAndTag(t *testing.T) {
+
+	tests := []struct {
+		reference  string
+		repository string
+		tag        string
+	}{
+		{"daydash:1.0.2", "daydash", "1.0.2"},
+		{"registry.example.com:5000/apps/daydash:v1.0.2", "registry.example.com:5000/apps/daydash", "v1.0.2"},
+		{"registry.example.com:5000/apps/daydash", "registry.example.com:5000/apps/daydash", ""},
+		{"daydash:1.0.2@sha256:abcdef", "daydash", "1.0.2"},
+	}
+
+	for _, test := range tests {
+		//	Act
+		repository, tag := docker.SplitImageReference(test.reference)
+
+		//	Assert
+		if repository != test.repository || tag != test.tag {
+			t.Errorf("SplitImageReference(%s) - Expected %s and %s but got %s and %s", test.reference, test.repository, test.tag, repository, tag)
+		}
+	}
+}
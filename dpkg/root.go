@@ -1,13 +1,27 @@
 package dpkg
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"path"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
 
-// GetCurrentVersionForPackage returns the current installed version for a given package (or an error if it doesn't exist)
+// ErrNotInstalled is returned when a package isn't installed
+var ErrNotInstalled = errors.New("package is not installed")
+
+// GetCurrentVersionForPackage returns the current installed version for a given package.  ErrNotInstalled is
+// returned if the package isn't installed (or was removed, but its configuration files are still around)
 func GetCurrentVersionForPackage(packageName string) (string, error) {
 	retval := ""
 
@@ -15,18 +29,31 @@ func GetCurrentVersionForPackage(packageName string) (string, error) {
 		"package": packageName,
 	}).Debug("requested current version for package")
 
-	// Get the current installed version of the given unit
+	// Get the current installed version (and status) of the given unit
 	// From https://askubuntu.com/a/712202/379868
-	// dpkg-query --showformat='${Version}' --show python3-lxml
-	versionInfo, err := exec.Command("dpkg-query", "--showformat", "${Version}", "--show", packageName).CombinedOutput()
+	// dpkg-query --showformat='${Status}|${Version}' --show python3-lxml
+	versionInfo, err := exec.Command("dpkg-query", "--showformat", "${Status}|${Version}", "--show", packageName).CombinedOutput()
 
 	if err != nil {
+		if strings.Contains(string(versionInfo), "no packages found") {
+			return retval, fmt.Errorf("%w: %s", ErrNotInstalled, packageName)
+		}
+
 		log.WithError(err).Error("problem running dpkg-query command")
 		return retval, err
 	}
 
+	//	The status is 'want flag status' -- like 'install ok installed'
+	statusAndVersion := strings.SplitN(strings.TrimSpace(string(versionInfo)), "|", 2)
+	status := strings.Fields(statusAndVersion[0])
+	if len(status) == 3 && (status[2] == "not-installed" || status[2] == "config-files") {
+		return retval, fmt.Errorf("%w: %s", ErrNotInstalled, packageName)
+	}
+
 	//	Remove leading/trailing whitespace if it exists:
-	retval = strings.TrimSpace(string(versionInfo))
+	if len(statusAndVersion) == 2 {
+		retval = strings.TrimSpace(statusAndVersion[1])
+	}
 
 	log.WithFields(log.Fields{
 		"package":        packageName,
@@ -44,11 +71,13 @@ func RemovePackage(packageName string) (string, error) {
 		"package": packageName,
 	}).Debug("requested package remove")
 
-	cmdOutput, err := exec.Command("dpkg", "-r", packageName).CombinedOutput()
+	cmd := exec.Command("dpkg", "-r", packageName)
+	cmd.Env = noninteractiveEnv()
+	cmdOutput, err := cmd.CombinedOutput()
 
 	if err != nil {
 		log.WithError(err).Error("problem running dpkg remove")
-		return retval, err
+		return retval, CheckLockError(string(cmdOutput), err)
 	}
 
 	//	Remove leading/trailing whitespace if it exists:
@@ -62,19 +91,57 @@ func RemovePackage(packageName string) (string, error) {
 	return retval, nil
 }
 
+// PurgePackage removes the given package and its configuration files
+func PurgePackage(packageName string) (string, error) {
+	retval := ""
+
+	log.WithFields(log.Fields{
+		"package": packageName,
+	}).Debug("requested package purge")
+
+	cmd := exec.Command("dpkg", "--purge", packageName)
+	cmd.Env = noninteractiveEnv()
+	cmdOutput, err := cmd.CombinedOutput()
+
+	if err != nil {
+		log.WithError(err).Error("problem running dpkg purge")
+		return retval, CheckLockError(string(cmdOutput), err)
+	}
+
+	//	Remove leading/trailing whitespace if it exists:
+	retval = strings.TrimSpace(string(cmdOutput))
+
+	log.WithFields(log.Fields{
+		"package": packageName,
+		"output":  retval,
+	}).Debug("purged package")
+
+	return retval, nil
+}
+
 // InstallPackage installs the given deb file at the package path
 func InstallPackage(packagePath string) (string, error) {
+	return InstallPackageWithOptions(packagePath)
+}
+
+// InstallPackageWithOptions installs the given deb file at the package path, passing
+// the given options (like --force-confold) to dpkg
+func InstallPackageWithOptions(packagePath string, options ...string) (string, error) {
 	retval := ""
 
 	log.WithFields(log.Fields{
 		"package": packagePath,
+		"options": options,
 	}).Debug("requested package installation")
 
-	cmdOutput, err := exec.Command("dpkg", "-i", packagePath).CombinedOutput()
+	args := append([]string{"-i"}, options...)
+	cmd := exec.Command("dpkg", append(args, packagePath)...)
+	cmd.Env = noninteractiveEnv()
+	cmdOutput, err := cmd.CombinedOutput()
 
 	if err != nil {
 		log.WithError(err).Error("problem running dpkg install")
-		return retval, err
+		return retval, CheckLockError(string(cmdOutput), err)
 	}
 
 	//	Remove leading/trailing whitespace if it exists:
@@ -87,3 +154,237 @@ func InstallPackage(packagePath string) (string, error) {
 
 	return retval, nil
 }
+
+// DryRunInstall checks what installing the given deb file would do (with dpkg --dry-run), without changing anything
+func DryRunInstall(packagePath string, options ...string) (string, error) {
+	args := append([]string{"--dry-run", "-i"}, options...)
+	return dryRun(append(args, packagePath)...)
+}
+
+// DryRunRemove checks what removing (or purging) the given package would do (with dpkg --dry-run), without changing anything
+func DryRunRemove(packageName string, purge bool) (string, error) {
+	action := "-r"
+	if purge {
+		action = "--purge"
+	}
+
+	return dryRun("--dry-run", action, packageName)
+}
+
+// dryRun runs dpkg with the given (--dry-run) arguments and returns its trimmed output
+func dryRun(args ...string) (string, error) {
+	log.WithFields(log.Fields{
+		"args": args,
+	}).Debug("requested dpkg dry run")
+
+	cmd := exec.Command("dpkg", args...)
+	cmd.Env = noninteractiveEnv()
+	cmdOutput, err := cmd.CombinedOutput()
+
+	//	Remove leading/trailing whitespace if it exists:
+	retval := strings.TrimSpace(string(cmdOutput))
+
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"output": retval,
+		}).Debug("dpkg dry run failed")
+		return retval, err
+	}
+
+	return retval, nil
+}
+
+// SetDebconfSelections sets debconf answers with debconf-set-selections.  Each selection
+// is a line like: owner question type value
+func SetDebconfSelections(selections []string) (string, error) {
+	log.WithFields(log.Fields{
+		"selections": len(selections),
+	}).Debug("setting debconf selections")
+
+	cmd := exec.Command("debconf-set-selections")
+	cmd.Stdin = strings.NewReader(strings.Join(selections, "\n") + "\n")
+	cmdOutput, err := cmd.CombinedOutput()
+
+	//	Remove leading/trailing whitespace if it exists:
+	retval := strings.TrimSpace(string(cmdOutput))
+
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"output": retval,
+		}).Error("problem running debconf-set-selections")
+		return retval, err
+	}
+
+	return retval, nil
+}
+
+// noninteractiveEnv gets the environment for dpkg runs.  There's nobody to answer
+// debconf questions, so the noninteractive frontend is always used
+func noninteractiveEnv() []string {
+	return append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+}
+
+// GetConffiles gets the configuration files of an installed package, and the md5 checksum of the version
+// of each file the package shipped.  A package that isn't installed has no configuration files
+func GetConffiles(packageName string) (map[string]string, error) {
+	retval := map[string]string{}
+
+	cmdOutput, err := exec.Command("dpkg-query", "--showformat", "${Conffiles}", "--show", packageName).Output()
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"package": packageName,
+		}).Debug("no configuration files found for package")
+		return retval, nil
+	}
+
+	return ParseConffiles(string(cmdOutput)), nil
+}
+
+// ParseConffiles parses the Conffiles field of a package (one ' /path md5sum [obsolete]' line per file)
+func ParseConffiles(conffiles string) map[string]string {
+	retval := map[string]string{}
+
+	for _, line := range strings.Split(conffiles, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		//	Obsolete files aren't part of the package any more
+		if len(fields) > 2 && fields[2] == "obsolete" {
+			continue
+		}
+
+		retval[fields[0]] = fields[1]
+	}
+
+	return retval
+}
+
+// GetPackageFileConffiles gets the configuration files in a .deb file, and the md5 checksum of each one
+func GetPackageFileConffiles(packagePath string) (map[string]string, error) {
+	retval := map[string]string{}
+
+	//	The conffiles control file lists them.  Packages without configuration files don't have one
+	list, err := exec.Command("dpkg-deb", "--info", packagePath, "conffiles").Output()
+	if err != nil {
+		return retval, nil
+	}
+
+	wanted := map[string]bool{}
+	for _, line := range strings.Split(string(list), "\n") {
+		//	Lines can have flags before the path (like 'remove-on-upgrade /etc/foo')
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			wanted[fields[len(fields)-1]] = true
+		}
+	}
+
+	//	Checksum each configuration file in the package contents
+	cmd := exec.Command("dpkg-deb", "--fsys-tarfile", packagePath)
+	contents, err := cmd.StdoutPipe()
+	if err != nil {
+		return retval, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"packagePath": packagePath,
+		}).Error("problem running dpkg-deb to read the package contents")
+		return retval, err
+	}
+
+	tarReader := tar.NewReader(contents)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cmd.Wait()
+			return retval, err
+		}
+
+		name := path.Clean("/" + header.Name)
+		if header.Typeflag != tar.TypeReg || !wanted[name] {
+			continue
+		}
+
+		hash := md5.New()
+		if _, err := io.Copy(hash, tarReader); err != nil {
+			cmd.Wait()
+			return retval, err
+		}
+
+		retval[name] = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	return retval, cmd.Wait()
+}
+
+// GetPackageFileInfo gets the control fields (Package, Version, Architecture, etc) from a .deb file
+func GetPackageFileInfo(packagePath string) (map[string]string, error) {
+	retval := map[string]string{}
+
+	cmdOutput, err := exec.Command("dpkg-deb", "--field", packagePath).Output()
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"packagePath": packagePath,
+		}).Error("problem running dpkg-deb to read the package control fields")
+		return retval, err
+	}
+
+	stanzas, err := ParseControl(bytes.NewReader(cmdOutput))
+	if err != nil {
+		return retval, err
+	}
+
+	if len(stanzas) > 0 {
+		retval = stanzas[0]
+	}
+
+	return retval, nil
+}
+
+// ParseControl parses debian control data (a control file, a Packages index or a Release file)
+// into a list of stanzas.  Field names are kept as-is.  Continuation lines are joined with newlines
+func ParseControl(r io.Reader) ([]map[string]string, error) {
+	retval := []map[string]string{}
+	current := map[string]string{}
+	lastField := ""
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			//	A blank line ends the stanza
+			if len(current) > 0 {
+				retval = append(retval, current)
+				current = map[string]string{}
+			}
+			lastField = ""
+		case strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t"):
+			//	A continuation of the last field
+			if lastField != "" {
+				current[lastField] = current[lastField] + "\n" + strings.TrimSpace(line)
+			}
+		default:
+			idx := strings.Index(line, ":")
+			if idx < 0 {
+				continue
+			}
+			lastField = strings.TrimSpace(line[:idx])
+			current[lastField] = strings.TrimSpace(line[idx+1:])
+		}
+	}
+
+	if len(current) > 0 {
+		retval = append(retval, current)
+	}
+
+	return retval, scanner.Err()
+}
@@ -0,0 +1,240 @@
+package dpkg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrBusy is returned when another process (apt, unattended-upgrades or an operator) holds the dpkg lock
+var ErrBusy = errors.New("package manager busy")
+
+// LockPollInterval is how often WaitForLock checks the lock
+var LockPollInterval = time.Second
+
+// lockErrorMessages are what dpkg and apt-get fail with when another process holds the lock
+var lockErrorMessages = []string{
+	"dpkg frontend lock",
+	"dpkg status database is locked",
+	"Could not get lock",
+}
+
+// LockFiles are the lock files dpkg (and apt) take while they change packages
+var LockFiles = []string{
+	"/var/lib/dpkg/lock-frontend",
+	"/var/lib/dpkg/lock",
+}
+
+// unconfiguredStates are the package states that mean an install or remove didn't finish
+var unconfiguredStates = map[string]bool{
+	"half-installed":  true,
+	"unpacked":        true,
+	"half-configured": true,
+}
+
+// IsLocked returns true if another process holds one of the dpkg lock files (apt, unattended-upgrades or an operator, for example)
+func IsLocked() (bool, error) {
+	for _, lockFile := range LockFiles {
+		locked, err := isFileLocked(lockFile)
+		if err != nil {
+			return false, err
+		}
+
+		if locked {
+			log.WithFields(log.Fields{
+				"lockFile": lockFile,
+			}).Debug("dpkg lock is held")
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// WaitForLock waits until no other process holds the dpkg lock.  If it has to wait, waiting is called
+// (once) first.  ErrBusy is returned if the lock is still held when the timeout runs out
+func WaitForLock(timeout time.Duration, waiting func()) error {
+	deadline := time.Now().Add(timeout)
+	waited := false
+
+	for {
+		locked, err := IsLocked()
+		if err != nil {
+			return err
+		}
+
+		if !locked {
+			if waited {
+				log.Info("dpkg lock was released")
+			}
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: the dpkg lock is still held after waiting %s", ErrBusy, timeout)
+		}
+
+		if !waited {
+			log.WithFields(log.Fields{
+				"timeout": timeout,
+			}).Info("waiting for another process to release the dpkg lock")
+
+			if waiting != nil {
+				waiting()
+			}
+			waited = true
+		}
+
+		time.Sleep(LockPollInterval)
+	}
+}
+
+// CheckLockError turns the error from a dpkg or apt-get run into ErrBusy if the output
+// says it failed because another process holds the lock
+func CheckLockError(output string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	for _, message := range lockErrorMessages {
+		if strings.Contains(output, message) {
+			return fmt.Errorf("%w: %s", ErrBusy, strings.TrimSpace(output))
+		}
+	}
+
+	return err
+}
+
+// isFileLocked checks if another process holds a write lock on the file.  dpkg uses fcntl locks,
+// so the lock is tested with F_GETLK (without taking it).  A missing lock file isn't locked
+func isFileLocked(lockFile string) (bool, error) {
+	f, err := os.Open(lockFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	lock := syscall.Flock_t{Type: syscall.F_WRLCK}
+	if err := syscall.FcntlFlock(f.Fd(), syscall.F_GETLK, &lock); err != nil {
+		return false, err
+	}
+
+	return lock.Type != syscall.F_UNLCK, nil
+}
+
+// Audit runs dpkg --audit, which reports packages that are broken or only partly installed.
+// It returns the report (which is blank if everything is fine)
+func Audit() (string, error) {
+	cmdOutput, err := exec.Command("dpkg", "--audit").CombinedOutput()
+
+	//	Remove leading/trailing whitespace if it exists:
+	retval := strings.TrimSpace(string(cmdOutput))
+
+	if err != nil {
+		//	Newer versions of dpkg exit with an error when the audit finds something
+		if _, exited := err.(*exec.ExitError); exited && retval != "" {
+			return retval, nil
+		}
+
+		log.WithError(err).Error("problem running dpkg audit")
+		return retval, err
+	}
+
+	return retval, nil
+}
+
+// ConfigurePending finishes configuring every package that was unpacked but not configured (dpkg --configure -a)
+func ConfigurePending() (string, error) {
+	log.Debug("requested configure of pending packages")
+
+	cmd := exec.Command("dpkg", "--configure", "-a")
+	cmd.Env = noninteractiveEnv()
+	cmdOutput, err := cmd.CombinedOutput()
+
+	//	Remove leading/trailing whitespace if it exists:
+	retval := strings.TrimSpace(string(cmdOutput))
+
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"output": retval,
+		}).Error("problem running dpkg configure")
+		return retval, CheckLockError(retval, err)
+	}
+
+	return retval, nil
+}
+
+// verifyFlags matches the flags dpkg --verify prints for each file that doesn't match (in rpm -V format)
+var verifyFlags = regexp.MustCompile(`^[.?A-Za-z0-9]{9}$`)
+
+// VerifyPackage checks the installed files of a package against the checksums dpkg recorded (with dpkg --verify).
+// It returns the files that don't match.  Configuration files are left out, since they're expected to be edited
+func VerifyPackage(packageName string) ([]string, error) {
+	retval := []string{}
+
+	cmdOutput, err := exec.Command("dpkg", "--verify", packageName).CombinedOutput()
+	if err != nil {
+		//	dpkg exits with an error when files don't match.  Anything else is a problem running it
+		if _, exited := err.(*exec.ExitError); !exited || len(strings.TrimSpace(string(cmdOutput))) == 0 {
+			log.WithError(err).WithFields(log.Fields{
+				"package": packageName,
+				"output":  strings.TrimSpace(string(cmdOutput)),
+			}).Error("problem running dpkg verify")
+			return retval, err
+		}
+	}
+
+	//	Each line is 'flags [attribute] path', like '??5??????   /usr/bin/daydash' or '??5?????? c /etc/daydash.conf'.
+	//	Deleted files have 'missing' in place of the flags, like 'missing     /usr/bin/daydash'
+	for _, line := range strings.Split(string(cmdOutput), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || (fields[0] != "missing" && !verifyFlags.MatchString(fields[0])) {
+			continue
+		}
+
+		if len(fields) == 3 && fields[1] == "c" {
+			continue
+		}
+
+		retval = append(retval, fields[len(fields)-1])
+	}
+
+	return retval, nil
+}
+
+// GetUnconfiguredPackages gets the packages that were left half installed, unpacked or half configured,
+// and the state of each one.  These need dpkg --configure -a (or a reinstall) before anything else is installed
+func GetUnconfiguredPackages() (map[string]string, error) {
+	retval := map[string]string{}
+
+	cmdOutput, err := exec.Command("dpkg-query", "--showformat", "${Package}|${Status}\n", "--show").Output()
+	if err != nil {
+		log.WithError(err).Error("problem running dpkg-query to list package states")
+		return retval, err
+	}
+
+	for _, line := range strings.Split(string(cmdOutput), "\n") {
+		packageAndStatus := strings.SplitN(strings.TrimSpace(line), "|", 2)
+		if len(packageAndStatus) != 2 {
+			continue
+		}
+
+		//	The status is 'want flag status' -- like 'install ok half-configured'
+		status := strings.Fields(packageAndStatus[1])
+		if len(status) == 3 && unconfiguredStates[status[2]] {
+			retval[packageAndStatus[0]] = status[2]
+		}
+	}
+
+	return retval, nil
+}
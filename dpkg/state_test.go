@@ -0,0 +1,111 @@
+package dpkg_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appupgrade/dpkg"
+)
+
+// TestHelperProcess_HoldLock isn't a real test.  It's run as a separate process by holdLock, since an fcntl
+// lock held by this process doesn't show up as held to F_GETLK in this process
+func TestHelperProcess_HoldLock(t *testing.T) {
+	lockFile := os.Getenv("APPUPGRADE_HOLD_LOCK")
+	if lockFile == "" {
+		return
+	}
+
+	f, err := os.OpenFile(lockFile, os.O_RDWR, 0644)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	lock := syscall.Flock_t{Type: syscall.F_WRLCK}
+	if err := syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lock); err != nil {
+		os.Exit(1)
+	}
+
+	//	Hold the lock until stdin is closed
+	fmt.Println("locked")
+	io.Copy(ioutil.Discard, os.Stdin)
+	os.Exit(0)
+}
+
+// holdLock takes an fcntl write lock on the file in another process (the way dpkg does).  Call the returned func to release it
+func holdLock(t *testing.T, lockFile string) func() {
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess_HoldLock")
+	cmd.Env = append(os.Environ(), "APPUPGRADE_HOLD_LOCK="+lockFile)
+
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("holdLock - Should start the lock holder without error, but got: %s", err)
+	}
+
+	if line, _ := bufio.NewReader(stdout).ReadString('\n'); line != "locked\n" {
+		stdin.Close()
+		cmd.Wait()
+		t.Skip("fcntl locks are not available")
+	}
+
+	return func() {
+		stdin.Close()
+		cmd.Wait()
+	}
+}
+
+func TestWaitForLock_LockHeldByAnotherProcess_ReturnsBusy(t *testing.T) {
+
+	//	Arrange
+	dir, err := ioutil.TempDir("", "appupgrade-dpkg-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	lockFile := filepath.Join(dir, "lock-frontend")
+	ioutil.WriteFile(lockFile, []byte{}, 0644)
+
+	oldLockFiles, oldInterval := dpkg.LockFiles, dpkg.LockPollInterval
+	dpkg.LockFiles = []string{filepath.Join(dir, "missing-lock"), lockFile}
+	dpkg.LockPollInterval = 10 * time.Millisecond
+	defer func() { dpkg.LockFiles, dpkg.LockPollInterval = oldLockFiles, oldInterval }()
+
+	//	Act
+	lockedBefore, beforeErr := dpkg.IsLocked()
+
+	release := holdLock(t, lockFile)
+	lockedWhileHeld, heldErr := dpkg.IsLocked()
+	waitingCalls := 0
+	busyErr := dpkg.WaitForLock(50*time.Millisecond, func() { waitingCalls++ })
+	release()
+
+	lockedAfter, afterErr := dpkg.IsLocked()
+	freeErr := dpkg.WaitForLock(50*time.Millisecond, nil)
+
+	//	Assert
+	if beforeErr != nil || lockedBefore {
+		t.Errorf("IsLocked - Expected the lock to be free before it's taken, but got: %v (%v)", lockedBefore, beforeErr)
+	}
+
+	if heldErr != nil || !lockedWhileHeld {
+		t.Errorf("IsLocked - Expected the lock to be held by the other process, but got: %v (%v)", lockedWhileHeld, heldErr)
+	}
+
+	if !errors.Is(busyErr, dpkg.ErrBusy) || waitingCalls != 1 {
+		t.Errorf("WaitForLock - Expected ErrBusy after waiting (and waiting to be called once), but got: %v (%d calls)", busyErr, waitingCalls)
+	}
+
+	if afterErr != nil || lockedAfter || freeErr != nil {
+		t.Errorf("WaitForLock - Expected the lock to be free once it's released, but got: %v %v %v", lockedAfter, afterErr, freeErr)
+	}
+}
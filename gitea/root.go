@@ -0,0 +1,187 @@
+package gitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/system"
+	log "github.com/sirupsen/logrus"
+)
+
+// APIReleaseResponse is the response from the gitea (and forgejo) repo releases api
+type APIReleaseResponse []struct {
+	ID          int       `json:"id"`
+	TagName     string    `json:"tag_name"`
+	Name        string    `json:"name"`
+	Body        string    `json:"body"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+	CreatedAt   time.Time `json:"created_at"`
+	PublishedAt time.Time `json:"published_at"`
+	Assets      []struct {
+		ID                 int       `json:"id"`
+		Name               string    `json:"name"`
+		Size               int       `json:"size"`
+		DownloadCount      int       `json:"download_count"`
+		CreatedAt          time.Time `json:"created_at"`
+		UUID               string    `json:"uuid"`
+		BrowserDownloadURL string    `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// Repo describes a repository on a gitea or forgejo instance
+type Repo struct {
+	BaseURL string // The base url of the instance (https://gitea.example.com or https://example.com/gitea)
+	Owner   string // The owner (user or organization) of the repository
+	Name    string // The name of the repository
+}
+
+// IsGiteaURL returns true if the url looks like it points to a repo on a gitea or forgejo instance
+func IsGiteaURL(repoUrl string) bool {
+	parsed, err := url.Parse(repoUrl)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	return host == "codeberg.org" || strings.HasPrefix(host, "gitea.") || strings.HasPrefix(host, "forgejo.")
+}
+
+// ParseRepoURL gets the repo information from a repo url.  If baseUrl is blank,
+// the instance is assumed to be at the root of the url's host
+func ParseRepoURL(repoUrl, baseUrl string) (Repo, error) {
+	retval := Repo{}
+
+	parsed, err := url.Parse(repoUrl)
+	if err != nil {
+		return retval, err
+	}
+
+	if parsed.Host == "" {
+		return retval, fmt.Errorf("not a valid gitea repo url: %s", repoUrl)
+	}
+
+	//	Figure out the base url and the repo path relative to it
+	retval.BaseURL = fmt.Sprintf("%s://%s", parsed.Scheme, parsed.Host)
+	repoPath := parsed.Path
+
+	if baseUrl != "" {
+		retval.BaseURL = strings.TrimSuffix(baseUrl, "/")
+
+		if parsedBase, err := url.Parse(retval.BaseURL); err == nil {
+			repoPath = strings.TrimPrefix(repoPath, parsedBase.Path)
+		}
+	}
+
+	//	The owner and repo are the first two parts of the path
+	parts := strings.Split(strings.Trim(repoPath, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return retval, fmt.Errorf("not a valid gitea repo url: %s", repoUrl)
+	}
+
+	retval.Owner = parts[0]
+	retval.Name = strings.TrimSuffix(parts[1], ".git")
+
+	return retval, nil
+}
+
+// GetVersionsForRepo gets the available releases (with package file attachments) for the given repo.
+// The token may be blank for public repos
+func GetVersionsForRepo(repo Repo, token string) ([]github.Release, error) {
+	retval := []github.Release{}
+	releaseResponse := APIReleaseResponse{}
+
+	//	Format our url:
+	apiUrl := fmt.Sprintf("%s/api/v1/repos/%s/%s/releases?limit=50", repo.BaseURL, url.PathEscape(repo.Owner), url.PathEscape(repo.Name))
+
+	//	Create a request with headers
+	clientRequest, err := http.NewRequest("GET", apiUrl, nil)
+	if err != nil {
+		log.WithError(err).Error("problem preparing the request to the gitea api")
+		return retval, err
+	}
+
+	//	Set our headers
+	clientRequest.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	for name, value := range AuthHeaders(token) {
+		clientRequest.Header.Set(name, value)
+	}
+
+	//	Execute the request
+	client := &http.Client{}
+	clientResponse, err := client.Do(clientRequest)
+	if err != nil {
+		log.WithError(err).Error("problem sending the request to the gitea api")
+		return retval, err
+	}
+	defer clientResponse.Body.Close()
+
+	if clientResponse.StatusCode < 200 || clientResponse.StatusCode > 299 {
+		err = fmt.Errorf("unexpected response status: %s", clientResponse.Status)
+		log.WithError(err).WithFields(log.Fields{
+			"url": apiUrl,
+		}).Error("problem with the response from the gitea api")
+		return retval, err
+	}
+
+	//	Decode the response:
+	err = json.NewDecoder(clientResponse.Body).Decode(&releaseResponse)
+	if err != nil {
+		log.WithError(err).Error("problem decoding the response from the gitea api")
+		return retval, err
+	}
+
+	//	Loop through each release
+	for _, item := range releaseResponse {
+		if item.Draft {
+			continue
+		}
+
+		//	Analyze the attachments.  If we have a package file (.deb, .rpm, tarball or binary), track it
+		for _, asset := range item.Assets {
+			if !system.IsPackageFile(asset.Name) {
+				continue
+			}
+
+			newRelease := github.Release{
+				Version:      item.TagName,
+				Name:         asset.Name,
+				DownloadUrl:  asset.BrowserDownloadURL,
+				Created:      asset.CreatedAt,
+				ReleaseNotes: item.Body,
+			}
+
+			retval = append(retval, newRelease)
+		}
+	}
+
+	return retval, nil
+}
+
+// AuthHeaders gets the request headers used to authenticate with gitea using the given token
+func AuthHeaders(token string) map[string]string {
+	retval := make(map[string]string)
+
+	if token != "" {
+		retval["Authorization"] = "token " + token
+	}
+
+	return retval
+}
+
+// DownloadFile downloads a release attachment for the given repo to a temporary location and returns the
+// temporary location.  The token is only sent if the attachment is hosted on the instance itself
+func DownloadFile(repo Repo, token, remoteUrl string) (string, error) {
+	headers := map[string]string{}
+
+	if strings.HasPrefix(remoteUrl, repo.BaseURL+"/") {
+		headers = AuthHeaders(token)
+	}
+
+	return github.DownloadFileWithHeaders(remoteUrl, headers)
+}
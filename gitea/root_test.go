@@ -0,0 +1,78 @@
+package gitea_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danesparza/appupgrade/gitea"
+)
+
+func TestGitea_ParseRepoURL_PathPrefix_Successful(t *testing.T) {
+
+	//	Arrange
+	repoUrl := "https://lab.example.com/git/devices/daydash.git"
+	baseUrl := "https://lab.example.com/git"
+
+	//	Act
+	repo, err := gitea.ParseRepoURL(repoUrl, baseUrl)
+
+	//	Assert
+	if err != nil {
+		t.Errorf("ParseRepoURL - Should parse without error, but got: %s", err)
+	}
+
+	if repo.BaseURL != baseUrl || repo.Owner != "devices" || repo.Name != "daydash" {
+		t.Errorf("ParseRepoURL failed: Unexpected repo: %+v", repo)
+	}
+}
+
+func TestGitea_GetVersionsForRepo_WithToken_Successful(t *testing.T) {
+
+	//	Arrange
+	token := "testtoken"
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "token "+token {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if req.URL.Path != "/git/api/v1/repos/devices/daydash/releases" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprint(rw, `[
+			{"tag_name": "v1.0.3", "draft": true, "assets": [{"name": "daydash_1.0.3_armhf.deb", "browser_download_url": "http://example.com/a.deb"}]},
+			{"tag_name": "v1.0.2", "body": "Release notes", "assets": [
+				{"name": "daydash_1.0.2_armhf.deb", "browser_download_url": "http://example.com/b.deb"},
+				{"name": "daydash_1.0.2.tar.gz", "browser_download_url": "http://example.com/b.tar.gz"}
+			]}
+		]`)
+	}))
+	defer server.Close()
+
+	repo, _ := gitea.ParseRepoURL(server.URL+"/git/devices/daydash", server.URL+"/git")
+
+	//	Act
+	releases, err := gitea.GetVersionsForRepo(repo, token)
+
+	//	Assert
+	if err != nil {
+		t.Errorf("GetVersionsForRepo - Should get versions without error, but got: %s", err)
+	}
+
+	//	The tarball is listed too: the package manager decides which of the assets it can install
+	if len(releases) != 2 {
+		t.Fatalf("GetVersionsForRepo failed: Should skip drafts and list each package attachment, but got %d releases", len(releases))
+	}
+
+	if releases[0].Version != "v1.0.2" || releases[0].DownloadUrl != "http://example.com/b.deb" {
+		t.Errorf("GetVersionsForRepo failed: Unexpected release: %+v", releases[0])
+	}
+
+	if releases[1].Version != "v1.0.2" || releases[1].DownloadUrl != "http://example.com/b.tar.gz" {
+		t.Errorf("GetVersionsForRepo failed: Unexpected release: %+v", releases[1])
+	}
+}
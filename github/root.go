@@ -1,14 +1,23 @@
 package github
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/danesparza/appupgrade/system"
+	"github.com/hashicorp/go-version"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -85,20 +94,31 @@ type APIReleaseResponse []struct {
 	Body       string `json:"body"`
 }
 
+// ErrRateLimited is returned when the github api refuses a request because of rate limiting
+var ErrRateLimited = errors.New("rate limited by the github api")
+
 type Release struct {
-	Version     string    `json:"version"`
-	Name        string    `json:"name"`
-	DownloadUrl string    `json:"downloadUrl"`
-	Created     time.Time `json:"createdDate"`
+	Version      string    `json:"version"`
+	Name         string    `json:"name"`
+	DownloadUrl  string    `json:"downloadUrl"`
+	Created      time.Time `json:"createdDate"`
+	Checksum     string    `json:"checksum,omitempty"`     // The expected sha256 checksum of the download (if known)
+	ReleaseNotes string    `json:"releaseNotes,omitempty"` // The release notes for the release (if known)
 }
 
 // GetVersionsForRepo gets the latest available assets for the given github repo (and all other versions?)
 func GetVersionsForRepo(name, repo string) ([]Release, error) {
+	return GetVersionsForRepoOnServer(DefaultServer, name, repo)
+}
+
+// GetVersionsForRepoOnServer gets the latest available assets for the given repo on
+// the given github server (github.com or a github enterprise server)
+func GetVersionsForRepoOnServer(server Server, name, repo string) ([]Release, error) {
 	retval := []Release{}
 	releaseResponse := APIReleaseResponse{}
 
 	//	Format our url:
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases", name, repo)
+	url := fmt.Sprintf("%s/repos/%s/%s/releases", server.apiURL(), name, repo)
 
 	//	Create a request with headers
 	clientRequest, err := http.NewRequest("GET", url, nil)
@@ -109,6 +129,9 @@ func GetVersionsForRepo(name, repo string) ([]Release, error) {
 
 	//	Set our headers
 	clientRequest.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	if server.Token != "" {
+		clientRequest.Header.Set("Authorization", "token "+server.Token)
+	}
 
 	//	Execute the request
 	client := &http.Client{}
@@ -119,30 +142,40 @@ func GetVersionsForRepo(name, repo string) ([]Release, error) {
 	}
 	defer clientResponse.Body.Close()
 
+	//	Make sure we got a good response
+	err = checkResponse(clientResponse)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"url": url,
+		}).Error("problem with the response from the github api")
+		return retval, err
+	}
+
 	//	Decode the response:
 	err = json.NewDecoder(clientResponse.Body).Decode(&releaseResponse)
 	if err != nil {
 		log.WithError(err).Error("problem decoding the response from the github api")
-		return retval, nil
+		return retval, err
 	}
 
 	//	Loop through each release
 	for _, item := range releaseResponse {
 
-		//	Analyze the assets.  If we have a .deb file, track it
-		//	Don't append to the results if we don't have a .deb file
+		//	Analyze the assets.  If we have a package file (.deb, .rpm, tarball or binary), track it
+		//	Don't append to the results if we don't have a package file
 		for _, asset := range item.Assets {
-			if strings.HasSuffix(asset.Name, ".deb") {
+			if system.IsPackageFile(asset.Name) {
 
 				//	Create a new release object with the release version and create date
 				newRelease := Release{
-					Version: item.TagName,
-					Created: asset.CreatedAt,
+					Version:      item.TagName,
+					Created:      asset.CreatedAt,
+					ReleaseNotes: item.Body,
 				}
 
 				//	Set the name and the url information
 				newRelease.Name = asset.Name
-				newRelease.DownloadUrl = asset.BrowserDownloadURL
+				newRelease.DownloadUrl = server.downloadURL(asset.BrowserDownloadURL)
 
 				//	Add this release to the list
 				retval = append(retval, newRelease)
@@ -153,35 +186,130 @@ func GetVersionsForRepo(name, repo string) ([]Release, error) {
 	return retval, nil
 }
 
+// SortNewestFirst sorts releases by version, newest first.  Releases
+// with versions that can't be parsed are sorted to the end
+func SortNewestFirst(releases []Release) {
+	sort.SliceStable(releases, func(i, j int) bool {
+		vi, erri := version.NewVersion(releases[i].Version)
+		vj, errj := version.NewVersion(releases[j].Version)
+
+		switch {
+		case erri != nil:
+			return false
+		case errj != nil:
+			return true
+		}
+
+		return vi.GreaterThan(vj)
+	})
+}
+
 // DownloadFile downloads a remote file to a temporary location and returns the temporary location
 func DownloadFile(remoteUrl string) (string, error) {
+	return DownloadFileWithHeaders(remoteUrl, nil)
+}
+
+// DownloadFileWithHeaders downloads a remote file to a temporary location using the given
+// request headers (for authentication, for example) and returns the temporary location
+func DownloadFileWithHeaders(remoteUrl string, headers map[string]string) (string, error) {
 
 	//	Get a temporary file reference:
-	tempPathLocation, err := ioutil.TempFile("", "*.deb")
+	tempPathLocation, err := ioutil.TempFile("", "*"+path.Ext(remoteFileName(remoteUrl)))
 	if err != nil {
 		log.WithError(err).Error("problem creating temp file")
 		return "", err
 	}
+	defer tempPathLocation.Close()
+
+	//	Create a request with headers
+	clientRequest, err := http.NewRequest("GET", remoteUrl, nil)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"remoteUrl": remoteUrl,
+		}).Error("problem preparing the download request")
+		os.Remove(tempPathLocation.Name())
+		return "", err
+	}
+
+	for name, value := range headers {
+		clientRequest.Header.Set(name, value)
+	}
 
 	//	Download the remote url to the temp file:
-	resp, err := http.Get(remoteUrl)
+	resp, err := http.DefaultClient.Do(clientRequest)
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{
 			"remoteUrl": remoteUrl,
 		}).Error("problem downloading remote file")
+		os.Remove(tempPathLocation.Name())
 		return "", err
 	}
 	defer resp.Body.Close()
 
+	//	Make sure we got a good response
+	err = checkResponse(resp)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"remoteUrl": remoteUrl,
+		}).Error("problem downloading remote file")
+		os.Remove(tempPathLocation.Name())
+		return "", err
+	}
+
 	//	Save the downloaded file to the temp file:
 	_, err = io.Copy(tempPathLocation, resp.Body)
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{
 			"remoteUrl": remoteUrl,
 		}).Error("problem saving remote file")
+		os.Remove(tempPathLocation.Name())
 		return "", err
 	}
 
 	//	Return the local file path that contains the remote url contents
 	return tempPathLocation.Name(), nil
 }
+
+// VerifyChecksum checks that the sha256 checksum of the file at the given path matches the expected checksum
+func VerifyChecksum(filePath, checksum string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(actual, strings.TrimSpace(checksum)) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s but got %s", filePath, checksum, actual)
+	}
+
+	return nil
+}
+
+// remoteFileName gets the file name from a remote url (without any query string)
+func remoteFileName(remoteUrl string) string {
+	if parsed, err := url.Parse(remoteUrl); err == nil {
+		return path.Base(parsed.Path)
+	}
+
+	return path.Base(remoteUrl)
+}
+
+// checkResponse returns an error if the response isn't successful.  Rate limit responses return ErrRateLimited
+func checkResponse(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0":
+		return ErrRateLimited
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	return nil
+}
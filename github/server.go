@@ -0,0 +1,111 @@
+package github
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/alexfacciorusso/ghurlparse"
+)
+
+// Server describes the github server to talk to: either github.com or a github enterprise server
+type Server struct {
+	APIURL      string // The base url of the api (https://api.github.com or https://github.example.com/api/v3)
+	DownloadURL string // If set, replaces the scheme and host of release asset download urls
+	Token       string // The access token to use with the api (if needed)
+}
+
+// DefaultServer is github.com
+var DefaultServer = Server{
+	APIURL: "https://api.github.com",
+}
+
+// apiURL gets the base url of the api, without a trailing slash
+func (server Server) apiURL() string {
+	if server.APIURL == "" {
+		return DefaultServer.APIURL
+	}
+
+	return strings.TrimSuffix(server.APIURL, "/")
+}
+
+// Host gets the web host for the server (github.com, or the host of a github enterprise server)
+func (server Server) Host() string {
+	parsed, err := url.Parse(server.apiURL())
+	if err != nil {
+		return ""
+	}
+
+	host := strings.ToLower(parsed.Host)
+	if host == "api.github.com" {
+		return "github.com"
+	}
+
+	return host
+}
+
+// IsGitHubComURL returns true if the url is a repo url on github.com
+func IsGitHubComURL(repoUrl string) bool {
+	valid, _, _ := ghurlparse.DestructureRepoURL(repoUrl)
+	return valid
+}
+
+// ParseRepoURL gets the owner and repo name from a repo url on this server.
+// Urls on github.com are always recognized
+func (server Server) ParseRepoURL(repoUrl string) (valid bool, owner string, repo string) {
+	if valid, owner, repo = ghurlparse.DestructureRepoURL(repoUrl); valid {
+		return valid, owner, repo
+	}
+
+	host := server.Host()
+	if host == "" || host == "github.com" {
+		return false, "", ""
+	}
+
+	//	Github enterprise urls look like https://host/owner/repo or git@host:owner/repo.git
+	repoPath := ""
+	if strings.HasPrefix(repoUrl, "git@"+host+":") {
+		repoPath = strings.TrimPrefix(repoUrl, "git@"+host+":")
+	} else if parsed, err := url.Parse(repoUrl); err == nil && strings.EqualFold(parsed.Host, host) {
+		repoPath = parsed.Path
+	}
+
+	parts := strings.Split(strings.Trim(repoPath, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return false, "", ""
+	}
+
+	return true, parts[0], strings.TrimSuffix(parts[1], ".git")
+}
+
+// downloadURL rewrites an asset download url to use the configured download host (if one is set)
+func (server Server) downloadURL(assetUrl string) string {
+	if server.DownloadURL == "" {
+		return assetUrl
+	}
+
+	parsedAsset, err := url.Parse(assetUrl)
+	if err != nil {
+		return assetUrl
+	}
+
+	parsedDownload, err := url.Parse(server.DownloadURL)
+	if err != nil {
+		return assetUrl
+	}
+
+	parsedAsset.Scheme = parsedDownload.Scheme
+	parsedAsset.Host = parsedDownload.Host
+
+	return parsedAsset.String()
+}
+
+// DownloadFile downloads a release asset from this server to a temporary location and returns the
+// temporary location.  The access token is sent (if there is one), so assets of private repos can be downloaded
+func (server Server) DownloadFile(remoteUrl string) (string, error) {
+	headers := map[string]string{}
+	if server.Token != "" {
+		headers["Authorization"] = "token " + server.Token
+	}
+
+	return DownloadFileWithHeaders(remoteUrl, headers)
+}
@@ -0,0 +1,142 @@
+package github_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danesparza/appupgrade/github"
+)
+
+func TestGithub_ParseRepoURL_EnterpriseHost_Successful(t *testing.T) {
+
+	//	Arrange
+	server := github.Server{APIURL: "https://ghe.example.com/api/v3"}
+
+	//	Act
+	valid, owner, repo := server.ParseRepoURL("https://ghe.example.com/devices/daydash.git")
+
+	//	Assert
+	if !valid || owner != "devices" || repo != "daydash" {
+		t.Errorf("ParseRepoURL failed: Expected devices/daydash but got valid=%v %s/%s", valid, owner, repo)
+	}
+
+	if valid, _, _ := server.ParseRepoURL("https://other.example.com/devices/daydash"); valid {
+		t.Errorf("ParseRepoURL failed: Should not recognize a url on another host")
+	}
+
+	if valid, _, _ := server.ParseRepoURL("https://github.com/danesparza/daydash"); !valid {
+		t.Errorf("ParseRepoURL failed: Should always recognize github.com urls")
+	}
+}
+
+func TestGithub_GetVersionsForRepoOnServer_Enterprise_Successful(t *testing.T) {
+
+	//	Arrange
+	apiServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v3/repos/devices/daydash/releases" || req.Header.Get("Authorization") != "token testtoken" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprint(rw, `[{"tag_name": "v1.0.2", "assets": [{"name": "daydash_1.0.2_armhf.deb", "browser_download_url": "https://ghe.example.com/devices/daydash/releases/download/v1.0.2/daydash_1.0.2_armhf.deb"}]}]`)
+	}))
+	defer apiServer.Close()
+
+	server := github.Server{
+		APIURL:      apiServer.URL + "/api/v3",
+		DownloadURL: "https://media.ghe.example.com",
+		Token:       "testtoken",
+	}
+
+	//	Act
+	releases, err := github.GetVersionsForRepoOnServer(server, "devices", "daydash")
+
+	//	Assert
+	if err != nil {
+		t.Errorf("GetVersionsForRepoOnServer - Should get versions without error, but got: %s", err)
+	}
+
+	if len(releases) != 1 {
+		t.Fatalf("GetVersionsForRepoOnServer failed: Should have fetched one release, but got %d", len(releases))
+	}
+
+	expectedUrl := "https://media.ghe.example.com/devices/daydash/releases/download/v1.0.2/daydash_1.0.2_armhf.deb"
+	if releases[0].DownloadUrl != expectedUrl {
+		t.Errorf("GetVersionsForRepoOnServer failed: Expected download url %s but got %s", expectedUrl, releases[0].DownloadUrl)
+	}
+}
+
+func TestGithub_GetVersionsForRepoOnServer_RateLimited_ReturnsError(t *testing.T) {
+
+	//	Arrange
+	apiServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("X-RateLimit-Remaining", "0")
+		rw.WriteHeader(http.StatusForbidden)
+	}))
+	defer apiServer.Close()
+
+	//	Act
+	_, err := github.GetVersionsForRepoOnServer(github.Server{APIURL: apiServer.URL}, "danesparza", "daydash")
+
+	//	Assert
+	if err != github.ErrRateLimited {
+		t.Errorf("GetVersionsForRepoOnServer failed: Expected ErrRateLimited but got: %v", err)
+	}
+}
+
+func TestGithub_Server_DownloadFile_SendsToken(t *testing.T) {
+
+	//	Arrange
+	downloadServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "token testtoken" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprint(rw, "package contents")
+	}))
+	defer downloadServer.Close()
+
+	server := github.Server{Token: "testtoken"}
+
+	//	Act
+	filePath, err := server.DownloadFile(downloadServer.URL + "/devices/daydash/releases/download/v1.0.2/daydash_1.0.2_armhf.deb")
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("DownloadFile - Should download with the token without error, but got: %s", err)
+	}
+	defer os.Remove(filePath)
+
+	if contents, _ := ioutil.ReadFile(filePath); string(contents) != "package contents" {
+		t.Errorf("DownloadFile - Expected the downloaded contents, but got: %s", contents)
+	}
+}
+
+func TestGithub_DownloadFileWithHeaders_ErrorResponse_RemovesTempFile(t *testing.T) {
+
+	//	Arrange
+	downloadServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusNotFound)
+	}))
+	defer downloadServer.Close()
+
+	before, _ := filepath.Glob(filepath.Join(os.TempDir(), "*.appupgradeleak"))
+
+	//	Act
+	_, err := github.DownloadFileWithHeaders(downloadServer.URL+"/daydash.appupgradeleak", nil)
+
+	//	Assert
+	if err == nil {
+		t.Fatalf("DownloadFileWithHeaders - Expected an error for a missing file")
+	}
+
+	if after, _ := filepath.Glob(filepath.Join(os.TempDir(), "*.appupgradeleak")); len(after) != len(before) {
+		t.Errorf("DownloadFileWithHeaders - Expected the temp file to be removed, but found: %v", after)
+	}
+}
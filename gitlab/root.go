@@ -0,0 +1,240 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/system"
+	log "github.com/sirupsen/logrus"
+)
+
+// APIReleaseResponse is the response from the gitlab project releases api
+type APIReleaseResponse []struct {
+	TagName     string    `json:"tag_name"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	ReleasedAt  time.Time `json:"released_at"`
+	Upcoming    bool      `json:"upcoming_release"`
+	Assets      struct {
+		Count int `json:"count"`
+		Links []struct {
+			ID             int    `json:"id"`
+			Name           string `json:"name"`
+			URL            string `json:"url"`
+			DirectAssetURL string `json:"direct_asset_url"`
+			LinkType       string `json:"link_type"`
+		} `json:"links"`
+	} `json:"assets"`
+}
+
+// nextLinkRegex gets the next page url from a Link header
+var nextLinkRegex = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// Project describes a project on a gitlab instance
+type Project struct {
+	BaseURL string // The base url of the gitlab instance (https://gitlab.example.com or https://example.com/gitlab)
+	Path    string // The full path of the project (group/subgroup/project)
+}
+
+// IsGitLabURL returns true if the url looks like it points to a project on a gitlab instance.  Only gitlab.com
+// and hosts named gitlab.* are recognized -- other self-hosted instances need the source type set to gitlab
+func IsGitLabURL(projectUrl string) bool {
+	parsed, err := url.Parse(projectUrl)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	return host == "gitlab.com" || strings.HasPrefix(host, "gitlab.")
+}
+
+// ParseProjectURL gets the gitlab project information from a project url.  If baseUrl is blank,
+// the gitlab instance is assumed to be at the root of the url's host
+func ParseProjectURL(projectUrl, baseUrl string) (Project, error) {
+	retval := Project{}
+
+	parsed, err := url.Parse(projectUrl)
+	if err != nil {
+		return retval, err
+	}
+
+	if parsed.Host == "" {
+		return retval, fmt.Errorf("not a valid gitlab project url: %s", projectUrl)
+	}
+
+	//	Figure out the base url and the project path relative to it
+	retval.BaseURL = fmt.Sprintf("%s://%s", parsed.Scheme, parsed.Host)
+	projectPath := parsed.Path
+
+	if baseUrl != "" {
+		retval.BaseURL = strings.TrimSuffix(baseUrl, "/")
+
+		if parsedBase, err := url.Parse(retval.BaseURL); err == nil {
+			projectPath = strings.TrimPrefix(projectPath, parsedBase.Path)
+		}
+	}
+
+	//	Trim anything that isn't part of the project path (like /-/releases or .git)
+	if idx := strings.Index(projectPath, "/-/"); idx >= 0 {
+		projectPath = projectPath[:idx]
+	}
+
+	projectPath = strings.TrimSuffix(strings.Trim(projectPath, "/"), ".git")
+
+	if projectPath == "" {
+		return retval, fmt.Errorf("not a valid gitlab project url: %s", projectUrl)
+	}
+
+	retval.Path = projectPath
+
+	return retval, nil
+}
+
+// GetVersionsForProject gets the available releases (with package file asset links) for the given gitlab project.
+// The token can be a personal, group or project access token and may be blank for public projects
+func GetVersionsForProject(project Project, token string) ([]github.Release, error) {
+	retval := []github.Release{}
+	releaseResponse := APIReleaseResponse{}
+
+	//	Format our url.  Projects with more releases than fit on a page are listed a page at a time
+	nextUrl := fmt.Sprintf("%s/api/v4/projects/%s/releases?per_page=100", project.BaseURL, url.PathEscape(project.Path))
+	for nextUrl != "" {
+		page, pageNextUrl, err := getReleasePage(nextUrl, token)
+		if err != nil {
+			return retval, err
+		}
+
+		releaseResponse = append(releaseResponse, page...)
+		nextUrl = pageNextUrl
+	}
+
+	//	Loop through each release
+	for _, item := range releaseResponse {
+		if item.Upcoming {
+			continue
+		}
+
+		//	Analyze the asset links.  If we have a package file (.deb, .rpm, tarball or binary), track it.  Links to the
+		//	generic package registry are named after the file, so they're found the same way
+		for _, link := range item.Assets.Links {
+			downloadUrl := link.DirectAssetURL
+			if downloadUrl == "" {
+				downloadUrl = link.URL
+			}
+
+			if !system.IsPackageFile(link.Name) && !system.IsPackageFile(downloadUrl) {
+				continue
+			}
+
+			newRelease := github.Release{
+				Version:      item.TagName,
+				Name:         link.Name,
+				DownloadUrl:  downloadUrl,
+				Created:      item.ReleasedAt,
+				ReleaseNotes: item.Description,
+			}
+
+			retval = append(retval, newRelease)
+		}
+	}
+
+	return retval, nil
+}
+
+// getReleasePage gets a page of releases from the gitlab api, and the url of the next page (or an empty string if it's the last one)
+func getReleasePage(pageUrl, token string) (APIReleaseResponse, string, error) {
+	retval := APIReleaseResponse{}
+
+	//	Create a request with headers
+	clientRequest, err := http.NewRequest("GET", pageUrl, nil)
+	if err != nil {
+		log.WithError(err).Error("problem preparing the request to the gitlab api")
+		return retval, "", err
+	}
+
+	//	Set our headers
+	clientRequest.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	for name, value := range AuthHeaders(token) {
+		clientRequest.Header.Set(name, value)
+	}
+
+	//	Execute the request
+	client := &http.Client{}
+	clientResponse, err := client.Do(clientRequest)
+	if err != nil {
+		log.WithError(err).Error("problem sending the request to the gitlab api")
+		return retval, "", err
+	}
+	defer clientResponse.Body.Close()
+
+	if clientResponse.StatusCode < 200 || clientResponse.StatusCode > 299 {
+		err = fmt.Errorf("unexpected response status: %s", clientResponse.Status)
+		log.WithError(err).WithFields(log.Fields{
+			"url": pageUrl,
+		}).Error("problem with the response from the gitlab api")
+		return retval, "", err
+	}
+
+	//	Decode the response:
+	err = json.NewDecoder(clientResponse.Body).Decode(&retval)
+	if err != nil {
+		log.WithError(err).Error("problem decoding the response from the gitlab api")
+		return retval, "", err
+	}
+
+	return retval, nextPageURL(pageUrl, clientResponse.Header), nil
+}
+
+// nextPageURL gets the url of the next page of results from the pagination headers gitlab sends.  The
+// Link header is used if there is one, otherwise the X-Next-Page header (which is blank on the last page)
+func nextPageURL(pageUrl string, header http.Header) string {
+	if matches := nextLinkRegex.FindStringSubmatch(header.Get("Link")); matches != nil {
+		return matches[1]
+	}
+
+	nextPage := header.Get("X-Next-Page")
+	if nextPage == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(pageUrl)
+	if err != nil {
+		return ""
+	}
+
+	query := parsed.Query()
+	query.Set("page", nextPage)
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String()
+}
+
+// AuthHeaders gets the request headers used to authenticate with gitlab using the given token
+func AuthHeaders(token string) map[string]string {
+	retval := make(map[string]string)
+
+	if token != "" {
+		retval["PRIVATE-TOKEN"] = token
+	}
+
+	return retval
+}
+
+// DownloadFile downloads a release asset for the given project to a temporary location and returns the
+// temporary location.  The token is only sent if the asset is hosted on the gitlab instance itself
+func DownloadFile(project Project, token, remoteUrl string) (string, error) {
+	headers := map[string]string{}
+
+	if strings.HasPrefix(remoteUrl, project.BaseURL+"/") {
+		headers = AuthHeaders(token)
+	}
+
+	return github.DownloadFileWithHeaders(remoteUrl, headers)
+}
@@ -0,0 +1,152 @@
+package gitlab_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/danesparza/appupgrade/gitlab"
+)
+
+func TestGitlab_ParseProjectURL_CustomBaseURL_Successful(t *testing.T) {
+
+	//	Arrange
+	projectUrl := "https://example.com/gitlab/devices/apps/daydash/-/releases"
+	baseUrl := "https://example.com/gitlab/"
+
+	//	Act
+	project, err := gitlab.ParseProjectURL(projectUrl, baseUrl)
+
+	//	Assert
+	if err != nil {
+		t.Errorf("ParseProjectURL - Should parse without error, but got: %s", err)
+	}
+
+	if project.BaseURL != "https://example.com/gitlab" || project.Path != "devices/apps/daydash" {
+		t.Errorf("ParseProjectURL failed: Unexpected project: %+v", project)
+	}
+}
+
+func TestGitlab_IsGitLabURL_Successful(t *testing.T) {
+	if !gitlab.IsGitLabURL("https://gitlab.example.com/devices/daydash") {
+		t.Errorf("IsGitLabURL failed: Should recognize a self-managed gitlab url")
+	}
+
+	if gitlab.IsGitLabURL("https://github.com/danesparza/daydash") {
+		t.Errorf("IsGitLabURL failed: Should not recognize a github url")
+	}
+}
+
+func TestGitlab_GetVersionsForProject_WithToken_Successful(t *testing.T) {
+
+	//	Arrange
+	token := "glpat-testtoken"
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("PRIVATE-TOKEN") != token {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch req.URL.EscapedPath() {
+		case "/api/v4/projects/devices%2Fdaydash/releases":
+			fmt.Fprintf(rw, `[{
+				"tag_name": "v1.0.2",
+				"description": "Release notes",
+				"released_at": "2021-10-01T12:00:00Z",
+				"assets": {"links": [
+					{"name": "daydash_1.0.2_armhf.deb", "url": "%[1]s/api/v4/projects/12/packages/generic/daydash/1.0.2/daydash_1.0.2_armhf.deb"},
+					{"name": "checksums.txt", "url": "%[1]s/checksums.txt"}
+				]}
+			}]`, server.URL)
+		case "/api/v4/projects/12/packages/generic/daydash/1.0.2/daydash_1.0.2_armhf.deb":
+			fmt.Fprint(rw, "package contents")
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	project, _ := gitlab.ParseProjectURL(server.URL+"/devices/daydash", "")
+
+	//	Act
+	releases, err := gitlab.GetVersionsForProject(project, token)
+
+	//	Assert
+	if err != nil {
+		t.Errorf("GetVersionsForProject - Should get versions without error, but got: %s", err)
+	}
+
+	if len(releases) != 1 {
+		t.Fatalf("GetVersionsForProject failed: Should have found one .deb release, but got %d", len(releases))
+	}
+
+	if releases[0].Version != "v1.0.2" || releases[0].ReleaseNotes != "Release notes" {
+		t.Errorf("GetVersionsForProject failed: Unexpected release: %+v", releases[0])
+	}
+
+	packageFile, err := gitlab.DownloadFile(project, token, releases[0].DownloadUrl)
+	if err != nil {
+		t.Fatalf("DownloadFile - Should download without error, but got: %s", err)
+	}
+	defer os.Remove(packageFile)
+
+	contents, _ := ioutil.ReadFile(packageFile)
+	if string(contents) != "package contents" {
+		t.Errorf("DownloadFile failed: Unexpected file contents: %s", contents)
+	}
+}
+
+func TestGitlab_GetVersionsForProject_ManyReleases_FollowsPages(t *testing.T) {
+
+	//	Arrange
+	//	The first page links to the second with a Link header, and the second to the third with only X-Next-Page
+	requestedPages := []string{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.EscapedPath() != "/api/v4/projects/devices%2Fdaydash/releases" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		page := req.URL.Query().Get("page")
+		requestedPages = append(requestedPages, page)
+		if page == "" {
+			page = "1"
+		}
+
+		switch page {
+		case "1":
+			rw.Header().Set("Link", fmt.Sprintf(`<%s/api/v4/projects/devices%%2Fdaydash/releases?page=2&per_page=100>; rel="next", <%s/api/v4/projects/devices%%2Fdaydash/releases?page=3&per_page=100>; rel="last"`, server.URL, server.URL))
+			rw.Header().Set("X-Next-Page", "2")
+		case "2":
+			rw.Header().Set("X-Next-Page", "3")
+		default:
+			rw.Header().Set("X-Next-Page", "")
+		}
+
+		fmt.Fprintf(rw, `[{"tag_name": "v1.0.%[1]s", "assets": {"links": [{"name": "daydash_1.0.%[1]s_armhf.deb", "url": "%[2]s/daydash_1.0.%[1]s_armhf.deb"}]}}]`, page, server.URL)
+	}))
+	defer server.Close()
+
+	project, _ := gitlab.ParseProjectURL(server.URL+"/devices/daydash", "")
+
+	//	Act
+	releases, err := gitlab.GetVersionsForProject(project, "")
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("GetVersionsForProject - Should get versions without error, but got: %s", err)
+	}
+
+	if fmt.Sprint(requestedPages) != "[ 2 3]" {
+		t.Errorf("GetVersionsForProject failed: Expected the first page then pages 2 and 3, but requested: %q", requestedPages)
+	}
+
+	if len(releases) != 3 || releases[0].Version != "v1.0.1" || releases[2].Version != "v1.0.3" {
+		t.Errorf("GetVersionsForProject failed: Expected a release from each page, but got: %+v", releases)
+	}
+}
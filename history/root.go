@@ -0,0 +1,111 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/danesparza/appupgrade/pkgmgr"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Operations that are recorded in the history
+const (
+	OperationUpdate  = "update"
+	OperationInstall = "install"
+	OperationRemove  = "remove"
+	OperationPurge   = "purge"
+	OperationRestore = "restore"
+	OperationRecover = "recover"
+)
+
+// Entry is a single package operation in the history
+type Entry struct {
+	Time            time.Time               `json:"time"`                      // When the operation finished
+	Package         string                  `json:"package"`                   // The package name
+	Operation       string                  `json:"operation"`                 // What was done (update, install, remove, purge, restore or recover)
+	Version         string                  `json:"version,omitempty"`         // The version the package was changed to (if any)
+	PreviousVersion string                  `json:"previousversion,omitempty"` // The version that was installed before
+	Success         bool                    `json:"success"`                   // 'true' if the operation succeeded
+	Message         string                  `json:"message"`                   // What happened
+	Conffiles       []pkgmgr.ConffileChange `json:"conffiles,omitempty"`       // What happened to each configuration file (if the package manager tracks them)
+}
+
+// maxEntrySize is the longest history line that can be read.  Entries include the package manager's
+// output, which can be well past bufio.Scanner's default 64KB
+const maxEntrySize = 16 * 1024 * 1024
+
+// mu serializes writes to the history file
+var mu sync.Mutex
+
+// Path gets the path of the history file
+func Path() string {
+	return filepath.Join(viper.GetString("state.path"), "history.jsonl")
+}
+
+// Record appends an entry to the history.  The time is set if it isn't already
+func Record(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(Path()), 0755); err != nil {
+		log.WithError(err).Error("problem creating the history directory")
+		return err
+	}
+
+	f, err := os.OpenFile(Path(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.WithError(err).Error("problem opening the history file")
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// GetEntriesForPackage gets the history of a package (oldest first).  A blank package name gets all the history
+func GetEntriesForPackage(packageName string) ([]Entry, error) {
+	retval := []Entry{}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	f, err := os.Open(Path())
+	if os.IsNotExist(err) {
+		return retval, nil
+	}
+	if err != nil {
+		return retval, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxEntrySize)
+	for scanner.Scan() {
+		entry := Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			//	Skip lines that can't be read (a partial write, for example)
+			continue
+		}
+
+		if packageName == "" || entry.Package == packageName {
+			retval = append(retval, entry)
+		}
+	}
+
+	return retval, scanner.Err()
+}
@@ -0,0 +1,80 @@
+package history_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/danesparza/appupgrade/history"
+	"github.com/danesparza/appupgrade/pkgmgr"
+	"github.com/spf13/viper"
+)
+
+func TestRecord_GetEntriesForPackage_ReturnsPackageEntriesInOrder(t *testing.T) {
+
+	//	Arrange
+	dir, err := ioutil.TempDir("", "appupgrade-history-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set("state.path", dir)
+	defer viper.Set("state.path", nil)
+
+	//	Act
+	history.Record(history.Entry{Package: "daydash", Operation: history.OperationInstall, Version: "1.0.1", Success: true, Conffiles: []pkgmgr.ConffileChange{{Path: "/etc/daydash.conf", Action: pkgmgr.ConffileKept}}})
+	history.Record(history.Entry{Package: "other", Operation: history.OperationInstall, Version: "2.0.0", Success: true})
+	history.Record(history.Entry{Package: "daydash", Operation: history.OperationPurge, PreviousVersion: "1.0.1", Success: true})
+	entries, err := history.GetEntriesForPackage("daydash")
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("GetEntriesForPackage - Should read the history without error, but got: %s", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("GetEntriesForPackage - Expected 2 entries for the package, but got: %v", entries)
+	}
+
+	if entries[0].Operation != history.OperationInstall || entries[1].Operation != history.OperationPurge {
+		t.Errorf("GetEntriesForPackage - Expected install then purge, but got: %v", entries)
+	}
+
+	if len(entries[0].Conffiles) != 1 || entries[0].Conffiles[0].Action != pkgmgr.ConffileKept {
+		t.Errorf("GetEntriesForPackage - Expected the configuration file report to be kept, but got: %v", entries[0].Conffiles)
+	}
+
+	if entries[1].Time.IsZero() {
+		t.Errorf("Record - Expected the time to be set, but it wasn't")
+	}
+}
+
+func TestGetEntriesForPackage_LargeEntry_IsRead(t *testing.T) {
+
+	//	Arrange
+	dir, err := ioutil.TempDir("", "appupgrade-history-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set("state.path", dir)
+	defer viper.Set("state.path", nil)
+
+	//	Package manager output can be much longer than bufio.Scanner's default 64KB line limit
+	largeOutput := strings.Repeat("Unpacking daydash ...\n", 10000)
+
+	//	Act
+	history.Record(history.Entry{Package: "daydash", Operation: history.OperationInstall, Version: "1.0.1", Success: true, Message: largeOutput})
+	history.Record(history.Entry{Package: "daydash", Operation: history.OperationRemove, PreviousVersion: "1.0.1", Success: true})
+	entries, err := history.GetEntriesForPackage("daydash")
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("GetEntriesForPackage - Should read a large entry without error, but got: %s", err)
+	}
+
+	if len(entries) != 2 || entries[0].Message != largeOutput || entries[1].Operation != history.OperationRemove {
+		t.Errorf("GetEntriesForPackage - Expected the large entry and the one after it, but got %d entries", len(entries))
+	}
+}
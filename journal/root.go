@@ -0,0 +1,150 @@
+package journal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Operation is a package change that was started.  It's written before the package is changed and removed once the
+// change is finished (even if it failed), so an operation that's still around was interrupted part way through
+type Operation struct {
+	Package         string    `json:"package"`                   // The package name
+	Operation       string    `json:"operation"`                 // The change: update, install, remove or purge
+	Version         string    `json:"version,omitempty"`         // The version being installed
+	PreviousVersion string    `json:"previousversion,omitempty"` // The version that was installed before
+	WasInstalled    bool      `json:"wasinstalled"`              // 'true' if the package was installed before
+	PackageManager  string    `json:"packagemanager"`            // The package manager making the change
+	Started         time.Time `json:"started"`                   // When the change started
+}
+
+// Dir gets the directory the in-flight operations are recorded in
+func Dir() string {
+	return filepath.Join(viper.GetString("state.path"), "inflight")
+}
+
+// path gets the path of the record for a package's operation
+func path(packageName string) string {
+	return filepath.Join(Dir(), packageName+".json")
+}
+
+// Begin records that an operation is starting.  The record is synced to disk before it returns,
+// so it survives a power loss
+func Begin(operation Operation) error {
+	if operation.Started.IsZero() {
+		operation.Started = time.Now()
+	}
+
+	if err := os.MkdirAll(Dir(), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(operation, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	//	Write to a temp file and rename it, so the record is never half written
+	tempPath := path(operation.Package) + ".tmp"
+	f, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempPath, path(operation.Package)); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"package":   operation.Package,
+		"operation": operation.Operation,
+		"version":   operation.Version,
+	}).Debug("recorded in-flight operation")
+
+	return syncDir(Dir())
+}
+
+// Finish removes the record of a package's operation (once it's done, whether it worked or not)
+func Finish(packageName string) error {
+	err := os.Remove(path(packageName))
+	if err != nil && !os.IsNotExist(err) {
+		log.WithError(err).WithFields(log.Fields{
+			"package": packageName,
+		}).Error("problem removing the in-flight operation record")
+		return err
+	}
+
+	return nil
+}
+
+// GetUnfinished gets the operations that were started but never finished (oldest first)
+func GetUnfinished() ([]Operation, error) {
+	retval := []Operation{}
+
+	entries, err := ioutil.ReadDir(Dir())
+	if os.IsNotExist(err) {
+		return retval, nil
+	}
+	if err != nil {
+		return retval, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(Dir(), entry.Name()))
+		if err != nil {
+			return retval, err
+		}
+
+		operation := Operation{}
+		if err := json.Unmarshal(data, &operation); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"file": entry.Name(),
+			}).Warn("problem reading an in-flight operation record - skipping it")
+			continue
+		}
+
+		retval = append(retval, operation)
+	}
+
+	sort.Slice(retval, func(i, j int) bool {
+		return retval[i].Started.Before(retval[j].Started)
+	})
+
+	return retval, nil
+}
+
+// syncDir syncs a directory, so a file renamed into it survives a power loss
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
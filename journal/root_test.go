@@ -0,0 +1,41 @@
+package journal_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/danesparza/appupgrade/journal"
+	"github.com/spf13/viper"
+)
+
+func TestBegin_Finish_OnlyUnfinishedOperationsAreReturned(t *testing.T) {
+
+	//	Arrange
+	dir, err := ioutil.TempDir("", "appupgrade-journal-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set("state.path", dir)
+	defer viper.Set("state.path", nil)
+
+	//	Act
+	beginErr := journal.Begin(journal.Operation{Package: "daydash", Operation: "update", Version: "1.0.2", PreviousVersion: "1.0.1", WasInstalled: true, PackageManager: "dpkg"})
+	journal.Begin(journal.Operation{Package: "other", Operation: "install", Version: "2.0.0", PackageManager: "apt"})
+	finishErr := journal.Finish("other")
+	unfinished, err := journal.GetUnfinished()
+
+	//	Assert
+	if beginErr != nil || finishErr != nil || err != nil {
+		t.Fatalf("Begin / Finish / GetUnfinished - Should run without error, but got: %v / %v / %v", beginErr, finishErr, err)
+	}
+
+	if len(unfinished) != 1 {
+		t.Fatalf("GetUnfinished - Expected only the unfinished operation, but got: %v", unfinished)
+	}
+
+	if unfinished[0].Package != "daydash" || unfinished[0].PreviousVersion != "1.0.1" || !unfinished[0].WasInstalled || unfinished[0].Started.IsZero() {
+		t.Errorf("GetUnfinished - Unexpected operation: %+v", unfinished[0])
+	}
+}
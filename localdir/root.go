@@ -0,0 +1,77 @@
+package localdir
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danesparza/appupgrade/dpkg"
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/system"
+	log "github.com/sirupsen/logrus"
+)
+
+// IsLocalURL returns true if the url is a local path (or a file:// url)
+func IsLocalURL(dirUrl string) bool {
+	return strings.HasPrefix(dirUrl, "file://") || strings.HasPrefix(dirUrl, "/")
+}
+
+// GetDirectory gets the local directory from a path or file:// url
+func GetDirectory(dirUrl string) string {
+	return strings.TrimPrefix(dirUrl, "file://")
+}
+
+// GetVersionsForPackage scans the given directory (and its subdirectories) for .deb files and returns a release
+// for each file that contains the given package for this machine's architecture.  The package name and version
+// are read from each file's control fields, so the files can be named anything.  Each release is named
+// <package>_<version>_<arch>.deb (from the control fields), and its download url is the local path to the file
+func GetVersionsForPackage(dir, packageName string) ([]github.Release, error) {
+	retval := []github.Release{}
+
+	err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".deb") {
+			return nil
+		}
+
+		//	Read the control fields from the package file
+		fields, err := dpkg.GetPackageFileInfo(filePath)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"file": filePath,
+			}).Warn("problem reading the package file - skipping it")
+			return nil
+		}
+
+		if fields["Package"] != packageName || !system.ArchitectureMatches(fields["Architecture"]) {
+			return nil
+		}
+
+		//	The release is named from the control fields (not the file name), so the package
+		//	manager can tell the architecture no matter what the file is called
+		newRelease := github.Release{
+			Version:      fields["Version"],
+			Name:         fmt.Sprintf("%s_%s_%s.deb", fields["Package"], fields["Version"], fields["Architecture"]),
+			DownloadUrl:  filePath,
+			Created:      info.ModTime(),
+			ReleaseNotes: fields["Description"],
+		}
+
+		retval = append(retval, newRelease)
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"dir": dir,
+		}).Error("problem scanning the directory for package files")
+		return retval, err
+	}
+
+	github.SortNewestFirst(retval)
+
+	return retval, nil
+}
@@ -0,0 +1,75 @@
+package localdir_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/danesparza/appupgrade/localdir"
+	"github.com/danesparza/appupgrade/pkgmgr"
+)
+
+// buildPackage builds a minimal .deb file with dpkg-deb
+func buildPackage(t *testing.T, dir, fileName, packageName, packageVersion string) {
+	stageDir, err := ioutil.TempDir("", "appupgrade-stage-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create stage dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(stageDir)
+
+	os.MkdirAll(filepath.Join(stageDir, "DEBIAN"), 0755)
+	control := fmt.Sprintf("Package: %s\nVersion: %s\nArchitecture: all\nMaintainer: Test <test@example.com>\nDescription: Test package\n", packageName, packageVersion)
+	ioutil.WriteFile(filepath.Join(stageDir, "DEBIAN", "control"), []byte(control), 0644)
+
+	output, err := exec.Command("dpkg-deb", "--root-owner-group", "--build", stageDir, filepath.Join(dir, fileName)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("dpkg-deb - Should build package without error, but got: %s %s", err, output)
+	}
+}
+
+func TestLocaldir_GetVersionsForPackage_ReadsControlFields_Successful(t *testing.T) {
+
+	//	Arrange
+	if _, err := exec.LookPath("dpkg-deb"); err != nil {
+		t.Skip("dpkg-deb is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "appupgrade-local-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "older"), 0755)
+	buildPackage(t, dir, "daydash_stable.deb", "daydash", "1.0.2")
+	buildPackage(t, filepath.Join(dir, "older"), "whatever-name.deb", "daydash", "1.0.1")
+	buildPackage(t, dir, "other.deb", "otherapp", "3.0.0")
+
+	//	Act
+	releases, err := localdir.GetVersionsForPackage(localdir.GetDirectory("file://"+dir), "daydash")
+
+	//	Assert
+	if err != nil {
+		t.Errorf("GetVersionsForPackage - Should get versions without error, but got: %s", err)
+	}
+
+	if len(releases) != 2 {
+		t.Fatalf("GetVersionsForPackage failed: Expected 2 versions of daydash, but got %d", len(releases))
+	}
+
+	if releases[0].Version != "1.0.2" || releases[0].DownloadUrl != filepath.Join(dir, "daydash_stable.deb") {
+		t.Errorf("GetVersionsForPackage failed: Expected the newest version first, but got %+v", releases[0])
+	}
+
+	if releases[1].Version != "1.0.1" || releases[1].DownloadUrl != filepath.Join(dir, "older", "whatever-name.deb") {
+		t.Errorf("GetVersionsForPackage failed: Expected the older version from the subdirectory, but got %+v", releases[1])
+	}
+
+	//	The releases are named from the control fields, so a file name that looks like it has an architecture doesn't matter
+	if releases[0].Name != "daydash_1.0.2_all.deb" || !pkgmgr.CanInstallFile(pkgmgr.Dpkg{}, releases[0].Name) {
+		t.Errorf("GetVersionsForPackage failed: Expected the release to be named from the control fields, but got %s", releases[0].Name)
+	}
+}
@@ -0,0 +1,135 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/system"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Manifest is a simple list of releases that can be hosted on any http server.
+// It can be written as JSON or YAML:
+//
+//	releases:
+//	  - version: v1.0.2
+//	    created: 2021-10-01T12:00:00Z
+//	    notes: Fixes the thing
+//	    assets:
+//	      - arch: armhf
+//	        url: https://builds.example.com/myapp/myapp_1.0.2_armhf.deb
+//	        sha256: 0f3e...
+type Manifest struct {
+	Releases []ManifestRelease `json:"releases" yaml:"releases"`
+}
+
+// ManifestRelease is a single version listed in a manifest
+type ManifestRelease struct {
+	Version string          `json:"version" yaml:"version"`
+	Created time.Time       `json:"created" yaml:"created"`
+	Notes   string          `json:"notes" yaml:"notes"`
+	Assets  []ManifestAsset `json:"assets" yaml:"assets"`
+}
+
+// ManifestAsset is a single downloadable package file for a release
+type ManifestAsset struct {
+	Arch   string `json:"arch" yaml:"arch"`
+	URL    string `json:"url" yaml:"url"`
+	SHA256 string `json:"sha256" yaml:"sha256"`
+}
+
+// IsManifestURL returns true if the url looks like it points to a manifest file
+func IsManifestURL(manifestUrl string) bool {
+	lowerUrl := strings.ToLower(manifestUrl)
+	return strings.HasSuffix(lowerUrl, ".json") || strings.HasSuffix(lowerUrl, ".yaml") || strings.HasSuffix(lowerUrl, ".yml")
+}
+
+// GetVersionsForManifest gets the available releases listed in the manifest at the given url.
+// Only assets for this machine's architecture are included.  Releases are returned newest first
+func GetVersionsForManifest(manifestUrl string) ([]github.Release, error) {
+	retval := []github.Release{}
+
+	//	Get the manifest
+	resp, err := http.Get(manifestUrl)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"url": manifestUrl,
+		}).Error("problem fetching the manifest")
+		return retval, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = fmt.Errorf("unexpected response status: %s", resp.Status)
+		log.WithError(err).WithFields(log.Fields{
+			"url": manifestUrl,
+		}).Error("problem fetching the manifest")
+		return retval, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"url": manifestUrl,
+		}).Error("problem reading the manifest")
+		return retval, err
+	}
+
+	//	Decode the manifest:
+	manifest, err := Parse(body)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"url": manifestUrl,
+		}).Error("problem decoding the manifest")
+		return retval, err
+	}
+
+	//	Map each release onto the github release shape
+	for _, item := range manifest.Releases {
+		for _, asset := range item.Assets {
+			if !system.ArchitectureMatches(asset.Arch) {
+				continue
+			}
+
+			newRelease := github.Release{
+				Version:      item.Version,
+				Name:         assetName(asset.URL),
+				DownloadUrl:  asset.URL,
+				Created:      item.Created,
+				Checksum:     asset.SHA256,
+				ReleaseNotes: item.Notes,
+			}
+
+			retval = append(retval, newRelease)
+		}
+	}
+
+	github.SortNewestFirst(retval)
+
+	return retval, nil
+}
+
+// Parse decodes a manifest in either JSON or YAML format
+func Parse(data []byte) (Manifest, error) {
+	retval := Manifest{}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err := json.Unmarshal(data, &retval)
+		return retval, err
+	}
+
+	err := yaml.Unmarshal(data, &retval)
+	return retval, err
+}
+
+// assetName gets the file name from an asset url
+func assetName(assetUrl string) string {
+	return assetUrl[strings.LastIndex(assetUrl, "/")+1:]
+}
@@ -0,0 +1,93 @@
+package manifest_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danesparza/appupgrade/manifest"
+	"github.com/danesparza/appupgrade/system"
+)
+
+func TestManifest_GetVersionsForManifest_YAML_Successful(t *testing.T) {
+
+	//	Arrange
+	arch := system.GetArchitecture()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(rw, `
+releases:
+  - version: v1.0.1
+    notes: Older release
+    assets:
+      - arch: %[1]s
+        url: http://builds.example.com/myapp_1.0.1_%[1]s.deb
+  - version: v1.0.2
+    notes: Newer release
+    assets:
+      - arch: %[1]s
+        url: http://builds.example.com/myapp_1.0.2_%[1]s.deb
+        sha256: abc123
+      - arch: some-other-arch
+        url: http://builds.example.com/myapp_1.0.2_other.deb
+`, arch)
+	}))
+	defer server.Close()
+
+	//	Act
+	releases, err := manifest.GetVersionsForManifest(server.URL + "/myapp/manifest.yaml")
+
+	//	Assert
+	if err != nil {
+		t.Errorf("GetVersionsForManifest - Should get versions without error, but got: %s", err)
+	}
+
+	if len(releases) != 2 {
+		t.Fatalf("GetVersionsForManifest failed: Should have fetched 2 releases for this architecture, but got %d", len(releases))
+	}
+
+	if releases[0].Version != "v1.0.2" {
+		t.Errorf("GetVersionsForManifest failed: Expected the newest release first, but got %s", releases[0].Version)
+	}
+
+	if releases[0].Checksum != "abc123" || releases[0].ReleaseNotes != "Newer release" {
+		t.Errorf("GetVersionsForManifest failed: Expected checksum and notes to be mapped, but got %+v", releases[0])
+	}
+
+	if releases[0].Name != fmt.Sprintf("myapp_1.0.2_%s.deb", arch) {
+		t.Errorf("GetVersionsForManifest failed: Expected the asset file name, but got %s", releases[0].Name)
+	}
+}
+
+func TestManifest_Parse_JSON_Successful(t *testing.T) {
+
+	//	Arrange
+	data := []byte(`{"releases": [{"version": "v2.0.0", "assets": [{"arch": "all", "url": "http://builds.example.com/myapp_2.0.0_all.deb"}]}]}`)
+
+	//	Act
+	parsed, err := manifest.Parse(data)
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Parse - Should parse JSON without error, but got: %s", err)
+	}
+
+	if len(parsed.Releases) != 1 || len(parsed.Releases[0].Assets) != 1 {
+		t.Errorf("Parse failed: Expected one release with one asset, but got %+v", parsed)
+	}
+}
+
+func TestManifest_GetVersionsForManifest_NotFound_ReturnsError(t *testing.T) {
+
+	//	Arrange
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	//	Act
+	_, err := manifest.GetVersionsForManifest(server.URL + "/missing.json")
+
+	//	Assert
+	if err == nil {
+		t.Errorf("GetVersionsForManifest - Should return an error for a missing manifest, but didn't")
+	}
+}
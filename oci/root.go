@@ -0,0 +1,392 @@
+package oci
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/system"
+	"github.com/hashicorp/go-version"
+	log "github.com/sirupsen/logrus"
+)
+
+// DebMediaTypes are the layer media types that are treated as .deb files
+var DebMediaTypes = []string{
+	"application/vnd.debian.binary-package",
+	"application/x-debian-package",
+	"application/vnd.debian.package",
+}
+
+// titleAnnotation is the layer annotation ORAS uses for the file name
+const titleAnnotation = "org.opencontainers.image.title"
+
+// Registry describes an OCI distribution registry
+type Registry struct {
+	Endpoint string // The registry endpoint (https://registry.example.com or http://localhost:5000)
+	Username string // The username for basic auth (or for getting a bearer token)
+	Password string // The password for basic auth (or for getting a bearer token)
+	Token    string // A static bearer token.  If set, it's used instead of the username and password
+}
+
+// Manifest is an OCI image manifest (or a docker v2 manifest)
+type Manifest struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	MediaType     string `json:"mediaType"`
+	Layers        []struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Size        int64             `json:"size"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+// tagList is the response from the tags list api
+type tagList struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// debArchRegex gets the architecture from a debian package file name (name_version_arch.deb)
+var debArchRegex = regexp.MustCompile(`_([a-z0-9-]+)\.deb$`)
+
+// challengeParamRegex gets the parameters from a WWW-Authenticate header
+var challengeParamRegex = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// nextLinkRegex gets the next page url from a Link header
+var nextLinkRegex = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// IsOCIURL returns true if the url is an oci:// (or oci+http:// for a plain http registry) repository url
+func IsOCIURL(repoUrl string) bool {
+	return strings.HasPrefix(strings.ToLower(repoUrl), "oci://") || strings.HasPrefix(strings.ToLower(repoUrl), "oci+http://")
+}
+
+// IsImageURL returns true if the url is a docker:// container image repository url
+func IsImageURL(repoUrl string) bool {
+	return strings.HasPrefix(strings.ToLower(repoUrl), "docker://")
+}
+
+// ParseRepositoryURL gets the registry endpoint and repository name from an oci://host/name
+// (or docker://host/name) url.  Docker hub names are expanded the way docker does.  Registries
+// are reached over https, unless the url is oci+http://host/name (a plain http registry:2, for example)
+func ParseRepositoryURL(repoUrl string) (string, string, error) {
+	parsed, err := url.Parse(repoUrl)
+	if err != nil {
+		return "", "", err
+	}
+
+	name := strings.Trim(parsed.Path, "/")
+	validScheme := strings.EqualFold(parsed.Scheme, "oci") || strings.EqualFold(parsed.Scheme, "oci+http") || strings.EqualFold(parsed.Scheme, "docker")
+	if !validScheme || parsed.Host == "" || name == "" {
+		return "", "", fmt.Errorf("not a valid oci repository url: %s", repoUrl)
+	}
+
+	if parsed.Host == "docker.io" {
+		if !strings.Contains(name, "/") {
+			name = "library/" + name
+		}
+		return "https://registry-1.docker.io", name, nil
+	}
+
+	if strings.EqualFold(parsed.Scheme, "oci+http") {
+		return "http://" + parsed.Host, name, nil
+	}
+
+	return "https://" + parsed.Host, name, nil
+}
+
+// GetVersionsForRepository gets a release for each tag in the repository that has a .deb layer for this
+// machine's architecture.  The tag is the version.  The checksum of each release is the layer digest
+func GetVersionsForRepository(registry Registry, repository string) ([]github.Release, error) {
+	retval := []github.Release{}
+
+	headers, err := registry.AuthHeaders(repository)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"repository": repository,
+		}).Error("problem authenticating with the registry")
+		return retval, err
+	}
+
+	//	List the tags
+	tags, err := registry.listTags(repository, headers)
+	if err != nil {
+		return retval, err
+	}
+
+	//	Find the .deb layer in each tag's manifest
+	for _, tag := range tags {
+		manifest := Manifest{}
+		manifestUrl := fmt.Sprintf("%s/v2/%s/manifests/%s", registry.endpoint(), repository, url.PathEscape(tag))
+		_, err := registry.getJSON(manifestUrl, headers, "application/vnd.oci.image.manifest.v1+json, application/vnd.docker.distribution.manifest.v2+json", &manifest)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"repository": repository,
+				"tag":        tag,
+			}).Warn("problem getting the manifest for tag - skipping it")
+			continue
+		}
+
+		for _, layer := range manifest.Layers {
+			if !isDebMediaType(layer.MediaType) {
+				continue
+			}
+
+			//	Layers pushed without a title are named after the repository and tag (they're all .deb media types)
+			fileName := layer.Annotations[titleAnnotation]
+			if fileName == "" {
+				fileName = fmt.Sprintf("%s_%s.deb", path.Base(repository), tag)
+			}
+
+			if matches := debArchRegex.FindStringSubmatch(fileName); matches != nil && !system.ArchitectureMatches(matches[1]) {
+				continue
+			}
+
+			newRelease := github.Release{
+				Version:     tag,
+				Name:        fileName,
+				DownloadUrl: fmt.Sprintf("%s/v2/%s/blobs/%s", registry.endpoint(), repository, layer.Digest),
+				Checksum:    strings.TrimPrefix(layer.Digest, "sha256:"),
+			}
+
+			retval = append(retval, newRelease)
+			break
+		}
+	}
+
+	github.SortNewestFirst(retval)
+
+	return retval, nil
+}
+
+// GetVersionsForImage gets a release for each tag in a container image repository that looks like a
+// version (so tags like latest are skipped).  The download url of each release is the image reference
+func GetVersionsForImage(registry Registry, repository string) ([]github.Release, error) {
+	retval := []github.Release{}
+
+	headers, err := registry.AuthHeaders(repository)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"repository": repository,
+		}).Error("problem authenticating with the registry")
+		return retval, err
+	}
+
+	tags, err := registry.listTags(repository, headers)
+	if err != nil {
+		return retval, err
+	}
+
+	imageName := strings.TrimPrefix(strings.TrimPrefix(registry.endpoint(), "https://"), "http://") + "/" + repository
+	for _, tag := range tags {
+		if _, err := version.NewVersion(tag); err != nil {
+			continue
+		}
+
+		retval = append(retval, github.Release{
+			Version:     tag,
+			DownloadUrl: imageName + ":" + tag,
+		})
+	}
+
+	github.SortNewestFirst(retval)
+
+	return retval, nil
+}
+
+// DownloadFile downloads a blob from the repository to a temporary location and returns the temporary location
+func DownloadFile(registry Registry, repository, blobUrl string) (string, error) {
+	headers, err := registry.AuthHeaders(repository)
+	if err != nil {
+		return "", err
+	}
+
+	return github.DownloadFileWithHeaders(blobUrl, headers)
+}
+
+// AuthHeaders gets the request headers needed to pull from the given repository.  If the registry asks for a
+// bearer token, one is requested from its token service (using the username and password, if set)
+func (registry Registry) AuthHeaders(repository string) (map[string]string, error) {
+	retval := map[string]string{}
+
+	if registry.Token != "" {
+		retval["Authorization"] = "Bearer " + registry.Token
+		return retval, nil
+	}
+
+	//	Ask the registry how it wants us to authenticate
+	resp, err := http.Get(registry.endpoint() + "/v2/")
+	if err != nil {
+		return retval, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return retval, nil
+	}
+
+	scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	switch strings.ToLower(scheme) {
+	case "basic":
+		retval["Authorization"] = "Basic " + basicAuth(registry.Username, registry.Password)
+	case "bearer":
+		token, err := registry.getBearerToken(params["realm"], params["service"], fmt.Sprintf("repository:%s:pull", repository))
+		if err != nil {
+			return retval, err
+		}
+		retval["Authorization"] = "Bearer " + token
+	default:
+		return retval, fmt.Errorf("unsupported registry authentication scheme: %s", scheme)
+	}
+
+	return retval, nil
+}
+
+// getBearerToken gets a bearer token from the registry's token service
+func (registry Registry) getBearerToken(realm, service, scope string) (string, error) {
+	if realm == "" {
+		return "", fmt.Errorf("the registry did not provide a token realm")
+	}
+
+	query := url.Values{}
+	if service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+
+	clientRequest, err := http.NewRequest("GET", realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if registry.Username != "" {
+		clientRequest.SetBasicAuth(registry.Username, registry.Password)
+	}
+
+	resp, err := http.DefaultClient.Do(clientRequest)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("unexpected response status from the token service: %s", resp.Status)
+	}
+
+	tokenResponse := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", err
+	}
+
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+
+	return tokenResponse.AccessToken, nil
+}
+
+// getJSON gets a url from the registry and decodes the JSON response
+func (registry Registry) getJSON(requestUrl string, headers map[string]string, accept string, target interface{}) (*http.Response, error) {
+	clientRequest, err := http.NewRequest("GET", requestUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	clientRequest.Header.Set("Accept", accept)
+	for name, value := range headers {
+		clientRequest.Header.Set(name, value)
+	}
+
+	resp, err := http.DefaultClient.Do(clientRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	return resp, json.NewDecoder(resp.Body).Decode(target)
+}
+
+// listTags lists all the tags in the repository, following the pagination links
+func (registry Registry) listTags(repository string, headers map[string]string) ([]string, error) {
+	retval := []string{}
+
+	nextUrl := fmt.Sprintf("%s/v2/%s/tags/list", registry.endpoint(), repository)
+	for nextUrl != "" {
+		page := tagList{}
+		resp, err := registry.getJSON(nextUrl, headers, "application/json", &page)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"repository": repository,
+			}).Error("problem listing tags in the registry")
+			return retval, err
+		}
+
+		retval = append(retval, page.Tags...)
+		nextUrl = nextLink(registry.endpoint(), resp.Header.Get("Link"))
+	}
+
+	return retval, nil
+}
+
+// endpoint gets the registry endpoint without a trailing slash
+func (registry Registry) endpoint() string {
+	return strings.TrimSuffix(registry.Endpoint, "/")
+}
+
+// isDebMediaType returns true if the media type is one of the .deb media types
+func isDebMediaType(mediaType string) bool {
+	for _, debType := range DebMediaTypes {
+		if mediaType == debType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseChallenge parses a WWW-Authenticate header into its scheme and parameters
+func parseChallenge(header string) (string, map[string]string) {
+	params := map[string]string{}
+
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	for _, param := range challengeParamRegex.FindAllStringSubmatch(parts[1], -1) {
+		params[strings.ToLower(param[1])] = param[2]
+	}
+
+	return parts[0], params
+}
+
+// nextLink gets the next page url from a Link header (or an empty string if there isn't one)
+func nextLink(endpoint, header string) string {
+	matches := nextLinkRegex.FindStringSubmatch(header)
+	if matches == nil {
+		return ""
+	}
+
+	if strings.HasPrefix(matches[1], "/") {
+		return endpoint + matches[1]
+	}
+
+	return matches[1]
+}
+
+// basicAuth encodes a username and password for basic auth
+func basicAuth(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
@@ -0,0 +1,150 @@
+package oci_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/danesparza/appupgrade/oci"
+	"github.com/danesparza/appupgrade/system"
+)
+
+func TestOci_GetVersionsForRepository_BearerToken_Successful(t *testing.T) {
+
+	//	Arrange
+	arch := system.GetArchitecture()
+	blob := []byte("package contents")
+	blobHash := sha256.Sum256(blob)
+	digest := "sha256:" + hex.EncodeToString(blobHash[:])
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		//	The token service
+		if req.URL.Path == "/token" {
+			username, password, _ := req.BasicAuth()
+			if username != "builder" || password != "secret" || req.URL.Query().Get("scope") != "repository:apps/daydash:pull" {
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(rw, `{"token": "testtoken"}`)
+			return
+		}
+
+		if req.Header.Get("Authorization") != "Bearer testtoken" {
+			rw.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry"`, server.URL))
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch req.URL.Path {
+		case "/v2/apps/daydash/tags/list":
+			fmt.Fprint(rw, `{"name": "apps/daydash", "tags": ["v1.0.1", "v1.0.2"]}`)
+		case "/v2/apps/daydash/manifests/v1.0.1":
+			fmt.Fprint(rw, `{"schemaVersion": 2, "layers": [{"mediaType": "application/vnd.debian.binary-package", "digest": "sha256:1111", "annotations": {"org.opencontainers.image.title": "daydash_1.0.1_some-other-arch.deb"}}]}`)
+		case "/v2/apps/daydash/manifests/v1.0.2":
+			fmt.Fprintf(rw, `{"schemaVersion": 2, "layers": [
+				{"mediaType": "text/plain", "digest": "sha256:2222"},
+				{"mediaType": "application/vnd.debian.binary-package", "digest": "%s", "annotations": {"org.opencontainers.image.title": "daydash_1.0.2_%s.deb"}}
+			]}`, digest, arch)
+		case "/v2/apps/daydash/blobs/" + digest:
+			rw.Write(blob)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	registry := oci.Registry{
+		Endpoint: server.URL,
+		Username: "builder",
+		Password: "secret",
+	}
+
+	//	Act
+	releases, err := oci.GetVersionsForRepository(registry, "apps/daydash")
+
+	//	Assert
+	if err != nil {
+		t.Errorf("GetVersionsForRepository - Should get versions without error, but got: %s", err)
+	}
+
+	if len(releases) != 1 {
+		t.Fatalf("GetVersionsForRepository failed: Expected one release for this architecture, but got %d", len(releases))
+	}
+
+	if releases[0].Version != "v1.0.2" || releases[0].Checksum != hex.EncodeToString(blobHash[:]) {
+		t.Errorf("GetVersionsForRepository failed: Unexpected release: %+v", releases[0])
+	}
+
+	packageFile, err := oci.DownloadFile(registry, "apps/daydash", releases[0].DownloadUrl)
+	if err != nil {
+		t.Fatalf("DownloadFile - Should download without error, but got: %s", err)
+	}
+	defer os.Remove(packageFile)
+
+	contents, _ := ioutil.ReadFile(packageFile)
+	if string(contents) != string(blob) {
+		t.Errorf("DownloadFile failed: Unexpected file contents: %s", contents)
+	}
+}
+
+func TestOci_ParseRepositoryURL_Successful(t *testing.T) {
+
+	//	Act
+	endpoint, repository, err := oci.ParseRepositoryURL("oci://registry.example.com/apps/daydash")
+
+	//	Assert
+	if err != nil || endpoint != "https://registry.example.com" || repository != "apps/daydash" {
+		t.Errorf("ParseRepositoryURL failed: Unexpected result %s %s (%v)", endpoint, repository, err)
+	}
+}
+
+func TestOci_ParseRepositoryURL_PlainHTTP_Successful(t *testing.T) {
+
+	//	Act
+	endpoint, repository, err := oci.ParseRepositoryURL("oci+http://localhost:5000/apps/daydash")
+
+	//	Assert
+	if err != nil || endpoint != "http://localhost:5000" || repository != "apps/daydash" {
+		t.Errorf("ParseRepositoryURL failed: Unexpected result %s %s (%v)", endpoint, repository, err)
+	}
+
+	if !oci.IsOCIURL("oci+http://localhost:5000/apps/daydash") {
+		t.Errorf("IsOCIURL failed: Expected an oci+http url to be an oci url")
+	}
+}
+
+func TestOci_GetVersionsForRepository_NoTitle_NamedFromRepositoryAndTag(t *testing.T) {
+
+	//	Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case "/v2/apps/daydash/tags/list":
+			fmt.Fprint(rw, `{"name": "apps/daydash", "tags": ["1.0.2"]}`)
+		case "/v2/apps/daydash/manifests/1.0.2":
+			fmt.Fprint(rw, `{"schemaVersion": 2, "layers": [{"mediaType": "application/vnd.debian.binary-package", "digest": "sha256:2222"}]}`)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	//	Act
+	releases, err := oci.GetVersionsForRepository(oci.Registry{Endpoint: server.URL}, "apps/daydash")
+
+	//	Assert
+	if err != nil || len(releases) != 1 {
+		t.Fatalf("GetVersionsForRepository failed: Expected one release, but got %+v (%v)", releases, err)
+	}
+
+	if releases[0].Name != "daydash_1.0.2.deb" {
+		t.Errorf("GetVersionsForRepository failed: Expected the release to be named from the repository and tag, but got %s", releases[0].Name)
+	}
+}
@@ -0,0 +1,203 @@
+package pkgmgr
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/danesparza/appupgrade/dpkg"
+	log "github.com/sirupsen/logrus"
+)
+
+// Apt installs package files with apt-get, so any new dependencies are installed (and recorded) as well
+type Apt struct{}
+
+// aptOptions are passed to every apt-get run so it never waits for input
+var aptOptions = []string{"-y", "-q"}
+
+// aptInstallOptions are passed to apt-get install (and its simulation), so an older version can be installed
+// (a rollback, or a restore after a failed update).  Without it apt-get -y refuses to downgrade
+var aptInstallOptions = []string{"--allow-downgrades"}
+
+// Name gets the name of the package manager
+func (a Apt) Name() string {
+	return "apt"
+}
+
+// PackageFormat gets the type of package file the package manager installs
+func (a Apt) PackageFormat() string {
+	return FormatDeb
+}
+
+// GetCurrentVersionForPackage returns the current installed version for a given package
+func (a Apt) GetCurrentVersionForPackage(packageName string) (string, error) {
+	currentVersion, err := dpkg.GetCurrentVersionForPackage(packageName)
+	return currentVersion, notInstalled(packageName, err)
+}
+
+// RemovePackage removes the given package with apt-get remove
+func (a Apt) RemovePackage(packageName string) (string, error) {
+	log.WithFields(log.Fields{
+		"package": packageName,
+	}).Debug("requested package remove")
+
+	args := append([]string{"remove"}, aptOptions...)
+	retval, err := runAptGet(append(args, packageName)...)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"output": retval,
+		}).Error("problem running apt-get remove")
+		return retval, err
+	}
+
+	log.WithFields(log.Fields{
+		"package": packageName,
+		"output":  retval,
+	}).Debug("removed package")
+
+	return retval, nil
+}
+
+// PurgePackage removes the given package and its configuration with apt-get purge
+func (a Apt) PurgePackage(packageName string) (string, error) {
+	log.WithFields(log.Fields{
+		"package": packageName,
+	}).Debug("requested package purge")
+
+	args := append([]string{"purge"}, aptOptions...)
+	retval, err := runAptGet(append(args, packageName)...)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"output": retval,
+		}).Error("problem running apt-get purge")
+		return retval, err
+	}
+
+	log.WithFields(log.Fields{
+		"package": packageName,
+		"output":  retval,
+	}).Debug("purged package")
+
+	return retval, nil
+}
+
+// InstallPackage installs the given deb file (and its dependencies) with apt-get install
+func (a Apt) InstallPackage(request InstallRequest) (string, error) {
+	log.WithFields(log.Fields{
+		"package":     request.Package,
+		"packageFile": request.Path,
+	}).Debug("requested package installation")
+
+	//	apt-get only treats the argument as a file if it looks like a path
+	absPath, err := filepath.Abs(request.Path)
+	if err != nil {
+		return "", err
+	}
+
+	if err := preseed(request); err != nil {
+		return "", err
+	}
+
+	args := append(append([]string{"install"}, aptOptions...), aptInstallOptions...)
+	for _, option := range dpkgConffileOptions[request.ConffilePolicy] {
+		args = append(args, "-o", "Dpkg::Options::="+option)
+	}
+
+	retval, err := installKeepingConffiles(request, func() (string, error) {
+		return runAptGet(append(args, absPath)...)
+	})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"output": retval,
+		}).Error("problem running apt-get install")
+		return retval, err
+	}
+
+	log.WithFields(log.Fields{
+		"package":     request.Package,
+		"packageFile": request.Path,
+		"output":      retval,
+	}).Debug("installed package")
+
+	return retval, nil
+}
+
+// VerifyPackage checks the installed files of the package with dpkg --verify
+func (a Apt) VerifyPackage(packageName string) ([]string, error) {
+	return dpkg.VerifyPackage(packageName)
+}
+
+// RepairPackages finishes configuring packages that were left half done (with dpkg --configure -a)
+func (a Apt) RepairPackages() ([]string, error) {
+	return repairDebPackages()
+}
+
+// GetConffiles gets the configuration files of the installed package
+func (a Apt) GetConffiles(packageName string) (map[string]string, error) {
+	return dpkg.GetConffiles(packageName)
+}
+
+// SimulateInstall checks what installing the deb file (and its dependencies) would do with apt-get -s
+func (a Apt) SimulateInstall(request InstallRequest) (Simulation, error) {
+	retval := Simulation{}
+
+	absPath, err := filepath.Abs(request.Path)
+	if err != nil {
+		return retval, err
+	}
+
+	args := append([]string{"-s", "install"}, aptInstallOptions...)
+	for _, option := range dpkgConffileOptions[request.ConffilePolicy] {
+		args = append(args, "-o", "Dpkg::Options::="+option)
+	}
+
+	output, err := runAptGet(append(args, absPath)...)
+	retval.Output = output
+	retval.Changes = ParseAptSimulation(output)
+
+	conffiles, prompts, conffileErr := simulateDebConffiles(request)
+	retval.Conffiles = conffiles
+	retval.ConffilePrompts = prompts
+
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"output": output,
+		}).Debug("apt-get install simulation failed")
+		return retval, err
+	}
+
+	return retval, conffileErr
+}
+
+// SimulateRemove checks what removing (or purging) the package would do with apt-get -s.
+// Packages that would be removed along with it are included
+func (a Apt) SimulateRemove(packageName string, purge bool) (Simulation, error) {
+	action := "remove"
+	if purge {
+		action = "purge"
+	}
+
+	output, err := runAptGet("-s", action, packageName)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"output": output,
+		}).Debug("apt-get remove simulation failed")
+	}
+
+	return Simulation{
+		Output:  output,
+		Changes: ParseAptSimulation(output),
+	}, err
+}
+
+// runAptGet runs apt-get non-interactively and returns its trimmed output
+func runAptGet(args ...string) (string, error) {
+	cmd := exec.Command("apt-get", args...)
+	cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+
+	cmdOutput, err := cmd.CombinedOutput()
+
+	//	Remove leading/trailing whitespace if it exists:
+	return strings.TrimSpace(string(cmdOutput)), dpkg.CheckLockError(string(cmdOutput), err)
+}
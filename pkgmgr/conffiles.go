@@ -0,0 +1,156 @@
+package pkgmgr
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/danesparza/appupgrade/config"
+	"github.com/danesparza/appupgrade/dpkg"
+	log "github.com/sirupsen/logrus"
+)
+
+// Conffile actions
+const (
+	ConffileKept     = "kept"     // The package changed the file, but the installed version was kept
+	ConffileReplaced = "replaced" // The package changed the file, and the new version was installed
+	ConffileAdded    = "added"    // The package added a new configuration file
+)
+
+// ConffileChange describes what happened to a configuration file during an install
+type ConffileChange struct {
+	Path   string `json:"path"`   // The path of the configuration file
+	Action string `json:"action"` // What happened to the file: kept, replaced or added
+}
+
+// ConffileReporter can be implemented by a PackageManager that tracks the configuration files of packages
+type ConffileReporter interface {
+	// GetConffiles gets the configuration files of an installed package, and the checksum
+	// of the version of each file the package shipped
+	GetConffiles(packageName string) (map[string]string, error)
+}
+
+// dpkgConffileOptions maps conffile policies to dpkg options.  dpkg only asks about (and so only keeps)
+// configuration files that were edited.  keep-old also puts back the unedited ones -- see installKeepingConffiles
+var dpkgConffileOptions = map[string][]string{
+	config.ConffilesKeepOld:      {"--force-confold"},
+	config.ConffilesTakeNew:      {"--force-confnew"},
+	config.ConffilesKeepModified: {"--force-confdef", "--force-confold"},
+}
+
+// installKeepingConffiles runs install.  With the keep-old policy, the contents of the package's configuration
+// files are saved first and put back afterwards, since dpkg replaces the ones that weren't edited without asking
+func installKeepingConffiles(request InstallRequest, install func() (string, error)) (string, error) {
+	if request.ConffilePolicy != config.ConffilesKeepOld {
+		return install()
+	}
+
+	snapshot := snapshotConffiles(request.Package)
+
+	retval, err := install()
+	if err != nil {
+		return retval, err
+	}
+
+	return retval, restoreConffiles(snapshot)
+}
+
+// savedConffile is the contents (and mode) of a configuration file before an install
+type savedConffile struct {
+	contents []byte
+	mode     os.FileMode
+}
+
+// snapshotConffiles saves the contents of the installed package's configuration files.  Files that can't be read are skipped
+func snapshotConffiles(packageName string) map[string]savedConffile {
+	retval := map[string]savedConffile{}
+
+	conffiles, _ := dpkg.GetConffiles(packageName)
+	for path := range conffiles {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		retval[path] = savedConffile{contents: contents, mode: info.Mode().Perm()}
+	}
+
+	return retval
+}
+
+// restoreConffiles puts back configuration files the install changed.  Files the new version
+// removed aren't put back
+func restoreConffiles(snapshot map[string]savedConffile) error {
+	for path, saved := range snapshot {
+		current, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) || (err == nil && bytes.Equal(current, saved.contents)) {
+			continue
+		}
+
+		if err := ioutil.WriteFile(path, saved.contents, saved.mode); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"path": path,
+			}).Error("problem restoring the installed configuration file")
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"path": path,
+		}).Debug("kept the installed configuration file")
+	}
+
+	return nil
+}
+
+// CompareConffiles reports what happened to each configuration file the package changed, given the
+// configuration files before and after the install.  Unchanged files aren't included
+func CompareConffiles(before, after map[string]string) []ConffileChange {
+	retval := []ConffileChange{}
+
+	for path, shippedSum := range after {
+		previousSum, existed := before[path]
+
+		switch {
+		case !existed:
+			retval = append(retval, ConffileChange{Path: path, Action: ConffileAdded})
+		case previousSum == shippedSum:
+			//	The package didn't change it
+			continue
+		case fileMD5(path) == shippedSum:
+			retval = append(retval, ConffileChange{Path: path, Action: ConffileReplaced})
+		default:
+			retval = append(retval, ConffileChange{Path: path, Action: ConffileKept})
+		}
+	}
+
+	sort.Slice(retval, func(i, j int) bool {
+		return retval[i].Path < retval[j].Path
+	})
+
+	return retval
+}
+
+// fileMD5 gets the md5 checksum of a file, or an empty string if it can't be read
+func fileMD5(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
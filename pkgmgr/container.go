@@ -0,0 +1,202 @@
+package pkgmgr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/danesparza/appupgrade/config"
+	"github.com/danesparza/appupgrade/docker"
+	"github.com/danesparza/appupgrade/oci"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Container treats a docker container as the installed package.  The installed version is the tag of the
+// container's image.  Installing a version pulls that tag and recreates the container with the same configuration.
+// The old image is left in place, so going back to the previous version doesn't need a pull
+type Container struct {
+	Client        docker.Client
+	ContainerName string      // The name of the container (defaults to the package name)
+	Auth          docker.Auth // The registry login used to pull images (from the package's image source)
+}
+
+// NewContainer creates the container package manager for a package
+func NewContainer(pkg config.Package) Container {
+	retval := Container{
+		Client:        docker.Client{Socket: viper.GetString("docker.socket")},
+		ContainerName: pkg.Container,
+	}
+
+	if retval.ContainerName == "" {
+		retval.ContainerName = pkg.Name
+	}
+
+	//	Pull with the login of the package's image source (if it has one)
+	for _, src := range pkg.GetSources() {
+		if src.Type == "image" || oci.IsImageURL(src.URL) {
+			retval.Auth = docker.Auth{
+				Username:      src.Username,
+				Password:      src.Password,
+				RegistryToken: src.Token,
+			}
+			break
+		}
+	}
+
+	return retval
+}
+
+// Name gets the name of the package manager
+func (c Container) Name() string {
+	return "container"
+}
+
+// PackageFormat gets the type of package the package manager installs
+func (c Container) PackageFormat() string {
+	return FormatImage
+}
+
+// CanInstallFile returns false for every file: containers are installed from image releases (which don't have files)
+func (c Container) CanInstallFile(fileName string) bool {
+	return false
+}
+
+// GetCurrentVersionForPackage gets the image tag of the package's container
+func (c Container) GetCurrentVersionForPackage(packageName string) (string, error) {
+	current, err := c.Client.InspectContainer(c.ContainerName)
+	if errors.Is(err, docker.ErrNotFound) {
+		return "", fmt.Errorf("%w: %s", ErrNotInstalled, packageName)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, tag := docker.SplitImageReference(current.ImageReference())
+	if tag == "" {
+		return "", fmt.Errorf("the image of container %s doesn't have a version tag: %s", c.ContainerName, current.ImageReference())
+	}
+
+	log.WithFields(log.Fields{
+		"package":        packageName,
+		"container":      c.ContainerName,
+		"currentVersion": tag,
+	}).Debug("found current version for package")
+
+	return tag, nil
+}
+
+// RemovePackage stops and removes the package's container.  Its image is kept
+func (c Container) RemovePackage(packageName string) (string, error) {
+	current, err := c.Client.InspectContainer(c.ContainerName)
+	if err != nil {
+		return "", err
+	}
+
+	if current.State.Running {
+		if err := c.Client.StopContainer(current.ID); err != nil {
+			return "", err
+		}
+	}
+
+	if err := c.Client.RemoveContainer(current.ID); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Removed container %s", c.ContainerName), nil
+}
+
+// InstallPackage pulls the requested version of the container's image and recreates the container with it.
+// If the new container can't be started, the old container is put back
+func (c Container) InstallPackage(request InstallRequest) (string, error) {
+	current, err := c.Client.InspectContainer(c.ContainerName)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"container": c.ContainerName,
+		}).Error("problem inspecting the container")
+		return "", err
+	}
+
+	repository, _ := docker.SplitImageReference(current.ImageReference())
+	image := repository + ":" + request.Version
+
+	log.WithFields(log.Fields{
+		"package":   request.Package,
+		"container": c.ContainerName,
+		"image":     image,
+	}).Debug("requested package installation")
+
+	if err := c.Client.PullImage(repository, request.Version, c.Auth); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"image": image,
+		}).Error("problem pulling the image")
+		return "", err
+	}
+
+	//	Settings the old container got from its image aren't copied to the new one
+	previousImage, err := c.Client.InspectImage(current.Image)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"image": current.ImageReference(),
+		}).Error("problem inspecting the previous image")
+		return "", err
+	}
+
+	//	Move the old container out of the way (but keep it until the new one is running)
+	previousName := c.ContainerName + "-appupgrade-previous"
+	if current.State.Running {
+		if err := c.Client.StopContainer(current.ID); err != nil {
+			return "", err
+		}
+	}
+
+	if err := c.Client.RenameContainer(current.ID, previousName); err != nil {
+		c.restore(current, "")
+		return "", err
+	}
+
+	newID, err := c.Client.CreateContainer(c.ContainerName, image, current, previousImage)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"image": image,
+		}).Error("problem creating the new container")
+		c.restore(current, "")
+		return "", err
+	}
+
+	if err := c.Client.StartContainer(newID); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"image": image,
+		}).Error("problem starting the new container")
+		c.restore(current, newID)
+		return "", err
+	}
+
+	if err := c.Client.RemoveContainer(current.ID); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"container": previousName,
+		}).Warn("problem removing the previous container")
+	}
+
+	return fmt.Sprintf("Recreated container %s with image %s", c.ContainerName, image), nil
+}
+
+// restore puts the old container back after a failed install (removing the new container, if there is one)
+func (c Container) restore(previous docker.Container, newID string) {
+	if newID != "" {
+		c.Client.RemoveContainer(newID)
+	}
+
+	if err := c.Client.RenameContainer(previous.ID, c.ContainerName); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"container": c.ContainerName,
+		}).Error("problem restoring the name of the previous container")
+	}
+
+	if previous.State.Running {
+		if err := c.Client.StartContainer(previous.ID); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"container": c.ContainerName,
+			}).Error("problem restarting the previous container")
+		}
+	}
+}
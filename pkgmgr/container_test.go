@@ -0,0 +1,197 @@
+package pkgmgr_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/danesparza/appupgrade/docker"
+	"github.com/danesparza/appupgrade/pkgmgr"
+)
+
+// fakeDocker is a tiny docker engine api with a single container in it
+type fakeDocker struct {
+	sync.Mutex
+	containers map[string]map[string]interface{} // Containers by name
+	images     map[string]map[string]interface{} // Images by id
+	pulled     []string
+	calls      []string
+}
+
+func (f *fakeDocker) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.calls = append(f.calls, req.Method+" "+req.URL.Path)
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	findContainer := func(idOrName string) (string, map[string]interface{}) {
+		for name, container := range f.containers {
+			if name == idOrName || container["Id"] == idOrName {
+				return name, container
+			}
+		}
+		return "", nil
+	}
+
+	switch {
+	case req.Method == "POST" && req.URL.Path == "/images/create":
+		f.pulled = append(f.pulled, req.URL.Query().Get("fromImage")+":"+req.URL.Query().Get("tag"))
+		fmt.Fprint(rw, `{"status": "Pulling"}`+"\n"+`{"status": "Downloaded newer image"}`)
+	case req.Method == "GET" && len(parts) == 3 && parts[0] == "images" && parts[2] == "json":
+		image, ok := f.images[parts[1]]
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(rw, `{"message": "No such image"}`)
+			return
+		}
+		json.NewEncoder(rw).Encode(image)
+	case req.Method == "POST" && req.URL.Path == "/containers/create":
+		body := map[string]interface{}{}
+		json.NewDecoder(req.Body).Decode(&body)
+		id := fmt.Sprintf("new%d", len(f.containers))
+		f.containers[req.URL.Query().Get("name")] = map[string]interface{}{
+			"Id":     id,
+			"Config": map[string]interface{}{"Image": body["Image"], "Env": body["Env"]},
+			"State":  map[string]interface{}{"Running": false},
+		}
+		fmt.Fprintf(rw, `{"Id": "%s"}`, id)
+	case len(parts) == 3 && parts[0] == "containers":
+		name, container := findContainer(parts[1])
+		if container == nil {
+			rw.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(rw, `{"message": "No such container"}`)
+			return
+		}
+
+		switch parts[2] {
+		case "json":
+			json.NewEncoder(rw).Encode(container)
+		case "start":
+			container["State"] = map[string]interface{}{"Running": true}
+			rw.WriteHeader(http.StatusNoContent)
+		case "stop":
+			container["State"] = map[string]interface{}{"Running": false}
+			rw.WriteHeader(http.StatusNoContent)
+		case "rename":
+			delete(f.containers, name)
+			f.containers[req.URL.Query().Get("name")] = container
+			rw.WriteHeader(http.StatusNoContent)
+		}
+	case req.Method == "DELETE" && len(parts) == 2:
+		name, container := findContainer(parts[1])
+		if container == nil {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.containers, name)
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// startFakeDocker serves the fake docker engine api on a unix socket
+func startFakeDocker(t *testing.T, fake *fakeDocker) (string, func()) {
+	dir, err := ioutil.TempDir("", "appupgrade-docker-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Skipf("unix sockets are not available: %s", err)
+	}
+
+	server := &http.Server{Handler: fake}
+	go server.Serve(listener)
+
+	return socket, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestContainer_InstallPackage_RecreatesContainerWithNewTag(t *testing.T) {
+
+	//	Arrange
+	fake := &fakeDocker{
+		containers: map[string]map[string]interface{}{
+			"daydash": {
+				"Id":     "0123456789abcdef",
+				"Image":  "sha256:previous",
+				"Config": map[string]interface{}{"Image": "registry.example.com:5000/apps/daydash:1.0.1", "Env": []string{"APP_VERSION=1.0.1", "PORT=3000"}},
+				"State":  map[string]interface{}{"Running": true},
+			},
+		},
+		images: map[string]map[string]interface{}{
+			"sha256:previous": {
+				"Id":     "sha256:previous",
+				"Config": map[string]interface{}{"Env": []string{"APP_VERSION=1.0.1"}},
+			},
+		},
+	}
+	socket, stop := startFakeDocker(t, fake)
+	defer stop()
+
+	container := pkgmgr.Container{Client: docker.Client{Socket: socket}, ContainerName: "daydash"}
+
+	//	Act
+	installedVersion, installedErr := container.GetCurrentVersionForPackage("daydash")
+	_, err := container.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "1.0.2"})
+	newVersion, newErr := container.GetCurrentVersionForPackage("daydash")
+
+	//	Assert
+	if installedErr != nil || installedVersion != "1.0.1" {
+		t.Errorf("GetCurrentVersionForPackage - Expected 1.0.1 but got: %s (%v)", installedVersion, installedErr)
+	}
+
+	if err != nil {
+		t.Fatalf("InstallPackage - Should install without error, but got: %s (calls: %v)", err, fake.calls)
+	}
+
+	if len(fake.pulled) != 1 || fake.pulled[0] != "registry.example.com:5000/apps/daydash:1.0.2" {
+		t.Errorf("InstallPackage - Expected the new tag to be pulled, but got: %v", fake.pulled)
+	}
+
+	if newErr != nil || newVersion != "1.0.2" {
+		t.Errorf("GetCurrentVersionForPackage - Expected 1.0.2 after install but got: %s (%v)", newVersion, newErr)
+	}
+
+	recreated := fake.containers["daydash"]
+	if env := fmt.Sprint(recreated["Config"].(map[string]interface{})["Env"]); env != "[PORT=3000]" {
+		t.Errorf("InstallPackage - Expected the container's own configuration (and not the old image's) to be kept, but got env: %s", env)
+	}
+
+	if len(fake.containers) != 1 {
+		t.Errorf("InstallPackage - Expected the previous container to be removed, but got: %v", fake.containers)
+	}
+}
+
+func TestContainer_GetCurrentVersionForPackage_MissingContainer_ReturnsNotInstalled(t *testing.T) {
+
+	//	Arrange
+	fake := &fakeDocker{containers: map[string]map[string]interface{}{}}
+	socket, stop := startFakeDocker(t, fake)
+	defer stop()
+
+	container := pkgmgr.Container{Client: docker.Client{Socket: socket}, ContainerName: "daydash"}
+
+	//	Act
+	_, err := container.GetCurrentVersionForPackage("daydash")
+
+	//	Assert
+	if !errors.Is(err, pkgmgr.ErrNotInstalled) {
+		t.Errorf("GetCurrentVersionForPackage - Expected ErrNotInstalled, but got: %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package pkgmgr
+
+import (
+	"fmt"
+
+	"github.com/danesparza/appupgrade/dpkg"
+)
+
+// preseed sets the debconf answers in the request (if there are any)
+func preseed(request InstallRequest) error {
+	if len(request.Preseed) == 0 {
+		return nil
+	}
+
+	selections := []string{}
+	for _, answer := range request.Preseed {
+		owner := answer.Owner
+		if owner == "" {
+			owner = request.Package
+		}
+
+		selections = append(selections, fmt.Sprintf("%s %s %s %s", owner, answer.Question, answer.Type, answer.Value))
+	}
+
+	if _, err := dpkg.SetDebconfSelections(selections); err != nil {
+		return fmt.Errorf("problem setting debconf selections for %s: %v", request.Package, err)
+	}
+
+	return nil
+}
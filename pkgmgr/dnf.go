@@ -0,0 +1,113 @@
+package pkgmgr
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/danesparza/appupgrade/rpm"
+	"github.com/hashicorp/go-version"
+	log "github.com/sirupsen/logrus"
+)
+
+// Dnf installs package files with dnf, so any new dependencies are installed as well
+type Dnf struct{}
+
+// Name gets the name of the package manager
+func (d Dnf) Name() string {
+	return "dnf"
+}
+
+// PackageFormat gets the type of package file the package manager installs
+func (d Dnf) PackageFormat() string {
+	return FormatRPM
+}
+
+// GetCurrentVersionForPackage returns the current installed version for a given package
+func (d Dnf) GetCurrentVersionForPackage(packageName string) (string, error) {
+	currentVersion, err := rpm.GetCurrentVersionForPackage(packageName)
+	return currentVersion, notInstalled(packageName, err)
+}
+
+// RemovePackage removes the given package with dnf remove
+func (d Dnf) RemovePackage(packageName string) (string, error) {
+	log.WithFields(log.Fields{
+		"package": packageName,
+	}).Debug("requested package remove")
+
+	retval, err := runDnf("remove", "-y", "-q", packageName)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"output": retval,
+		}).Error("problem running dnf remove")
+		return retval, err
+	}
+
+	log.WithFields(log.Fields{
+		"package": packageName,
+		"output":  retval,
+	}).Debug("removed package")
+
+	return retval, nil
+}
+
+// InstallPackage installs the given rpm file (and its dependencies) with dnf install.  If the file is older than
+// the installed version (a rollback, or a restore after a failed update), dnf downgrade is used instead: dnf install
+// won't install an older version
+func (d Dnf) InstallPackage(request InstallRequest) (string, error) {
+	log.WithFields(log.Fields{
+		"package":     request.Package,
+		"packageFile": request.Path,
+	}).Debug("requested package installation")
+
+	//	dnf only treats the argument as a file if it looks like a path
+	absPath, err := filepath.Abs(request.Path)
+	if err != nil {
+		return "", err
+	}
+
+	action := "install"
+	if installedVersion, err := rpm.GetCurrentVersionForPackage(request.Package); err == nil && isOlderVersion(request.Version, installedVersion) {
+		action = "downgrade"
+	}
+
+	retval, err := runDnf(action, "-y", "-q", absPath)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"output": retval,
+		}).Error("problem running dnf " + action)
+		return retval, err
+	}
+
+	log.WithFields(log.Fields{
+		"package":     request.Package,
+		"packageFile": request.Path,
+		"output":      retval,
+	}).Debug("installed package")
+
+	return retval, nil
+}
+
+// isOlderVersion returns true if the requested version is older than the installed version.  Versions
+// that can't be compared aren't older
+func isOlderVersion(requestedVersion, installedVersion string) bool {
+	requested, err := version.NewVersion(strings.TrimPrefix(requestedVersion, "v"))
+	if err != nil {
+		return false
+	}
+
+	installed, err := version.NewVersion(strings.TrimPrefix(installedVersion, "v"))
+	if err != nil {
+		return false
+	}
+
+	return requested.LessThan(installed)
+}
+
+// runDnf runs dnf and returns its trimmed output
+func runDnf(args ...string) (string, error) {
+	cmdOutput, err := exec.Command("dnf", args...).CombinedOutput()
+
+	//	Remove leading/trailing whitespace if it exists:
+	return strings.TrimSpace(string(cmdOutput)), err
+}
@@ -0,0 +1,100 @@
+package pkgmgr
+
+import (
+	"github.com/danesparza/appupgrade/dpkg"
+)
+
+// Dpkg installs package files directly with dpkg.  Dependencies aren't resolved
+type Dpkg struct{}
+
+// Name gets the name of the package manager
+func (d Dpkg) Name() string {
+	return "dpkg"
+}
+
+// PackageFormat gets the type of package file the package manager installs
+func (d Dpkg) PackageFormat() string {
+	return FormatDeb
+}
+
+// GetCurrentVersionForPackage returns the current installed version for a given package
+func (d Dpkg) GetCurrentVersionForPackage(packageName string) (string, error) {
+	currentVersion, err := dpkg.GetCurrentVersionForPackage(packageName)
+	return currentVersion, notInstalled(packageName, err)
+}
+
+// RemovePackage removes the given package with dpkg -r
+func (d Dpkg) RemovePackage(packageName string) (string, error) {
+	return dpkg.RemovePackage(packageName)
+}
+
+// PurgePackage removes the given package and its configuration with dpkg --purge
+func (d Dpkg) PurgePackage(packageName string) (string, error) {
+	return dpkg.PurgePackage(packageName)
+}
+
+// InstallPackage installs the given deb file with dpkg -i
+func (d Dpkg) InstallPackage(request InstallRequest) (string, error) {
+	if err := preseed(request); err != nil {
+		return "", err
+	}
+
+	return installKeepingConffiles(request, func() (string, error) {
+		return dpkg.InstallPackageWithOptions(request.Path, dpkgConffileOptions[request.ConffilePolicy]...)
+	})
+}
+
+// VerifyPackage checks the installed files of the package with dpkg --verify
+func (d Dpkg) VerifyPackage(packageName string) ([]string, error) {
+	return dpkg.VerifyPackage(packageName)
+}
+
+// RepairPackages finishes configuring packages that were left half done (with dpkg --configure -a)
+func (d Dpkg) RepairPackages() ([]string, error) {
+	return repairDebPackages()
+}
+
+// GetConffiles gets the configuration files of the installed package
+func (d Dpkg) GetConffiles(packageName string) (map[string]string, error) {
+	return dpkg.GetConffiles(packageName)
+}
+
+// SimulateInstall checks what installing the deb file would do with dpkg --dry-run.  dpkg doesn't
+// resolve dependencies, so the only change is the package itself (missing dependencies fail the dry run)
+func (d Dpkg) SimulateInstall(request InstallRequest) (Simulation, error) {
+	retval := Simulation{}
+
+	output, err := dpkg.DryRunInstall(request.Path, dpkgConffileOptions[request.ConffilePolicy]...)
+	retval.Output = output
+
+	change := PackageChange{Package: request.Package, Action: ChangeInstall, Version: request.Version}
+	if info, infoErr := dpkg.GetPackageFileInfo(request.Path); infoErr == nil && info["Package"] != "" {
+		change.Package = info["Package"]
+		change.Version = info["Version"]
+	}
+	if currentVersion, currentErr := dpkg.GetCurrentVersionForPackage(change.Package); currentErr == nil {
+		change.Action = ChangeUpdate
+		change.PreviousVersion = currentVersion
+	}
+	retval.Changes = []PackageChange{change}
+
+	conffiles, prompts, conffileErr := simulateDebConffiles(request)
+	retval.Conffiles = conffiles
+	retval.ConffilePrompts = prompts
+
+	if err != nil {
+		return retval, err
+	}
+
+	return retval, conffileErr
+}
+
+// SimulateRemove checks what removing (or purging) the package would do with dpkg --dry-run
+func (d Dpkg) SimulateRemove(packageName string, purge bool) (Simulation, error) {
+	output, err := dpkg.DryRunRemove(packageName, purge)
+
+	return Simulation{
+		Output:  output,
+		Changes: []PackageChange{debRemoveChange(packageName, purge)},
+	}, err
+}
@@ -0,0 +1,176 @@
+package pkgmgr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/danesparza/appupgrade/config"
+	"github.com/danesparza/appupgrade/dpkg"
+	"github.com/danesparza/appupgrade/rpm"
+	"github.com/danesparza/appupgrade/system"
+	"github.com/spf13/viper"
+)
+
+// Package file formats
+const (
+	FormatDeb     = "deb"     // Debian packages (.deb files)
+	FormatRPM     = "rpm"     // RPM packages (.rpm files)
+	FormatTarball = "tarball" // Tarballs and single binaries
+	FormatImage   = "image"   // Container images.  Images are pulled by the package manager (nothing is downloaded first)
+)
+
+var (
+	// ErrUnknownPackageManager is returned when a package is configured with a package manager that doesn't exist
+	ErrUnknownPackageManager = errors.New("unknown package manager")
+
+	// ErrNotInstalled is returned when a package isn't installed
+	ErrNotInstalled = errors.New("package is not installed")
+
+	// ErrVerificationFailed is returned when the installed package isn't the requested version (or its files don't match)
+	ErrVerificationFailed = errors.New("package verification failed")
+
+	// ErrVersionNotKept is returned when a Switcher doesn't have the requested version any more
+	ErrVersionNotKept = errors.New("version is not kept")
+
+	// ErrBusy is returned when another process (apt, unattended-upgrades or an operator) is changing packages
+	ErrBusy = dpkg.ErrBusy
+)
+
+// InstallRequest describes a package file to install
+type InstallRequest struct {
+	Package string // The package name
+	Version string // The version of the package in the package file
+	Path    string // The local path of the package file
+
+	ConffilePolicy string           // What to do with changed configuration files (see config.GetConffilePolicy).  Only used by deb package managers
+	Preseed        []config.Preseed // Debconf answers to set before installing.  Only used by deb package managers
+}
+
+// PackageManager installs, removes and reports on packages on this machine
+type PackageManager interface {
+	// Name gets the name of the package manager (dpkg, apt, etc)
+	Name() string
+
+	// PackageFormat gets the type of package file the package manager installs (deb, rpm, tarball or image)
+	PackageFormat() string
+
+	// GetCurrentVersionForPackage returns the current installed version for a given package (or an error if it doesn't exist)
+	GetCurrentVersionForPackage(packageName string) (string, error)
+
+	// RemovePackage removes the given package
+	RemovePackage(packageName string) (string, error)
+
+	// InstallPackage installs the package file in the request
+	InstallPackage(request InstallRequest) (string, error)
+}
+
+// notInstalled translates the not installed errors of the dpkg and rpm packages into ErrNotInstalled
+func notInstalled(packageName string, err error) error {
+	if errors.Is(err, dpkg.ErrNotInstalled) || errors.Is(err, rpm.ErrNotInstalled) {
+		return fmt.Errorf("%w: %s", ErrNotInstalled, packageName)
+	}
+
+	return err
+}
+
+// WaitForLock waits (up to the dpkg.lock-timeout setting) for other processes to finish changing packages.  Only deb
+// package managers share a lock with apt and unattended-upgrades, so nothing waits for the others.  If it has to wait,
+// waiting is called first.  ErrBusy is returned if the timeout runs out
+func WaitForLock(packageManager PackageManager, waiting func()) error {
+	if packageManager.PackageFormat() != FormatDeb {
+		return nil
+	}
+
+	return dpkg.WaitForLock(viper.GetDuration("dpkg.lock-timeout"), waiting)
+}
+
+// Purger can be implemented by a PackageManager that can remove a package along with its configuration
+type Purger interface {
+	PurgePackage(packageName string) (string, error)
+}
+
+// Switcher can be implemented by a PackageManager that keeps earlier versions around, so it can switch back
+// to one without downloading it again.  ErrVersionNotKept is returned if the version isn't around any more
+type Switcher interface {
+	SwitchVersion(packageName, version string) (string, error)
+}
+
+// FileMatcher can be implemented by a PackageManager that decides for itself which release assets it can install
+type FileMatcher interface {
+	CanInstallFile(fileName string) bool
+}
+
+// Factory creates a package manager for a package
+type Factory func(pkg config.Package) (PackageManager, error)
+
+var (
+	factories     = map[string]Factory{}
+	factoriesLock sync.RWMutex
+)
+
+// Register makes a package manager factory available with the given name (in addition to the built in package managers)
+func Register(name string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	factories[name] = factory
+}
+
+// New gets the package manager with the given name for a package
+func New(name string, pkg config.Package) (PackageManager, error) {
+	switch name {
+	case "dpkg":
+		return Dpkg{}, nil
+	case "apt", "apt-get":
+		return Apt{}, nil
+	case "rpm":
+		return Rpm{}, nil
+	case "dnf":
+		return Dnf{}, nil
+	case "tarball":
+		return NewTarball(pkg), nil
+	case "container":
+		return NewContainer(pkg), nil
+	}
+
+	factoriesLock.RLock()
+	factory, registered := factories[name]
+	factoriesLock.RUnlock()
+
+	if registered {
+		return factory(pkg)
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownPackageManager, name)
+}
+
+// CanInstallFile returns true if the package manager can install the named package file on this machine:
+// the file has to be the right format, and built for this architecture (if the name says what it was built for)
+func CanInstallFile(packageManager PackageManager, fileName string) bool {
+	if matcher, ok := packageManager.(FileMatcher); ok {
+		return matcher.CanInstallFile(fileName)
+	}
+
+	if !strings.HasSuffix(fileName, "."+packageManager.PackageFormat()) {
+		return false
+	}
+
+	return system.ArchitectureMatches(system.GetPackageFileArchitecture(fileName))
+}
+
+// ForPackage gets the package manager configured for a package.  If the package
+// doesn't set one, the global package-manager setting is used
+func ForPackage(pkg config.Package) (PackageManager, error) {
+	name := pkg.PackageManager
+	if name == "" {
+		name = viper.GetString("package-manager")
+	}
+
+	if name == "" {
+		name = "dpkg"
+	}
+
+	return New(name, pkg)
+}
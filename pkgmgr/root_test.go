@@ -0,0 +1,1001 @@
+package pkgmgr_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danesparza/appupgrade/config"
+	"github.com/danesparza/appupgrade/pkgmgr"
+	"github.com/danesparza/appupgrade/system"
+	"github.com/spf13/viper"
+)
+
+// fakeAptGet records its arguments and environment instead of installing anything
+const fakeAptGet = `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args"
+echo "$DEBIAN_FRONTEND" > "$(dirname "$0")/frontend"
+echo "Setting up daydash (1.0.2) ..."
+`
+
+func writeFakeAptGet(t *testing.T) string {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "appupgrade-pkgmgr-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "apt-get"), []byte(fakeAptGet), 0755); err != nil {
+		t.Fatalf("WriteFile - Should write fake apt-get without error, but got: %s", err)
+	}
+
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile - Should read %s without error, but got: %s", path, err)
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+func TestApt_InstallPackage_UsesLocalFilePath(t *testing.T) {
+
+	//	Arrange
+	dir := writeFakeAptGet(t)
+	defer os.RemoveAll(dir)
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	//	Act
+	output, err := pkgmgr.Apt{}.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "1.0.2", Path: "daydash_1.0.2_armhf.deb"})
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("InstallPackage - Should install without error, but got: %s", err)
+	}
+
+	if output != "Setting up daydash (1.0.2) ..." {
+		t.Errorf("InstallPackage - Unexpected output: %s", output)
+	}
+
+	wd, _ := os.Getwd()
+	expectedArgs := "install -y -q --allow-downgrades " + filepath.Join(wd, "daydash_1.0.2_armhf.deb")
+	if args := readFile(t, filepath.Join(dir, "args")); args != expectedArgs {
+		t.Errorf("InstallPackage - Expected apt-get args '%s' but got '%s'", expectedArgs, args)
+	}
+
+	if frontend := readFile(t, filepath.Join(dir, "frontend")); frontend != "noninteractive" {
+		t.Errorf("InstallPackage - Expected DEBIAN_FRONTEND to be noninteractive but got '%s'", frontend)
+	}
+}
+
+func TestForPackage_PackageSettingOverridesGlobal(t *testing.T) {
+
+	//	Arrange
+	viper.Set("package-manager", "dpkg")
+	defer viper.Set("package-manager", nil)
+
+	//	Act
+	globalManager, globalErr := pkgmgr.ForPackage(config.Package{Name: "daydash"})
+	packageManager, packageErr := pkgmgr.ForPackage(config.Package{Name: "daydash", PackageManager: "apt"})
+	_, unknownErr := pkgmgr.ForPackage(config.Package{Name: "daydash", PackageManager: "pacman"})
+
+	//	Assert
+	if globalErr != nil || globalManager.Name() != "dpkg" {
+		t.Errorf("ForPackage - Expected the global dpkg package manager, but got: %v %v", globalManager, globalErr)
+	}
+
+	if packageErr != nil || packageManager.Name() != "apt" {
+		t.Errorf("ForPackage - Expected the package's apt package manager, but got: %v %v", packageManager, packageErr)
+	}
+
+	if !errors.Is(unknownErr, pkgmgr.ErrUnknownPackageManager) {
+		t.Errorf("ForPackage - Expected ErrUnknownPackageManager, but got: %v", unknownErr)
+	}
+}
+
+func TestCanInstallFile_ChecksFormatAndArchitecture(t *testing.T) {
+
+	//	Arrange
+	debArch := system.GetArchitecture()
+	rpmArch := system.GetRPMArchitecture()
+
+	tests := []struct {
+		packageManager pkgmgr.PackageManager
+		fileName       string
+		want           bool
+	}{
+		{pkgmgr.Dpkg{}, "daydash_1.0.2_" + debArch + ".deb", true},
+		{pkgmgr.Dpkg{}, "daydash_1.0.2_all.deb", true},
+		{pkgmgr.Dpkg{}, "daydash.deb", true},
+		{pkgmgr.Dpkg{}, "daydash_1.0.2_some-other-arch.deb", false},
+		{pkgmgr.Dpkg{}, "daydash-1.0.2-1." + rpmArch + ".rpm", false},
+		{pkgmgr.Dnf{}, "daydash-1.0.2-1." + rpmArch + ".rpm", true},
+		{pkgmgr.Dnf{}, "daydash-1.0.2-1.noarch.rpm", true},
+		{pkgmgr.Dnf{}, "daydash-1.0.2.rpm", true},
+		{pkgmgr.Dnf{}, "daydash-1.0.2-1.someotherarch.rpm", false},
+		{pkgmgr.Rpm{}, "daydash_1.0.2_" + debArch + ".deb", false},
+		{pkgmgr.Rpm{}, "daydash-1.0.2-1." + rpmArch + ".rpm", true},
+		{pkgmgr.Rpm{}, "daydash-1.0.2-1.noarch.rpm", true},
+		{pkgmgr.Rpm{}, "daydash-1.0.2-1.someotherarch.rpm", false},
+		{pkgmgr.Dnf{}, "daydash_1.0.2_" + debArch + ".deb", false},
+	}
+
+	for _, test := range tests {
+		//	Act
+		got := pkgmgr.CanInstallFile(test.packageManager, test.fileName)
+
+		//	Assert
+		if got != test.want {
+			t.Errorf("CanInstallFile(%s, %s) - Expected %v but got %v", test.packageManager.Name(), test.fileName, test.want, got)
+		}
+	}
+}
+
+// writeTarball writes a gzipped tarball with a single file in it
+func writeTarball(t *testing.T, dir, name, contents string) string {
+	tarballPath := filepath.Join(dir, name)
+	f, err := os.Create(tarballPath)
+	if err != nil {
+		t.Fatalf("Create - Should create tarball without error, but got: %s", err)
+	}
+	defer f.Close()
+
+	gzipWriter := gzip.NewWriter(f)
+	tarWriter := tar.NewWriter(gzipWriter)
+	tarWriter.WriteHeader(&tar.Header{Name: "bin/daydash", Mode: 0755, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+	tarWriter.Write([]byte(contents))
+	tarWriter.Close()
+	gzipWriter.Close()
+
+	return tarballPath
+}
+
+func TestTarball_InstallPackage_SwitchesCurrentVersion(t *testing.T) {
+
+	//	Arrange
+	dir, err := ioutil.TempDir("", "appupgrade-tarball-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tarball := pkgmgr.Tarball{Root: filepath.Join(dir, "opt", "daydash"), StateDir: filepath.Join(dir, "state")}
+	firstFile := writeTarball(t, dir, "daydash_1.0.1_linux_arm64.tar.gz", "version one")
+	secondFile := writeTarball(t, dir, "daydash_1.0.2_linux_arm64.tar.gz", "version two")
+
+	//	Act
+	_, notInstalledErr := tarball.GetCurrentVersionForPackage("daydash")
+	_, firstErr := tarball.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "v1.0.1", Path: firstFile})
+	_, secondErr := tarball.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "v1.0.2", Path: secondFile})
+	currentVersion, currentErr := tarball.GetCurrentVersionForPackage("daydash")
+
+	//	Assert
+	if !errors.Is(notInstalledErr, pkgmgr.ErrNotInstalled) {
+		t.Errorf("GetCurrentVersionForPackage - Expected ErrNotInstalled before install, but got: %v", notInstalledErr)
+	}
+
+	if firstErr != nil || secondErr != nil {
+		t.Fatalf("InstallPackage - Should install without error, but got: %v / %v", firstErr, secondErr)
+	}
+
+	if currentErr != nil || currentVersion != "v1.0.2" {
+		t.Errorf("GetCurrentVersionForPackage - Expected v1.0.2 but got: %s (%v)", currentVersion, currentErr)
+	}
+
+	if contents := readFile(t, filepath.Join(tarball.Root, "current", "bin", "daydash")); contents != "version two" {
+		t.Errorf("InstallPackage - Expected the current symlink to point at the new version, but got: %s", contents)
+	}
+
+	if contents := readFile(t, filepath.Join(tarball.Root, "releases", "v1.0.1", "bin", "daydash")); contents != "version one" {
+		t.Errorf("InstallPackage - Expected the previous version to be kept, but got: %s", contents)
+	}
+}
+
+// writeTarballEntries writes a gzipped tarball with the given entries (and a bit of contents for each regular file)
+func writeTarballEntries(t *testing.T, dir, name string, headers []tar.Header) string {
+	tarballPath := filepath.Join(dir, name)
+	f, err := os.Create(tarballPath)
+	if err != nil {
+		t.Fatalf("Create - Should create tarball without error, but got: %s", err)
+	}
+	defer f.Close()
+
+	gzipWriter := gzip.NewWriter(f)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, header := range headers {
+		header := header
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len("payload"))
+		}
+
+		tarWriter.WriteHeader(&header)
+		if header.Typeflag == tar.TypeReg {
+			tarWriter.Write([]byte("payload"))
+		}
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+
+	return tarballPath
+}
+
+func TestTarball_InstallPackage_MaliciousArchive_IsRefused(t *testing.T) {
+
+	//	Arrange
+	dir, err := ioutil.TempDir("", "appupgrade-tarball-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	outside := filepath.Join(dir, "outside")
+	os.MkdirAll(outside, 0755)
+
+	tarball := pkgmgr.Tarball{Root: filepath.Join(dir, "opt", "daydash"), StateDir: filepath.Join(dir, "state")}
+	archives := map[string][]tar.Header{
+		"absolute symlink": {
+			{Name: "lib", Linkname: outside, Typeflag: tar.TypeSymlink},
+			{Name: "lib/cron.d/x", Mode: 0644, Typeflag: tar.TypeReg},
+		},
+		"relative symlink": {
+			{Name: "lib", Linkname: "../../../../outside", Typeflag: tar.TypeSymlink},
+			{Name: "lib/cron.d/x", Mode: 0644, Typeflag: tar.TypeReg},
+		},
+		"write through symlink": {
+			{Name: "bin/", Mode: 0755, Typeflag: tar.TypeDir},
+			{Name: "lib", Linkname: "bin", Typeflag: tar.TypeSymlink},
+			{Name: "lib/x", Mode: 0644, Typeflag: tar.TypeReg},
+		},
+		"parent path": {
+			{Name: "../../../../outside/x", Mode: 0644, Typeflag: tar.TypeReg},
+		},
+	}
+
+	for name, headers := range archives {
+		packageFile := writeTarballEntries(t, dir, "daydash_1.0.2_linux_arm64.tar.gz", headers)
+
+		//	Act
+		_, err := tarball.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "v1.0.2", Path: packageFile})
+
+		//	Assert
+		if err == nil {
+			t.Errorf("InstallPackage - Expected the %s archive to be refused", name)
+		}
+
+		if entries, _ := ioutil.ReadDir(outside); len(entries) > 0 {
+			t.Fatalf("InstallPackage - Expected nothing to be written outside the release directory by the %s archive", name)
+		}
+
+		if _, err := os.Lstat(filepath.Join(tarball.Root, "current")); !os.IsNotExist(err) {
+			t.Errorf("InstallPackage - Expected the %s archive not to be switched to", name)
+		}
+	}
+}
+
+func TestTarball_InstallPackage_ReinstallCurrentVersion_KeepsCurrentValid(t *testing.T) {
+
+	//	Arrange
+	dir, err := ioutil.TempDir("", "appupgrade-tarball-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tarball := pkgmgr.Tarball{Root: filepath.Join(dir, "opt", "daydash"), StateDir: filepath.Join(dir, "state")}
+	firstFile := writeTarball(t, dir, "daydash_1.0.2_linux_arm64.tar.gz", "first unpack")
+	tarball.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "v1.0.2", Path: firstFile})
+	secondFile := writeTarball(t, dir, "daydash_1.0.2_linux_arm64.tar.gz", "second unpack")
+
+	//	Act
+	_, err = tarball.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "v1.0.2", Path: secondFile})
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("InstallPackage - Should reinstall without error, but got: %s", err)
+	}
+
+	if contents := readFile(t, filepath.Join(tarball.Root, "current", "bin", "daydash")); contents != "second unpack" {
+		t.Errorf("InstallPackage - Expected current to have the reinstalled files, but got: %s", contents)
+	}
+
+	if target, _ := os.Readlink(filepath.Join(tarball.Root, "current")); target != filepath.Join(tarball.Root, "releases", "v1.0.2") {
+		t.Errorf("InstallPackage - Expected current to point at the release directory, but got: %s", target)
+	}
+}
+
+func TestTarball_SwitchVersion_SwitchesBackWithoutUnpacking(t *testing.T) {
+
+	//	Arrange
+	dir, err := ioutil.TempDir("", "appupgrade-tarball-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tarball := pkgmgr.Tarball{Root: filepath.Join(dir, "opt", "daydash"), StateDir: filepath.Join(dir, "state")}
+	tarball.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "v1.0.1", Path: writeTarball(t, dir, "one.tar.gz", "version one")})
+	tarball.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "v1.0.2", Path: writeTarball(t, dir, "two.tar.gz", "version two")})
+
+	//	Act
+	_, switchErr := tarball.SwitchVersion("daydash", "v1.0.1")
+	currentVersion, _ := tarball.GetCurrentVersionForPackage("daydash")
+	_, missingErr := tarball.SwitchVersion("daydash", "v0.9.0")
+
+	//	Assert
+	if switchErr != nil || currentVersion != "v1.0.1" {
+		t.Errorf("SwitchVersion - Expected to switch back to v1.0.1, but got: %s (%v)", currentVersion, switchErr)
+	}
+
+	if contents := readFile(t, filepath.Join(tarball.Root, "current", "bin", "daydash")); contents != "version one" {
+		t.Errorf("SwitchVersion - Expected the current symlink to point at the previous version, but got: %s", contents)
+	}
+
+	if !errors.Is(missingErr, pkgmgr.ErrVersionNotKept) {
+		t.Errorf("SwitchVersion - Expected ErrVersionNotKept for a version that was never unpacked, but got: %v", missingErr)
+	}
+}
+
+func TestTarball_CanInstallFile_UsesArchitectureAndPattern(t *testing.T) {
+
+	//	Arrange
+	arch := system.GetArchitecture()
+	tarball := pkgmgr.Tarball{}
+	patterned := pkgmgr.Tarball{Asset: "daydash-*-server"}
+
+	//	Act & Assert
+	if !tarball.CanInstallFile("daydash_1.0.2_linux_" + arch + ".tar.gz") {
+		t.Errorf("CanInstallFile - Expected a tarball for this architecture to be installable")
+	}
+
+	if !tarball.CanInstallFile("daydash_linux_" + arch) {
+		t.Errorf("CanInstallFile - Expected a binary for this architecture to be installable")
+	}
+
+	if tarball.CanInstallFile("daydash_1.0.2_linux_s390x.tar.gz") && arch != "s390x" {
+		t.Errorf("CanInstallFile - Expected a tarball for another architecture to be skipped")
+	}
+
+	if tarball.CanInstallFile("daydash_1.0.2_" + arch + ".deb") {
+		t.Errorf("CanInstallFile - Expected a .deb file to be skipped")
+	}
+
+	if !patterned.CanInstallFile("daydash-1.0.2-server") || patterned.CanInstallFile("daydash-1.0.2-client") {
+		t.Errorf("CanInstallFile - Expected the asset pattern to be used")
+	}
+}
+
+func TestTarball_CanInstallFile_OtherPlatformsAndSource_AreSkipped(t *testing.T) {
+
+	arch := system.GetArchitecture()
+	tests := []struct {
+		fileName    string
+		installable bool
+	}{
+		{"myapp_1.0_linux_" + arch + ".tar.gz", true},
+		{"myapp-1.0-" + arch + ".tgz", true},
+		{"myapp-1.0.tar.gz", true},
+		{"myapp_1.0_darwin_" + arch + ".tar.gz", false},
+		{"myapp_1.0_macOS_" + arch + ".tar.gz", false},
+		{"myapp_1.0_windows_" + arch + ".tar.gz", false},
+		{"myapp_1.0_freebsd_" + arch + ".tar.gz", false},
+		{"myapp_1.0_openbsd_" + arch + ".tar.gz", false},
+		{"myapp-1.0-src.tar.gz", false},
+		{"myapp_1.0_source.tar.gz", false},
+	}
+
+	for _, test := range tests {
+		//	Act
+		installable := pkgmgr.Tarball{}.CanInstallFile(test.fileName)
+
+		//	Assert
+		if installable != test.installable {
+			t.Errorf("CanInstallFile(%s) - Expected %v but got %v", test.fileName, test.installable, installable)
+		}
+	}
+}
+
+func TestCompareConffiles_ReportsKeptReplacedAndAdded(t *testing.T) {
+
+	//	Arrange
+	dir, err := ioutil.TempDir("", "appupgrade-conffiles-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	md5sum := func(contents string) string {
+		sum := md5.Sum([]byte(contents))
+		return hex.EncodeToString(sum[:])
+	}
+
+	keptPath := filepath.Join(dir, "kept.conf")
+	replacedPath := filepath.Join(dir, "replaced.conf")
+	unchangedPath := filepath.Join(dir, "unchanged.conf")
+	addedPath := filepath.Join(dir, "added.conf")
+	ioutil.WriteFile(keptPath, []byte("edited by the operator"), 0644)
+	ioutil.WriteFile(replacedPath, []byte("new version"), 0644)
+	ioutil.WriteFile(unchangedPath, []byte("same"), 0644)
+	ioutil.WriteFile(addedPath, []byte("added"), 0644)
+
+	before := map[string]string{
+		keptPath:      md5sum("old version"),
+		replacedPath:  md5sum("old version"),
+		unchangedPath: md5sum("same"),
+	}
+
+	after := map[string]string{
+		keptPath:      md5sum("new version"),
+		replacedPath:  md5sum("new version"),
+		unchangedPath: md5sum("same"),
+		addedPath:     md5sum("added"),
+	}
+
+	//	Act
+	changes := pkgmgr.CompareConffiles(before, after)
+
+	//	Assert
+	expected := []pkgmgr.ConffileChange{
+		{Path: addedPath, Action: pkgmgr.ConffileAdded},
+		{Path: keptPath, Action: pkgmgr.ConffileKept},
+		{Path: replacedPath, Action: pkgmgr.ConffileReplaced},
+	}
+
+	if fmt.Sprint(changes) != fmt.Sprint(expected) {
+		t.Errorf("CompareConffiles - Expected %v but got %v", expected, changes)
+	}
+}
+
+func TestApt_InstallPackage_PassesConffilePolicyToDpkg(t *testing.T) {
+
+	//	Arrange
+	dir := writeFakeAptGet(t)
+	defer os.RemoveAll(dir)
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	//	Act
+	_, err := pkgmgr.Apt{}.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "1.0.2", Path: "/tmp/daydash.deb", ConffilePolicy: config.ConffilesKeepModified})
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("InstallPackage - Should install without error, but got: %s", err)
+	}
+
+	expectedArgs := "install -y -q --allow-downgrades -o Dpkg::Options::=--force-confdef -o Dpkg::Options::=--force-confold /tmp/daydash.deb"
+	if args := readFile(t, filepath.Join(dir, "args")); args != expectedArgs {
+		t.Errorf("InstallPackage - Expected apt-get args '%s' but got '%s'", expectedArgs, args)
+	}
+}
+
+func TestApt_InstallPackage_SetsPreseedAnswersFirst(t *testing.T) {
+
+	//	Arrange
+	dir := writeFakeAptGet(t)
+	defer os.RemoveAll(dir)
+
+	fakeSetSelections := "#!/bin/sh\ncat > \"$(dirname \"$0\")/selections\"\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "debconf-set-selections"), []byte(fakeSetSelections), 0755); err != nil {
+		t.Fatalf("WriteFile - Should write fake debconf-set-selections without error, but got: %s", err)
+	}
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	request := pkgmgr.InstallRequest{
+		Package: "daydash",
+		Version: "1.0.2",
+		Path:    "/tmp/daydash.deb",
+		Preseed: []config.Preseed{
+			{Question: "daydash/listen-port", Type: "string", Value: "3000"},
+			{Owner: "shared", Question: "shared/greeting", Type: "string", Value: "hello there"},
+		},
+	}
+
+	//	Act
+	_, err := pkgmgr.Apt{}.InstallPackage(request)
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("InstallPackage - Should install without error, but got: %s", err)
+	}
+
+	expected := "daydash daydash/listen-port string 3000\nshared shared/greeting string hello there"
+	if selections := readFile(t, filepath.Join(dir, "selections")); selections != expected {
+		t.Errorf("InstallPackage - Expected debconf selections '%s' but got '%s'", expected, selections)
+	}
+}
+
+func TestDpkg_GetCurrentVersionForPackage_NotInstalledStates(t *testing.T) {
+
+	//	Arrange
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "appupgrade-dpkg-query-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fakeDpkgQuery := `#!/bin/sh
+for last; do true; done
+case "$last" in
+	daydash) printf 'install ok installed|1.0.2' ;;
+	removed) printf 'deinstall ok config-files|1.0.1' ;;
+	*) echo "dpkg-query: no packages found matching $last" >&2; exit 1 ;;
+esac
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "dpkg-query"), []byte(fakeDpkgQuery), 0755); err != nil {
+		t.Fatalf("WriteFile - Should write fake dpkg-query without error, but got: %s", err)
+	}
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	//	Act
+	installedVersion, installedErr := pkgmgr.Dpkg{}.GetCurrentVersionForPackage("daydash")
+	_, removedErr := pkgmgr.Dpkg{}.GetCurrentVersionForPackage("removed")
+	_, missingErr := pkgmgr.Dpkg{}.GetCurrentVersionForPackage("missing")
+
+	//	Assert
+	if installedErr != nil || installedVersion != "1.0.2" {
+		t.Errorf("GetCurrentVersionForPackage - Expected 1.0.2 but got: %s (%v)", installedVersion, installedErr)
+	}
+
+	if !errors.Is(removedErr, pkgmgr.ErrNotInstalled) {
+		t.Errorf("GetCurrentVersionForPackage - Expected ErrNotInstalled for a removed package, but got: %v", removedErr)
+	}
+
+	if !errors.Is(missingErr, pkgmgr.ErrNotInstalled) {
+		t.Errorf("GetCurrentVersionForPackage - Expected ErrNotInstalled for an unknown package, but got: %v", missingErr)
+	}
+}
+
+func TestDpkg_VerifyPackage_ReportsChangedAndMissingFiles(t *testing.T) {
+
+	//	Arrange
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "appupgrade-dpkg-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	//	Output from dpkg --verify for a package with a changed binary, a deleted file, an edited
+	//	configuration file and a deleted configuration file (dpkg exits with 1 when files don't match)
+	fakeDpkg := `#!/bin/sh
+cat <<'OUTPUT'
+??5??????   /usr/bin/daydash
+missing     /usr/share/daydash/index.html
+??5?????? c /etc/daydash/config.yaml
+missing   c /etc/daydash/extra.yaml
+OUTPUT
+exit 1
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "dpkg"), []byte(fakeDpkg), 0755); err != nil {
+		t.Fatalf("WriteFile - Should write fake dpkg without error, but got: %s", err)
+	}
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	//	Act
+	mismatched, err := pkgmgr.Dpkg{}.VerifyPackage("daydash")
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("VerifyPackage - Should verify without error, but got: %s", err)
+	}
+
+	expected := []string{"/usr/bin/daydash", "/usr/share/daydash/index.html"}
+	if fmt.Sprint(mismatched) != fmt.Sprint(expected) {
+		t.Errorf("VerifyPackage - Expected the changed and missing files %v (without configuration files), but got %v", expected, mismatched)
+	}
+}
+
+// writeFakeRpmTools writes a fake rpm (which answers version queries like rpm -q --qf) and a fake dnf.
+// Both record their arguments instead of installing anything
+func writeFakeRpmTools(t *testing.T) string {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "appupgrade-rpm-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+
+	fakeRpm := `#!/bin/sh
+if [ "$1" = "-q" ]; then
+	for last; do true; done
+	case "$last" in
+		daydash) printf '1.0.2' ;;
+		*) echo "package $last is not installed"; exit 1 ;;
+	esac
+	exit 0
+fi
+echo "$@" > "$(dirname "$0")/args"
+`
+	fakeDnf := `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args"
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "rpm"), []byte(fakeRpm), 0755); err != nil {
+		t.Fatalf("WriteFile - Should write fake rpm without error, but got: %s", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "dnf"), []byte(fakeDnf), 0755); err != nil {
+		t.Fatalf("WriteFile - Should write fake dnf without error, but got: %s", err)
+	}
+
+	return dir
+}
+
+func TestRpm_GetCurrentVersionForPackage_InstalledAndNotInstalled(t *testing.T) {
+
+	//	Arrange
+	dir := writeFakeRpmTools(t)
+	defer os.RemoveAll(dir)
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	for _, packageManager := range []pkgmgr.PackageManager{pkgmgr.Rpm{}, pkgmgr.Dnf{}} {
+		//	Act
+		installedVersion, installedErr := packageManager.GetCurrentVersionForPackage("daydash")
+		_, missingErr := packageManager.GetCurrentVersionForPackage("missing")
+
+		//	Assert
+		if installedErr != nil || installedVersion != "1.0.2" {
+			t.Errorf("%s GetCurrentVersionForPackage - Expected 1.0.2 but got: %s (%v)", packageManager.Name(), installedVersion, installedErr)
+		}
+
+		if !errors.Is(missingErr, pkgmgr.ErrNotInstalled) {
+			t.Errorf("%s GetCurrentVersionForPackage - Expected ErrNotInstalled for a package that isn't installed, but got: %v", packageManager.Name(), missingErr)
+		}
+	}
+}
+
+func TestRpm_InstallPackage_AllowsOlderVersions(t *testing.T) {
+
+	//	Arrange
+	dir := writeFakeRpmTools(t)
+	defer os.RemoveAll(dir)
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	//	Act
+	_, err := pkgmgr.Rpm{}.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "1.0.1", Path: "/tmp/daydash-1.0.1-1.noarch.rpm"})
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("InstallPackage - Should install without error, but got: %s", err)
+	}
+
+	expectedArgs := "-U --oldpackage /tmp/daydash-1.0.1-1.noarch.rpm"
+	if args := readFile(t, filepath.Join(dir, "args")); args != expectedArgs {
+		t.Errorf("InstallPackage - Expected rpm args '%s' but got '%s'", expectedArgs, args)
+	}
+}
+
+func TestDnf_InstallPackage_UsesLocalFilePath(t *testing.T) {
+
+	//	Arrange
+	dir := writeFakeRpmTools(t)
+	defer os.RemoveAll(dir)
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	//	Act
+	_, err := pkgmgr.Dnf{}.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "1.0.2", Path: "daydash-1.0.2-1.noarch.rpm"})
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("InstallPackage - Should install without error, but got: %s", err)
+	}
+
+	wd, _ := os.Getwd()
+	expectedArgs := "install -y -q " + filepath.Join(wd, "daydash-1.0.2-1.noarch.rpm")
+	if args := readFile(t, filepath.Join(dir, "args")); args != expectedArgs {
+		t.Errorf("InstallPackage - Expected dnf args '%s' but got '%s'", expectedArgs, args)
+	}
+}
+
+func TestDnf_InstallPackage_OlderVersion_Downgrades(t *testing.T) {
+
+	//	Arrange
+	dir := writeFakeRpmTools(t)
+	defer os.RemoveAll(dir)
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	//	Act
+	_, err := pkgmgr.Dnf{}.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "1.0.1", Path: "/tmp/daydash-1.0.1-1.noarch.rpm"})
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("InstallPackage - Should install without error, but got: %s", err)
+	}
+
+	expectedArgs := "downgrade -y -q /tmp/daydash-1.0.1-1.noarch.rpm"
+	if args := readFile(t, filepath.Join(dir, "args")); args != expectedArgs {
+		t.Errorf("InstallPackage - Expected dnf args '%s' but got '%s'", expectedArgs, args)
+	}
+}
+
+func TestParseAptSimulation_ReportsInstallsUpdatesAndRemovals(t *testing.T) {
+
+	//	Arrange
+	output := `NOTE: This is only a simulation!
+Reading package lists...
+The following NEW packages will be installed:
+  libnew1
+Inst libnew1 (2.0-1 Debian:stable [arm64])
+Inst daydash [1.0.1] (1.0.2 local-deb [arm64])
+Remv libold [0.9-3]
+Conf libnew1 (2.0-1 Debian:stable [arm64])
+Conf daydash (1.0.2 local-deb [arm64])`
+
+	//	Act
+	changes := pkgmgr.ParseAptSimulation(output)
+
+	//	Assert
+	expected := []pkgmgr.PackageChange{
+		{Package: "libnew1", Action: pkgmgr.ChangeInstall, Version: "2.0-1"},
+		{Package: "daydash", Action: pkgmgr.ChangeUpdate, Version: "1.0.2", PreviousVersion: "1.0.1"},
+		{Package: "libold", Action: pkgmgr.ChangeRemove, PreviousVersion: "0.9-3"},
+	}
+
+	if fmt.Sprint(changes) != fmt.Sprint(expected) {
+		t.Errorf("ParseAptSimulation - Expected %v but got %v", expected, changes)
+	}
+}
+
+func TestPredictConffiles_ReportsPromptsAndPolicyOutcome(t *testing.T) {
+
+	//	Arrange
+	dir, err := ioutil.TempDir("", "appupgrade-conffiles-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	md5sum := func(contents string) string {
+		sum := md5.Sum([]byte(contents))
+		return hex.EncodeToString(sum[:])
+	}
+
+	editedPath := filepath.Join(dir, "edited.conf")
+	untouchedPath := filepath.Join(dir, "untouched.conf")
+	ioutil.WriteFile(editedPath, []byte("edited by the operator"), 0644)
+	ioutil.WriteFile(untouchedPath, []byte("old version"), 0644)
+
+	installed := map[string]string{
+		editedPath:    md5sum("old version"),
+		untouchedPath: md5sum("old version"),
+	}
+
+	shipped := map[string]string{
+		editedPath:    md5sum("new version"),
+		untouchedPath: md5sum("new version"),
+	}
+
+	//	Act
+	keepChanges, keepPrompts := pkgmgr.PredictConffiles(installed, shipped, config.ConffilesKeepModified)
+	takeChanges, _ := pkgmgr.PredictConffiles(installed, shipped, config.ConffilesTakeNew)
+	oldChanges, _ := pkgmgr.PredictConffiles(installed, shipped, config.ConffilesKeepOld)
+
+	//	Assert
+	if len(keepPrompts) != 1 || keepPrompts[0] != editedPath {
+		t.Errorf("PredictConffiles - Expected only the edited file to prompt, but got: %v", keepPrompts)
+	}
+
+	expectedKeep := []pkgmgr.ConffileChange{
+		{Path: editedPath, Action: pkgmgr.ConffileKept},
+		{Path: untouchedPath, Action: pkgmgr.ConffileReplaced},
+	}
+	if fmt.Sprint(keepChanges) != fmt.Sprint(expectedKeep) {
+		t.Errorf("PredictConffiles - Expected %v with keep-modified but got %v", expectedKeep, keepChanges)
+	}
+
+	expectedTake := []pkgmgr.ConffileChange{
+		{Path: editedPath, Action: pkgmgr.ConffileReplaced},
+		{Path: untouchedPath, Action: pkgmgr.ConffileReplaced},
+	}
+	if fmt.Sprint(takeChanges) != fmt.Sprint(expectedTake) {
+		t.Errorf("PredictConffiles - Expected %v with take-new but got %v", expectedTake, takeChanges)
+	}
+
+	expectedOld := []pkgmgr.ConffileChange{
+		{Path: editedPath, Action: pkgmgr.ConffileKept},
+		{Path: untouchedPath, Action: pkgmgr.ConffileKept},
+	}
+	if fmt.Sprint(oldChanges) != fmt.Sprint(expectedOld) {
+		t.Errorf("PredictConffiles - Expected %v with keep-old but got %v", expectedOld, oldChanges)
+	}
+}
+
+func TestDpkg_InstallPackage_ConffilePolicy_KeepsUneditedFilesOnlyWithKeepOld(t *testing.T) {
+
+	//	Arrange
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "appupgrade-conffiles-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	//	The fake dpkg-query lists one (unedited) configuration file, and the fake dpkg replaces it the way dpkg -i would
+	confPath := filepath.Join(dir, "daydash.conf")
+	fakeDpkgQuery := fmt.Sprintf("#!/bin/sh\nprintf ' %s 0123456789abcdef0123456789abcdef\\n'\n", confPath)
+	fakeDpkg := fmt.Sprintf("#!/bin/sh\nprintf 'new version' > '%s'\n", confPath)
+	ioutil.WriteFile(filepath.Join(dir, "dpkg-query"), []byte(fakeDpkgQuery), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "dpkg"), []byte(fakeDpkg), 0755)
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	install := func(policy string) string {
+		ioutil.WriteFile(confPath, []byte("old version"), 0640)
+
+		if _, err := (pkgmgr.Dpkg{}).InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "1.0.2", Path: "/tmp/daydash.deb", ConffilePolicy: policy}); err != nil {
+			t.Fatalf("InstallPackage - Should install with %s without error, but got: %s", policy, err)
+		}
+
+		return readFile(t, confPath)
+	}
+
+	//	Act
+	keepOld := install(config.ConffilesKeepOld)
+	keepModified := install(config.ConffilesKeepModified)
+
+	//	Assert
+	if keepOld != "old version" {
+		t.Errorf("InstallPackage - Expected keep-old to keep the installed file, but got '%s'", keepOld)
+	}
+
+	if info, err := os.Stat(confPath); err == nil && info.Mode().Perm() != 0640 {
+		t.Errorf("InstallPackage - Expected the kept file to keep its mode, but got %v", info.Mode().Perm())
+	}
+
+	if keepModified != "new version" {
+		t.Errorf("InstallPackage - Expected keep-modified to take the new (unedited) file, but got '%s'", keepModified)
+	}
+}
+
+func TestApt_InstallPackage_LockHeld_ReturnsBusy(t *testing.T) {
+
+	//	Arrange
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "appupgrade-pkgmgr-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	lockedAptGet := "#!/bin/sh\necho 'E: Could not get lock /var/lib/dpkg/lock-frontend. It is held by process 1234 (unattended-upgr)'\nexit 100\n"
+	ioutil.WriteFile(filepath.Join(dir, "apt-get"), []byte(lockedAptGet), 0755)
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	//	Act
+	_, err = pkgmgr.Apt{}.InstallPackage(pkgmgr.InstallRequest{Package: "daydash", Version: "1.0.2", Path: filepath.Join(dir, "daydash_1.0.2_armhf.deb")})
+
+	//	Assert
+	if !errors.Is(err, pkgmgr.ErrBusy) {
+		t.Errorf("InstallPackage - Expected ErrBusy when the lock is held, but got: %v", err)
+	}
+}
+
+func TestVersionMatches_HandlesPrefixEpochAndRevision(t *testing.T) {
+
+	//	Arrange
+	tests := []struct {
+		installed string
+		requested string
+		expected  bool
+	}{
+		{"1.0.2", "v1.0.2", true},
+		{"1.0.2-1", "1.0.2", true},
+		{"2:1.0.2-1ubuntu1", "v1.0.2", true},
+		{"1.2", "1.2.0", true},
+		{"1.0.1", "1.0.2", false},
+		{"1.0.2-1", "1.0.3", false},
+		{"1.0.2-1+deb11u1", "1.0.2", true},
+		{"1.2.3-rc1", "1.2.3", false},
+		{"1.2.3-beta", "v1.2.3", false},
+	}
+
+	for _, test := range tests {
+		//	Act
+		result := pkgmgr.VersionMatches(test.installed, test.requested)
+
+		//	Assert
+		if result != test.expected {
+			t.Errorf("VersionMatches - Expected %v for installed %s and requested %s, but got %v", test.expected, test.installed, test.requested, result)
+		}
+	}
+}
+
+// fakeVerifier is a package manager that reports a fixed installed version and mismatched files
+type fakeVerifier struct {
+	pkgmgr.Dpkg
+	installedVersion string
+	mismatched       []string
+}
+
+func (f fakeVerifier) GetCurrentVersionForPackage(packageName string) (string, error) {
+	return f.installedVersion, nil
+}
+
+func (f fakeVerifier) VerifyPackage(packageName string) ([]string, error) {
+	return f.mismatched, nil
+}
+
+func TestVerifyInstall_WrongVersionOrChangedFiles_Fails(t *testing.T) {
+
+	//	Arrange
+	wrongVersion := fakeVerifier{installedVersion: "1.0.1"}
+	changedFiles := fakeVerifier{installedVersion: "1.0.2", mismatched: []string{"/usr/bin/daydash"}}
+	intact := fakeVerifier{installedVersion: "1.0.2-1"}
+
+	//	Act
+	wrongVersionErr := pkgmgr.VerifyInstall(wrongVersion, "daydash", "v1.0.2")
+	changedFilesErr := pkgmgr.VerifyInstall(changedFiles, "daydash", "v1.0.2")
+	intactErr := pkgmgr.VerifyInstall(intact, "daydash", "v1.0.2")
+
+	//	Assert
+	if !errors.Is(wrongVersionErr, pkgmgr.ErrVerificationFailed) {
+		t.Errorf("VerifyInstall - Expected ErrVerificationFailed for the wrong version, but got: %v", wrongVersionErr)
+	}
+
+	if !errors.Is(changedFilesErr, pkgmgr.ErrVerificationFailed) || !strings.Contains(changedFilesErr.Error(), "/usr/bin/daydash") {
+		t.Errorf("VerifyInstall - Expected ErrVerificationFailed naming the changed file, but got: %v", changedFilesErr)
+	}
+
+	if intactErr != nil {
+		t.Errorf("VerifyInstall - Expected the intact package to verify, but got: %v", intactErr)
+	}
+}
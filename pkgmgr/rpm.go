@@ -0,0 +1,34 @@
+package pkgmgr
+
+import (
+	"github.com/danesparza/appupgrade/rpm"
+)
+
+// Rpm installs package files directly with rpm.  Dependencies aren't resolved
+type Rpm struct{}
+
+// Name gets the name of the package manager
+func (r Rpm) Name() string {
+	return "rpm"
+}
+
+// PackageFormat gets the type of package file the package manager installs
+func (r Rpm) PackageFormat() string {
+	return FormatRPM
+}
+
+// GetCurrentVersionForPackage returns the current installed version for a given package
+func (r Rpm) GetCurrentVersionForPackage(packageName string) (string, error) {
+	currentVersion, err := rpm.GetCurrentVersionForPackage(packageName)
+	return currentVersion, notInstalled(packageName, err)
+}
+
+// RemovePackage removes the given package with rpm -e
+func (r Rpm) RemovePackage(packageName string) (string, error) {
+	return rpm.RemovePackage(packageName)
+}
+
+// InstallPackage installs the given rpm file with rpm -U (older versions are allowed)
+func (r Rpm) InstallPackage(request InstallRequest) (string, error) {
+	return rpm.InstallPackage(request.Path)
+}
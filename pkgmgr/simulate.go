@@ -0,0 +1,148 @@
+package pkgmgr
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/danesparza/appupgrade/config"
+	"github.com/danesparza/appupgrade/dpkg"
+)
+
+// Package change actions
+const (
+	ChangeInstall = "install" // The package would be installed (it isn't installed now)
+	ChangeUpdate  = "update"  // The package would be changed to a different version
+	ChangeRemove  = "remove"  // The package would be removed
+	ChangePurge   = "purge"   // The package would be removed, along with its configuration
+)
+
+// PackageChange is a change a package manager would make to a package
+type PackageChange struct {
+	Package         string `json:"package"`                   // The package name
+	Action          string `json:"action"`                    // What would happen to the package: install, update, remove or purge
+	Version         string `json:"version,omitempty"`         // The version that would be installed
+	PreviousVersion string `json:"previousversion,omitempty"` // The version that is installed now
+}
+
+// Simulation describes what a package manager would do, without changing anything
+type Simulation struct {
+	Output          string           `json:"output"`                    // The output of the package manager's simulation
+	Changes         []PackageChange  `json:"changes"`                   // Every package that would change (including dependencies)
+	Conffiles       []ConffileChange `json:"conffiles,omitempty"`       // The configuration files the new version changes, and whether they would be kept or replaced
+	ConffilePrompts []string         `json:"conffileprompts,omitempty"` // The locally edited configuration files dpkg would ask about.  The conffiles policy answers for us
+}
+
+// Simulator can be implemented by a PackageManager that can check what an install or remove would do, without doing it
+type Simulator interface {
+	SimulateInstall(request InstallRequest) (Simulation, error)
+	SimulateRemove(packageName string, purge bool) (Simulation, error)
+}
+
+// aptSimulationLine matches the package lines of apt-get -s output, like:
+//
+//	Inst daydash [1.0.1] (1.0.2 local-deb [arm64])
+//	Remv libold [2.1-1]
+var aptSimulationLine = regexp.MustCompile(`^(Inst|Remv|Purg) (\S+)(?: \[([^\]]+)\])?(?: \((\S+))?`)
+
+// ParseAptSimulation gets the package changes from apt-get -s output.  The Conf lines
+// (configuring an installed package) aren't changes of their own, so they're skipped
+func ParseAptSimulation(output string) []PackageChange {
+	retval := []PackageChange{}
+
+	for _, line := range strings.Split(output, "\n") {
+		match := aptSimulationLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+
+		change := PackageChange{Package: match[2], PreviousVersion: match[3]}
+
+		switch match[1] {
+		case "Inst":
+			change.Version = match[4]
+			change.Action = ChangeInstall
+			if change.PreviousVersion != "" {
+				change.Action = ChangeUpdate
+			}
+		case "Remv":
+			change.Action = ChangeRemove
+		case "Purg":
+			change.Action = ChangePurge
+		}
+
+		retval = append(retval, change)
+	}
+
+	return retval
+}
+
+// PredictConffiles works out what installing a new version of a package would do to its configuration files, given
+// the checksums of the installed version's files and the new version's files.  dpkg asks about a file when the package
+// changed it and it was also edited locally.  Those files are returned as prompts (the policy decides what happens to them)
+func PredictConffiles(installed, shipped map[string]string, policy string) ([]ConffileChange, []string) {
+	changes := []ConffileChange{}
+	prompts := []string{}
+
+	for path, newSum := range shipped {
+		oldSum, existed := installed[path]
+		localSum := fileMD5(path)
+
+		switch {
+		case !existed:
+			changes = append(changes, ConffileChange{Path: path, Action: ConffileAdded})
+		case oldSum == newSum:
+			//	The package doesn't change it
+			continue
+		case localSum == "" || localSum == oldSum:
+			//	Not edited locally, so dpkg takes the new version without asking (keep-old puts the installed one back)
+			if policy == config.ConffilesKeepOld && localSum != "" {
+				changes = append(changes, ConffileChange{Path: path, Action: ConffileKept})
+			} else {
+				changes = append(changes, ConffileChange{Path: path, Action: ConffileReplaced})
+			}
+		default:
+			prompts = append(prompts, path)
+			if policy == config.ConffilesTakeNew {
+				changes = append(changes, ConffileChange{Path: path, Action: ConffileReplaced})
+			} else {
+				changes = append(changes, ConffileChange{Path: path, Action: ConffileKept})
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	sort.Strings(prompts)
+
+	return changes, prompts
+}
+
+// simulateDebConffiles predicts what installing the deb file in the request would do to the package's configuration files
+func simulateDebConffiles(request InstallRequest) ([]ConffileChange, []string, error) {
+	installed, err := dpkg.GetConffiles(request.Package)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shipped, err := dpkg.GetPackageFileConffiles(request.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes, prompts := PredictConffiles(installed, shipped, request.ConffilePolicy)
+	return changes, prompts, nil
+}
+
+// debRemoveChange gets the change removing (or purging) a deb package would make
+func debRemoveChange(packageName string, purge bool) PackageChange {
+	retval := PackageChange{Package: packageName, Action: ChangeRemove}
+	if purge {
+		retval.Action = ChangePurge
+	}
+
+	retval.PreviousVersion, _ = dpkg.GetCurrentVersionForPackage(packageName)
+
+	return retval
+}
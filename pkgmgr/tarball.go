@@ -0,0 +1,441 @@
+package pkgmgr
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/danesparza/appupgrade/config"
+	"github.com/danesparza/appupgrade/system"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Tarball installs releases that ship as a tarball (or a single binary) instead of a package.  Each version
+// is unpacked into <root>/releases/<version> and the <root>/current symlink is switched to it, so going
+// back to a previous version is just switching the symlink back
+type Tarball struct {
+	Root     string // The directory releases are unpacked under (/opt/<package>, for example)
+	Service  string // The systemd unit to restart after switching versions (optional)
+	Asset    string // A pattern for the release asset name (optional)
+	StateDir string // The directory the installed version is tracked in
+}
+
+// TarballState is the installed version information kept for a tarball package
+type TarballState struct {
+	Version   string    `json:"version"`   // The installed version
+	Path      string    `json:"path"`      // The directory the version was unpacked into
+	Installed time.Time `json:"installed"` // When the version was installed
+}
+
+// NewTarball creates the tarball package manager for a package
+func NewTarball(pkg config.Package) Tarball {
+	retval := Tarball{
+		Root:     filepath.Join("/opt", pkg.Name),
+		Service:  pkg.Service,
+		Asset:    pkg.Asset,
+		StateDir: filepath.Join(viper.GetString("state.path"), "tarball"),
+	}
+
+	if pkg.InstallDir != "" {
+		retval.Root = pkg.InstallDir
+	}
+
+	return retval
+}
+
+// Name gets the name of the package manager
+func (t Tarball) Name() string {
+	return "tarball"
+}
+
+// PackageFormat gets the type of package file the package manager installs
+func (t Tarball) PackageFormat() string {
+	return FormatTarball
+}
+
+// CanInstallFile returns true if the release asset is a tarball or binary for this machine (or matches the asset pattern).
+// Without a pattern, builds for other operating systems (darwin, windows, etc) and source archives are skipped
+func (t Tarball) CanInstallFile(fileName string) bool {
+	if t.Asset != "" {
+		matched, err := path.Match(t.Asset, fileName)
+		return err == nil && matched
+	}
+
+	if !system.IsArchive(fileName) && !system.IsBinary(fileName) {
+		return false
+	}
+
+	return !system.IsSourceArchive(fileName) && system.NameOSMatches(fileName) && system.NameArchitectureMatches(fileName)
+}
+
+// GetCurrentVersionForPackage returns the installed version from the package's state
+func (t Tarball) GetCurrentVersionForPackage(packageName string) (string, error) {
+	state, err := t.readState(packageName)
+	if err != nil {
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"package":        packageName,
+		"currentVersion": state.Version,
+	}).Debug("found current version for package")
+
+	return state.Version, nil
+}
+
+// RemovePackage removes the current symlink (and the installed version from state).  Unpacked releases
+// are left where they are so they can be switched back to
+func (t Tarball) RemovePackage(packageName string) (string, error) {
+	log.WithFields(log.Fields{
+		"package": packageName,
+	}).Debug("requested package remove")
+
+	if err := os.Remove(filepath.Join(t.Root, "current")); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Error("problem removing the current symlink")
+		return "", err
+	}
+
+	if err := os.Remove(t.statePath(packageName)); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Error("problem removing the package state")
+		return "", err
+	}
+
+	return fmt.Sprintf("Removed %s", filepath.Join(t.Root, "current")), nil
+}
+
+// PurgePackage removes the package's install directory (every unpacked release) and its state
+func (t Tarball) PurgePackage(packageName string) (string, error) {
+	log.WithFields(log.Fields{
+		"package": packageName,
+	}).Debug("requested package purge")
+
+	if err := os.RemoveAll(t.Root); err != nil {
+		log.WithError(err).Error("problem removing the install directory")
+		return "", err
+	}
+
+	if err := os.Remove(t.statePath(packageName)); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Error("problem removing the package state")
+		return "", err
+	}
+
+	return fmt.Sprintf("Removed %s", t.Root), nil
+}
+
+// InstallPackage unpacks the tarball (or copies the binary) into the version's release directory,
+// switches the current symlink to it and restarts the service (if there is one)
+func (t Tarball) InstallPackage(request InstallRequest) (string, error) {
+	log.WithFields(log.Fields{
+		"package":     request.Package,
+		"version":     request.Version,
+		"packageFile": request.Path,
+	}).Debug("requested package installation")
+
+	if request.Version == "" || request.Version != filepath.Base(request.Version) || strings.HasPrefix(request.Version, ".") {
+		return "", fmt.Errorf("not a valid version to install: %s", request.Version)
+	}
+
+	releasesDir := filepath.Join(t.Root, "releases")
+	releaseDir := filepath.Join(releasesDir, request.Version)
+	stagingDir := filepath.Join(releasesDir, "."+request.Version+".tmp")
+
+	//	Unpack into a staging directory first, so a failed unpack doesn't leave a partial release
+	os.RemoveAll(stagingDir)
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		log.WithError(err).Error("problem creating the release staging directory")
+		return "", err
+	}
+
+	if err := unpackRelease(request, stagingDir); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"packageFile": request.Path,
+		}).Error("problem unpacking the release")
+		os.RemoveAll(stagingDir)
+		return "", err
+	}
+
+	//	A reinstall replaces the live release, so point current at the staged copy while the release directory is replaced
+	if t.currentRelease() == releaseDir {
+		if err := t.switchCurrent(stagingDir); err != nil {
+			os.RemoveAll(stagingDir)
+			return "", err
+		}
+	}
+
+	os.RemoveAll(releaseDir)
+	if err := os.Rename(stagingDir, releaseDir); err != nil {
+		log.WithError(err).Error("problem moving the release into place")
+		os.RemoveAll(stagingDir)
+		return "", err
+	}
+
+	retval, err := t.activate(request.Package, request.Version, releaseDir)
+
+	log.WithFields(log.Fields{
+		"package": request.Package,
+		"version": request.Version,
+		"output":  retval,
+	}).Debug("installed package")
+
+	return retval, err
+}
+
+// SwitchVersion switches the current symlink back to a version that's still unpacked (and restarts the service),
+// without downloading it again.  ErrVersionNotKept is returned if the version isn't unpacked
+func (t Tarball) SwitchVersion(packageName, version string) (string, error) {
+	log.WithFields(log.Fields{
+		"package": packageName,
+		"version": version,
+	}).Debug("requested switch to unpacked version")
+
+	if version == "" || version != filepath.Base(version) || strings.HasPrefix(version, ".") {
+		return "", fmt.Errorf("not a valid version to switch to: %s", version)
+	}
+
+	releaseDir := filepath.Join(t.Root, "releases", version)
+	if info, err := os.Stat(releaseDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%w: %s", ErrVersionNotKept, releaseDir)
+	}
+
+	return t.activate(packageName, version, releaseDir)
+}
+
+// activate switches the current symlink to the release directory, records the version as
+// installed and restarts the service (if there is one)
+func (t Tarball) activate(packageName, version, releaseDir string) (string, error) {
+	if err := t.switchCurrent(releaseDir); err != nil {
+		return "", err
+	}
+
+	state := TarballState{
+		Version:   version,
+		Path:      releaseDir,
+		Installed: time.Now(),
+	}
+
+	if err := t.writeState(packageName, state); err != nil {
+		log.WithError(err).Error("problem saving the package state")
+		return "", err
+	}
+
+	retval := fmt.Sprintf("Switched %s to %s", filepath.Join(t.Root, "current"), releaseDir)
+
+	//	Restart the service so it picks up the new version
+	if t.Service != "" {
+		cmdOutput, err := exec.Command("systemctl", "restart", t.Service).CombinedOutput()
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"service": t.Service,
+				"output":  strings.TrimSpace(string(cmdOutput)),
+			}).Error("problem restarting the service")
+			return retval, fmt.Errorf("problem restarting service %s: %v", t.Service, err)
+		}
+
+		retval = fmt.Sprintf("%s and restarted %s", retval, t.Service)
+	}
+
+	return retval, nil
+}
+
+// currentRelease gets the directory the current symlink points at (blank if there isn't one)
+func (t Tarball) currentRelease() string {
+	target, err := os.Readlink(filepath.Join(t.Root, "current"))
+	if err != nil {
+		return ""
+	}
+
+	return target
+}
+
+// switchCurrent points the current symlink at the directory.  Renaming a new symlink over the old one is atomic
+func (t Tarball) switchCurrent(dir string) error {
+	currentLink := filepath.Join(t.Root, "current")
+	newLink := filepath.Join(t.Root, ".current.tmp")
+	os.Remove(newLink)
+	if err := os.Symlink(dir, newLink); err != nil {
+		log.WithError(err).Error("problem creating the current symlink")
+		return err
+	}
+
+	if err := os.Rename(newLink, currentLink); err != nil {
+		log.WithError(err).Error("problem switching the current symlink")
+		os.Remove(newLink)
+		return err
+	}
+
+	return nil
+}
+
+// statePath gets the path of the state file for the package
+func (t Tarball) statePath(packageName string) string {
+	return filepath.Join(t.StateDir, packageName+".json")
+}
+
+// readState reads the package's state.  ErrNotInstalled is returned if there isn't any
+func (t Tarball) readState(packageName string) (TarballState, error) {
+	retval := TarballState{}
+
+	data, err := ioutil.ReadFile(t.statePath(packageName))
+	if os.IsNotExist(err) {
+		return retval, fmt.Errorf("%w: %s", ErrNotInstalled, packageName)
+	}
+	if err != nil {
+		return retval, err
+	}
+
+	err = json.Unmarshal(data, &retval)
+	return retval, err
+}
+
+// writeState saves the package's state
+func (t Tarball) writeState(packageName string, state TarballState) error {
+	if err := os.MkdirAll(t.StateDir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	//	Write to a temp file and rename it, so the state is never half written
+	tempPath := t.statePath(packageName) + ".tmp"
+	if err := ioutil.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, t.statePath(packageName))
+}
+
+// unpackRelease unpacks a gzipped tarball into the directory.  Anything else is treated as
+// a single binary and copied into the directory (named after the package)
+func unpackRelease(request InstallRequest, dir string) error {
+	f, err := os.Open(request.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	magic, _ := reader.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return untar(reader, dir)
+	}
+
+	binary, err := os.OpenFile(filepath.Join(dir, request.Package), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	defer binary.Close()
+
+	_, err = io.Copy(binary, reader)
+	return err
+}
+
+// untar unpacks a gzipped tarball into the directory.  Entries that would land outside the directory are refused: paths
+// that climb out of it, symlinks that point out of it, and entries that would be written through a symlink
+func untar(r io.Reader, dir string) error {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, header.Name)
+		if !isWithin(dir, target) {
+			return fmt.Errorf("tarball entry is outside the release directory: %s", header.Name)
+		}
+
+		if err := checkNoSymlinks(dir, target); err != nil {
+			return fmt.Errorf("tarball entry %s: %v", header.Name, err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(header.Mode)|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(file, tarReader)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(header.Linkname) || !isWithin(dir, filepath.Join(filepath.Dir(target), header.Linkname)) {
+				return fmt.Errorf("tarball symlink points outside the release directory: %s -> %s", header.Name, header.Linkname)
+			}
+
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// isWithin returns true if the path is the directory, or inside it
+func isWithin(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+// checkNoSymlinks returns an error if the path (or any directory between it and dir) is an existing symlink,
+// so nothing gets written through a symlink an earlier entry created
+func checkNoSymlinks(dir, path string) error {
+	relative, err := filepath.Rel(dir, path)
+	if err != nil || relative == "." {
+		return err
+	}
+
+	current := dir
+	for _, part := range strings.Split(relative, string(os.PathSeparator)) {
+		current = filepath.Join(current, part)
+
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write through the symlink %s", current)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package pkgmgr
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/danesparza/appupgrade/dpkg"
+	"github.com/hashicorp/go-version"
+	log "github.com/sirupsen/logrus"
+)
+
+// Verifier can be implemented by a PackageManager that can check the installed files of a package
+type Verifier interface {
+	// VerifyPackage gets the installed files of the package that don't match what the package shipped
+	VerifyPackage(packageName string) ([]string, error)
+}
+
+// Repairer can be implemented by a PackageManager that can finish changes that were interrupted
+type Repairer interface {
+	// RepairPackages finishes configuring packages an interrupted change left half done.  It returns the packages it repaired
+	RepairPackages() ([]string, error)
+}
+
+// VerifyInstall checks that the requested version of a package is what's actually installed, and that
+// its files are intact (if the package manager can check them).  ErrVerificationFailed is returned if not
+func VerifyInstall(packageManager PackageManager, packageName, requestedVersion string) error {
+	installedVersion, err := packageManager.GetCurrentVersionForPackage(packageName)
+	if err != nil {
+		return fmt.Errorf("%w: problem getting the installed version: %v", ErrVerificationFailed, err)
+	}
+
+	if !VersionMatches(installedVersion, requestedVersion) {
+		return fmt.Errorf("%w: version %s is installed instead of %s", ErrVerificationFailed, installedVersion, requestedVersion)
+	}
+
+	if verifier, ok := packageManager.(Verifier); ok {
+		mismatched, err := verifier.VerifyPackage(packageName)
+		if err != nil {
+			return fmt.Errorf("%w: problem checking the installed files: %v", ErrVerificationFailed, err)
+		}
+
+		if len(mismatched) > 0 {
+			return fmt.Errorf("%w: installed files don't match the package: %s", ErrVerificationFailed, strings.Join(mismatched, ", "))
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"package": packageName,
+		"version": installedVersion,
+	}).Debug("verified installed package")
+
+	return nil
+}
+
+// debianRevisionRegex matches a debian revision (the part of a package version after the last dash)
+var debianRevisionRegex = regexp.MustCompile(`^[0-9][0-9A-Za-z.+~]*$`)
+
+// VersionMatches returns true if the installed version is the requested release version.  Release versions are
+// often tagged with a leading v, and package versions can have an epoch (1:) and a debian revision (-1) added
+func VersionMatches(installedVersion, requestedVersion string) bool {
+	installed := strings.TrimPrefix(strings.TrimSpace(installedVersion), "v")
+	requested := strings.TrimPrefix(strings.TrimSpace(requestedVersion), "v")
+
+	if idx := strings.Index(installed, ":"); idx >= 0 {
+		installed = installed[idx+1:]
+	}
+
+	if installed == requested {
+		return true
+	}
+
+	//	A debian revision is everything after the last dash.  It starts with a digit (-1, -0ubuntu2, -1+deb11u1), so
+	//	a pre-release like 1.2.3-rc1 isn't mistaken for 1.2.3
+	if idx := strings.LastIndex(installed, "-"); idx >= 0 && installed[:idx] == requested && debianRevisionRegex.MatchString(installed[idx+1:]) {
+		return true
+	}
+
+	//	Otherwise compare them as versions (so 1.2 matches 1.2.0)
+	installedVer, err := version.NewVersion(installed)
+	if err != nil {
+		return false
+	}
+
+	requestedVer, err := version.NewVersion(requested)
+	if err != nil {
+		return false
+	}
+
+	return installedVer.Equal(requestedVer)
+}
+
+// repairDebPackages runs dpkg --configure -a if an interrupted change left any packages half done
+func repairDebPackages() ([]string, error) {
+	retval := []string{}
+
+	unconfigured, err := dpkg.GetUnconfiguredPackages()
+	if err != nil {
+		return retval, err
+	}
+
+	if len(unconfigured) == 0 {
+		return retval, nil
+	}
+
+	for name := range unconfigured {
+		retval = append(retval, name)
+	}
+	sort.Strings(retval)
+
+	log.WithFields(log.Fields{
+		"packages": retval,
+	}).Info("configuring packages that were left half done")
+
+	output, err := dpkg.ConfigurePending()
+	if err != nil {
+		return retval, fmt.Errorf("problem running dpkg --configure -a: %v: %s", err, output)
+	}
+
+	return retval, nil
+}
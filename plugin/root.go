@@ -0,0 +1,161 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/system"
+	log "github.com/sirupsen/logrus"
+)
+
+// Plugin actions
+const (
+	ActionList  = "list"  // List the releases for a package
+	ActionFetch = "fetch" // Fetch the asset for a release to a local path
+)
+
+// DefaultTimeout is how long a plugin is given to respond if no timeout is set
+const DefaultTimeout = 5 * time.Minute
+
+// Plugin is an external executable that provides releases.  It's run once per request, gets a
+// JSON Request on stdin and writes a JSON Response to stdout (a lot like a git credential helper)
+type Plugin struct {
+	Command string        // The executable to run
+	Args    []string      // Any extra arguments to pass to the executable
+	Timeout time.Duration // How long the plugin is given to respond
+}
+
+// Request is sent to the plugin on stdin
+type Request struct {
+	Action  string          `json:"action"`            // The action to take: list or fetch
+	Package string          `json:"package"`           // The monitored package name
+	URL     string          `json:"url,omitempty"`     // The url configured for the source (the plugin decides what it means)
+	Arch    string          `json:"arch"`              // The debian architecture of this machine
+	Release *github.Release `json:"release,omitempty"` // fetch only: the release to fetch (as returned by list)
+	Path    string          `json:"path,omitempty"`    // fetch only: the local path to write the asset to
+}
+
+// Response is read from the plugin's stdout
+type Response struct {
+	Releases []github.Release `json:"releases,omitempty"` // list only: the releases, newest first
+	Error    string           `json:"error,omitempty"`    // If set, the request failed
+}
+
+// GetVersionsForPackage asks the plugin for the list of releases for the package
+func GetVersionsForPackage(plugin Plugin, packageName, sourceUrl string) ([]github.Release, error) {
+	request := Request{
+		Action:  ActionList,
+		Package: packageName,
+		URL:     sourceUrl,
+		Arch:    system.GetArchitecture(),
+	}
+
+	response, err := plugin.run(request)
+	if err != nil {
+		return []github.Release{}, err
+	}
+
+	if response.Releases == nil {
+		return []github.Release{}, nil
+	}
+
+	return response.Releases, nil
+}
+
+// DownloadFile asks the plugin to fetch the asset for the release to a temporary location and returns the temporary location
+func DownloadFile(plugin Plugin, packageName, sourceUrl string, release github.Release) (string, error) {
+	//	Keep the extension of the package file (so the package manager knows what it is)
+	extension := path.Ext(release.Name)
+	if extension == "" {
+		extension = ".deb"
+	}
+
+	tempFile, err := ioutil.TempFile("", "*"+extension)
+	if err != nil {
+		log.WithError(err).Error("problem creating temp file")
+		return "", err
+	}
+	tempFile.Close()
+
+	request := Request{
+		Action:  ActionFetch,
+		Package: packageName,
+		URL:     sourceUrl,
+		Arch:    system.GetArchitecture(),
+		Release: &release,
+		Path:    tempFile.Name(),
+	}
+
+	if _, err := plugin.run(request); err != nil {
+		os.Remove(tempFile.Name())
+		return "", err
+	}
+
+	return tempFile.Name(), nil
+}
+
+// run runs the plugin with the given request and returns its response
+func (plugin Plugin) run(request Request) (Response, error) {
+	retval := Response{}
+
+	timeout := plugin.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	requestData, err := json.Marshal(request)
+	if err != nil {
+		return retval, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, plugin.Command, plugin.Args...)
+	cmd.Stdin = bytes.NewReader(requestData)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	log.WithFields(log.Fields{
+		"plugin":  plugin.Command,
+		"action":  request.Action,
+		"package": request.Package,
+	}).Debug("running release source plugin")
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("plugin %s timed out after %s", plugin.Command, timeout)
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"plugin": plugin.Command,
+			"action": request.Action,
+			"stderr": strings.TrimSpace(stderr.String()),
+		}).Error("problem running release source plugin")
+		return retval, fmt.Errorf("problem running plugin %s: %v", plugin.Command, err)
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), &retval); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"plugin": plugin.Command,
+			"action": request.Action,
+		}).Error("problem decoding the response from release source plugin")
+		return retval, fmt.Errorf("problem decoding the response from plugin %s: %v", plugin.Command, err)
+	}
+
+	if retval.Error != "" {
+		return retval, fmt.Errorf("plugin %s returned an error: %s", plugin.Command, retval.Error)
+	}
+
+	return retval, nil
+}
@@ -0,0 +1,132 @@
+package plugin_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/plugin"
+)
+
+// testPlugin is a tiny plugin that lists one release and writes a fixed file when asked to fetch
+const testPlugin = `#!/bin/sh
+request=$(cat)
+case "$request" in
+	*'"action":"list"'*)
+		echo '{"releases": [{"version": "v1.0.2", "name": "daydash_1.0.2.deb", "downloadUrl": "build://1234"}]}'
+		;;
+	*'"action":"fetch"'*)
+		path=$(echo "$request" | sed 's/.*"path":"\([^"]*\)".*/\1/')
+		printf 'package contents' > "$path"
+		echo '{}'
+		;;
+	*)
+		echo '{"error": "unknown action"}'
+		;;
+esac
+`
+
+func writePlugin(t *testing.T, contents string) string {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "appupgrade-plugin-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+
+	pluginPath := filepath.Join(dir, "plugin.sh")
+	if err := ioutil.WriteFile(pluginPath, []byte(contents), 0755); err != nil {
+		t.Fatalf("WriteFile - Should write plugin without error, but got: %s", err)
+	}
+
+	return pluginPath
+}
+
+func TestPlugin_ListAndFetch_Successful(t *testing.T) {
+
+	//	Arrange
+	pluginPath := writePlugin(t, testPlugin)
+	defer os.RemoveAll(filepath.Dir(pluginPath))
+	testPlugin := plugin.Plugin{Command: pluginPath}
+
+	//	Act
+	releases, err := plugin.GetVersionsForPackage(testPlugin, "daydash", "build://daydash")
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("GetVersionsForPackage - Should get versions without error, but got: %s", err)
+	}
+
+	if len(releases) != 1 || releases[0].Version != "v1.0.2" || releases[0].DownloadUrl != "build://1234" {
+		t.Fatalf("GetVersionsForPackage failed: Unexpected releases: %+v", releases)
+	}
+
+	packageFile, err := plugin.DownloadFile(testPlugin, "daydash", "build://daydash", releases[0])
+	if err != nil {
+		t.Fatalf("DownloadFile - Should fetch without error, but got: %s", err)
+	}
+	defer os.Remove(packageFile)
+
+	contents, _ := ioutil.ReadFile(packageFile)
+	if string(contents) != "package contents" {
+		t.Errorf("DownloadFile failed: Unexpected file contents: %s", contents)
+	}
+}
+
+func TestPlugin_ErrorsAndTimeouts_ReturnError(t *testing.T) {
+
+	//	Arrange
+	failingPath := writePlugin(t, "#!/bin/sh\necho '{\"error\": \"build system is down\"}'\n")
+	defer os.RemoveAll(filepath.Dir(failingPath))
+
+	slowPath := writePlugin(t, "#!/bin/sh\nexec sleep 5\n")
+	defer os.RemoveAll(filepath.Dir(slowPath))
+
+	//	Act
+	_, failingErr := plugin.GetVersionsForPackage(plugin.Plugin{Command: failingPath}, "daydash", "")
+	_, slowErr := plugin.GetVersionsForPackage(plugin.Plugin{Command: slowPath, Timeout: 100 * time.Millisecond}, "daydash", "")
+
+	//	Assert
+	if failingErr == nil {
+		t.Errorf("GetVersionsForPackage - Should return the error reported by the plugin, but didn't")
+	}
+
+	if slowErr == nil {
+		t.Errorf("GetVersionsForPackage - Should return an error when the plugin times out, but didn't")
+	}
+}
+
+func TestPlugin_DownloadFile_FetchFails_RemovesTempFile(t *testing.T) {
+
+	//	Arrange
+	failingPath := writePlugin(t, "#!/bin/sh\necho '{\"error\": \"build system is down\"}'\n")
+	defer os.RemoveAll(filepath.Dir(failingPath))
+
+	tempDir, err := ioutil.TempDir("", "appupgrade-plugin-tmp-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldTempDir := os.Getenv("TMPDIR")
+	os.Setenv("TMPDIR", tempDir)
+	defer os.Setenv("TMPDIR", oldTempDir)
+
+	//	Act
+	_, err = plugin.DownloadFile(plugin.Plugin{Command: failingPath}, "daydash", "build://daydash", github.Release{Version: "v1.0.2", Name: "daydash_1.0.2.deb"})
+
+	//	Assert
+	if err == nil {
+		t.Errorf("DownloadFile - Should return the error reported by the plugin, but didn't")
+	}
+
+	if leftOver, _ := ioutil.ReadDir(tempDir); len(leftOver) != 0 {
+		t.Errorf("DownloadFile - Expected the temp file to be removed, but found %d files", len(leftOver))
+	}
+}
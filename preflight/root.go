@@ -0,0 +1,211 @@
+package preflight
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/danesparza/appupgrade/dpkg"
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/pkgmgr"
+	"github.com/danesparza/appupgrade/source"
+	"github.com/danesparza/appupgrade/system"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Check names
+const (
+	CheckDpkgLock       = "dpkg-lock"       // Nothing else (apt, unattended-upgrades) is changing packages
+	CheckDpkgAudit      = "dpkg-audit"      // dpkg --audit doesn't report any problems
+	CheckUnconfigured   = "unconfigured"    // No packages were left half installed or half configured
+	CheckDiskSpace      = "disk-space"      // There's enough space to download and install the release
+	CheckReleaseResolve = "release-resolve" // The release exists, with an asset for this architecture
+)
+
+// CheckResult is the result of a single preflight check
+type CheckResult struct {
+	Name     string `json:"name"`     // The check
+	Passed   bool   `json:"passed"`   // 'true' if the check passed
+	Blocking bool   `json:"blocking"` // 'true' if a failure stops the upgrade
+	Message  string `json:"message"`  // What was found
+}
+
+// Report is the result of all the preflight checks
+type Report struct {
+	Passed bool          `json:"passed"` // 'true' if none of the blocking checks failed
+	Checks []CheckResult `json:"checks"` // Each check, in the order it was run
+}
+
+// Add adds a check result to the report
+func (r *Report) Add(result CheckResult) {
+	r.Checks = append(r.Checks, result)
+	r.Passed = r.Passed && (result.Passed || !result.Blocking)
+}
+
+// Failures gets the blocking checks that failed, as one message
+func (r Report) Failures() string {
+	failures := []string{}
+	for _, check := range r.Checks {
+		if check.Blocking && !check.Passed {
+			failures = append(failures, fmt.Sprintf("%s: %s", check.Name, check.Message))
+		}
+	}
+
+	return strings.Join(failures, "; ")
+}
+
+// Run runs every preflight check for installing the requested version of a package.  The release found
+// for the version is returned as well (if it was found)
+func Run(packageManager pkgmgr.PackageManager, releaseSource source.ReleaseSource, requestedVersion string) (Report, github.Release) {
+	retval := CheckSystem(packageManager)
+
+	release, result := CheckRelease(releaseSource, requestedVersion)
+	retval.Add(result)
+
+	return retval, release
+}
+
+// CheckSystem runs the checks that the system is fit to have packages changed: nothing else is changing packages,
+// nothing was left half done, and there's enough disk space.  The dpkg checks only run for deb package managers
+func CheckSystem(packageManager pkgmgr.PackageManager) Report {
+	retval := Report{Passed: true, Checks: []CheckResult{}}
+
+	if packageManager.PackageFormat() == pkgmgr.FormatDeb {
+		retval.Add(checkDpkgLock())
+		retval.Add(checkDpkgAudit())
+		retval.Add(checkUnconfigured())
+	}
+
+	retval.Add(checkDiskSpace(packageManager))
+
+	log.WithFields(log.Fields{
+		"packageManager": packageManager.Name(),
+		"passed":         retval.Passed,
+		"checks":         retval.Checks,
+	}).Debug("ran system preflight checks")
+
+	return retval
+}
+
+// CheckRelease checks that the requested version can be found (with an asset this machine can install)
+func CheckRelease(releaseSource source.ReleaseSource, requestedVersion string) (github.Release, CheckResult) {
+	retval := CheckResult{Name: CheckReleaseResolve, Blocking: true}
+
+	release, err := releaseSource.ResolveVersion(requestedVersion)
+	switch {
+	case errors.Is(err, source.ErrVersionNotFound):
+		retval.Message = fmt.Sprintf("version %s wasn't found for %s in %s", requestedVersion, system.GetArchitecture(), releaseSource.Name())
+	case err != nil:
+		retval.Message = fmt.Sprintf("problem getting versions from %s: %v", releaseSource.Name(), err)
+	default:
+		retval = ReleaseFound(release)
+	}
+
+	return release, retval
+}
+
+// ReleaseFound gets the passed release check for a release that was already found
+func ReleaseFound(release github.Release) CheckResult {
+	return CheckResult{
+		Name:     CheckReleaseResolve,
+		Passed:   true,
+		Blocking: true,
+		Message:  fmt.Sprintf("found version %s: %s", release.Version, release.DownloadUrl),
+	}
+}
+
+// checkDpkgLock checks that nothing else holds the dpkg lock
+func checkDpkgLock() CheckResult {
+	retval := CheckResult{Name: CheckDpkgLock, Blocking: true}
+
+	locked, err := dpkg.IsLocked()
+	switch {
+	case err != nil:
+		retval.Message = fmt.Sprintf("problem checking the dpkg lock: %v", err)
+	case locked:
+		retval.Message = "another process (apt, unattended-upgrades or an operator) is changing packages"
+	default:
+		retval.Passed = true
+		retval.Message = "the dpkg lock is free"
+	}
+
+	return retval
+}
+
+// checkDpkgAudit checks that dpkg --audit is clean
+func checkDpkgAudit() CheckResult {
+	retval := CheckResult{Name: CheckDpkgAudit, Blocking: true}
+
+	report, err := dpkg.Audit()
+	switch {
+	case err != nil:
+		retval.Message = fmt.Sprintf("problem running dpkg --audit: %v", err)
+	case report != "":
+		retval.Message = report
+	default:
+		retval.Passed = true
+		retval.Message = "dpkg --audit found no problems"
+	}
+
+	return retval
+}
+
+// checkUnconfigured checks that no packages were left half installed or half configured
+func checkUnconfigured() CheckResult {
+	retval := CheckResult{Name: CheckUnconfigured, Blocking: true}
+
+	packages, err := dpkg.GetUnconfiguredPackages()
+	if err != nil {
+		retval.Message = fmt.Sprintf("problem listing package states: %v", err)
+		return retval
+	}
+
+	if len(packages) > 0 {
+		found := []string{}
+		for name, state := range packages {
+			found = append(found, fmt.Sprintf("%s (%s)", name, state))
+		}
+		sort.Strings(found)
+
+		retval.Message = "packages need dpkg --configure -a: " + strings.Join(found, ", ")
+		return retval
+	}
+
+	retval.Passed = true
+	retval.Message = "no packages are half installed or half configured"
+	return retval
+}
+
+// checkDiskSpace checks there's enough free space where the release is downloaded, and where it's installed
+func checkDiskSpace(packageManager pkgmgr.PackageManager) CheckResult {
+	retval := CheckResult{Name: CheckDiskSpace, Blocking: true}
+	minimum := uint64(viper.GetInt64("preflight.min-free-mb")) * 1024 * 1024
+
+	paths := []string{os.TempDir(), "/"}
+	if tarball, ok := packageManager.(pkgmgr.Tarball); ok {
+		paths[1] = tarball.Root
+	}
+
+	messages := []string{}
+	for _, path := range paths {
+		free, err := system.GetFreeSpace(path)
+		if err != nil {
+			retval.Message = fmt.Sprintf("problem checking the free space of %s: %v", path, err)
+			return retval
+		}
+
+		if free < minimum {
+			retval.Message = fmt.Sprintf("%s has %d MB free (%d MB is needed)", path, free/1024/1024, minimum/1024/1024)
+			return retval
+		}
+
+		messages = append(messages, fmt.Sprintf("%s has %d MB free", path, free/1024/1024))
+	}
+
+	retval.Passed = true
+	retval.Message = strings.Join(messages, ", ")
+	return retval
+}
@@ -0,0 +1,108 @@
+package preflight_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/danesparza/appupgrade/dpkg"
+	"github.com/danesparza/appupgrade/pkgmgr"
+	"github.com/danesparza/appupgrade/preflight"
+	"github.com/spf13/viper"
+)
+
+// fakeDpkg reports a problem from dpkg --audit
+const fakeDpkg = `#!/bin/sh
+if [ "$1" = "--audit" ]; then
+  echo "The following packages are only half configured:"
+  echo " daydash"
+  exit 1
+fi
+`
+
+// fakeDpkgQuery lists one package that was left half configured
+const fakeDpkgQuery = `#!/bin/sh
+printf 'base-files|install ok installed\n'
+printf 'daydash|install ok half-configured\n'
+`
+
+// writeFakeCommands writes fake dpkg tools into a directory and puts it first on the path
+func writeFakeCommands(t *testing.T) func() {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "appupgrade-preflight-*")
+	if err != nil {
+		t.Fatalf("TempDir - Should create dir without error, but got: %s", err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "dpkg"), []byte(fakeDpkg), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "dpkg-query"), []byte(fakeDpkgQuery), 0755)
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+
+	oldLockFiles := dpkg.LockFiles
+	dpkg.LockFiles = []string{filepath.Join(dir, "lock-frontend")}
+
+	return func() {
+		os.Setenv("PATH", oldPath)
+		dpkg.LockFiles = oldLockFiles
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCheckSystem_BrokenDpkgState_FailsBlockingChecks(t *testing.T) {
+
+	//	Arrange
+	cleanup := writeFakeCommands(t)
+	defer cleanup()
+
+	//	Act
+	report := preflight.CheckSystem(pkgmgr.Dpkg{})
+
+	//	Assert
+	if report.Passed {
+		t.Errorf("CheckSystem - Expected the report to fail, but it passed: %v", report.Checks)
+	}
+
+	results := map[string]bool{}
+	for _, check := range report.Checks {
+		results[check.Name] = check.Passed
+	}
+
+	expected := map[string]bool{
+		preflight.CheckDpkgLock:     true,
+		preflight.CheckDpkgAudit:    false,
+		preflight.CheckUnconfigured: false,
+		preflight.CheckDiskSpace:    true,
+	}
+
+	for name, passed := range expected {
+		if result, ran := results[name]; !ran || result != passed {
+			t.Errorf("CheckSystem - Expected %s to have passed=%v, but got: %v", name, passed, report.Checks)
+		}
+	}
+}
+
+func TestCheckSystem_NotDebPackageManager_SkipsDpkgChecks(t *testing.T) {
+
+	//	Arrange
+	viper.Set("preflight.min-free-mb", 1024*1024*1024)
+	defer viper.Set("preflight.min-free-mb", nil)
+
+	//	Act
+	report := preflight.CheckSystem(pkgmgr.Rpm{})
+
+	//	Assert
+	if len(report.Checks) != 1 || report.Checks[0].Name != preflight.CheckDiskSpace {
+		t.Fatalf("CheckSystem - Expected only the disk space check, but got: %v", report.Checks)
+	}
+
+	if report.Passed || report.Checks[0].Passed {
+		t.Errorf("CheckSystem - Expected the disk space check to fail with a petabyte minimum, but got: %v", report.Checks)
+	}
+}
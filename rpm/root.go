@@ -0,0 +1,100 @@
+package rpm
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNotInstalled is returned when a package isn't installed
+var ErrNotInstalled = errors.New("package is not installed")
+
+// GetCurrentVersionForPackage returns the current installed version for a given package (or ErrNotInstalled if it isn't installed)
+func GetCurrentVersionForPackage(packageName string) (string, error) {
+	retval := ""
+
+	log.WithFields(log.Fields{
+		"package": packageName,
+	}).Debug("requested current version for package")
+
+	// Get the current installed version of the given package
+	// rpm -q --qf '%{VERSION}' python3-lxml
+	versionInfo, err := exec.Command("rpm", "-q", "--qf", "%{VERSION}", packageName).CombinedOutput()
+
+	if err != nil {
+		if strings.Contains(string(versionInfo), "is not installed") {
+			return retval, fmt.Errorf("%w: %s", ErrNotInstalled, packageName)
+		}
+
+		log.WithError(err).WithFields(log.Fields{
+			"output": strings.TrimSpace(string(versionInfo)),
+		}).Error("problem running rpm query command")
+		return retval, err
+	}
+
+	//	Remove leading/trailing whitespace if it exists:
+	retval = strings.TrimSpace(string(versionInfo))
+
+	log.WithFields(log.Fields{
+		"package":        packageName,
+		"currentVersion": retval,
+	}).Debug("found current version for package")
+
+	return retval, nil
+}
+
+// RemovePackage removes the given package
+func RemovePackage(packageName string) (string, error) {
+	retval := ""
+
+	log.WithFields(log.Fields{
+		"package": packageName,
+	}).Debug("requested package remove")
+
+	cmdOutput, err := exec.Command("rpm", "-e", packageName).CombinedOutput()
+
+	if err != nil {
+		log.WithError(err).Error("problem running rpm erase")
+		return retval, err
+	}
+
+	//	Remove leading/trailing whitespace if it exists:
+	retval = strings.TrimSpace(string(cmdOutput))
+
+	log.WithFields(log.Fields{
+		"package": packageName,
+		"output":  retval,
+	}).Debug("removed package")
+
+	return retval, nil
+}
+
+// InstallPackage installs (or upgrades to) the given rpm file at the package path.  Older versions
+// are allowed (--oldpackage), so a previous version can be rolled back to
+func InstallPackage(packagePath string) (string, error) {
+	retval := ""
+
+	log.WithFields(log.Fields{
+		"package": packagePath,
+	}).Debug("requested package installation")
+
+	cmdOutput, err := exec.Command("rpm", "-U", "--oldpackage", packagePath).CombinedOutput()
+
+	if err != nil {
+		log.WithError(err).Error("problem running rpm upgrade")
+		return retval, err
+	}
+
+	//	Remove leading/trailing whitespace if it exists:
+	retval = strings.TrimSpace(string(cmdOutput))
+
+	log.WithFields(log.Fields{
+		"package": packagePath,
+		"output":  retval,
+	}).Debug("installed package")
+
+	return retval, nil
+}
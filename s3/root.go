@@ -0,0 +1,237 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/system"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultLayout is the default object key layout for package files in a bucket
+const DefaultLayout = "{package}/{version}/{arch}/*.deb"
+
+// Bucket describes a bucket on an S3 compatible object store (AWS S3, MinIO, etc)
+type Bucket struct {
+	Endpoint  string // The endpoint of the object store (https://minio.example.com:9000)
+	Name      string // The name of the bucket
+	Region    string // The region of the bucket.  Defaults to us-east-1
+	AccessKey string // The access key.  If blank, requests are sent anonymously
+	SecretKey string // The secret key
+}
+
+// ListBucketResult is the response from the ListObjectsV2 api
+type ListBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Name                  string   `xml:"Name"`
+	Prefix                string   `xml:"Prefix"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+// IsS3URL returns true if the url is an s3:// bucket url
+func IsS3URL(bucketUrl string) bool {
+	return strings.HasPrefix(strings.ToLower(bucketUrl), "s3://")
+}
+
+// ParseBucketURL gets the bucket name and key prefix from an s3://bucket/prefix url
+func ParseBucketURL(bucketUrl string) (string, string, error) {
+	parsed, err := url.Parse(bucketUrl)
+	if err != nil {
+		return "", "", err
+	}
+
+	if !strings.EqualFold(parsed.Scheme, "s3") || parsed.Host == "" {
+		return "", "", fmt.Errorf("not a valid s3 bucket url: %s", bucketUrl)
+	}
+
+	return parsed.Host, strings.Trim(parsed.Path, "/"), nil
+}
+
+// GetVersionsForPackage gets the available releases for a package from the bucket by listing the objects
+// that match the key layout.  The layout can use {package}, {version} and {arch} placeholders and
+// a * wildcard for the file name.  Only files for this machine's architecture are included
+func GetVersionsForPackage(bucket Bucket, prefix, layout, packageName string) ([]github.Release, error) {
+	retval := []github.Release{}
+
+	if layout == "" {
+		layout = DefaultLayout
+	}
+
+	if prefix != "" {
+		layout = strings.Trim(prefix, "/") + "/" + layout
+	}
+
+	layoutRegex, listPrefix, err := compileLayout(layout, packageName)
+	if err != nil {
+		return retval, err
+	}
+
+	//	List each page of matching objects
+	continuationToken := ""
+	for {
+		result, err := listObjects(bucket, listPrefix, continuationToken)
+		if err != nil {
+			return retval, err
+		}
+
+		for _, item := range result.Contents {
+			matches := layoutRegex.FindStringSubmatch(item.Key)
+			if matches == nil {
+				continue
+			}
+
+			itemVersion := matches[layoutRegex.SubexpIndex("version")]
+
+			if archIndex := layoutRegex.SubexpIndex("arch"); archIndex >= 0 && !system.ArchitectureMatches(matches[archIndex]) {
+				continue
+			}
+
+			newRelease := github.Release{
+				Version:     itemVersion,
+				Name:        path.Base(item.Key),
+				DownloadUrl: bucket.objectURL(item.Key),
+				Created:     item.LastModified,
+			}
+
+			retval = append(retval, newRelease)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+
+	github.SortNewestFirst(retval)
+
+	return retval, nil
+}
+
+// DownloadFile downloads an object from the bucket to a temporary location and returns the temporary location
+func DownloadFile(bucket Bucket, objectUrl string) (string, error) {
+	headers, err := signedHeaders(bucket, "GET", objectUrl, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	return github.DownloadFileWithHeaders(objectUrl, headers)
+}
+
+// listObjects lists a single page of objects with the given prefix
+func listObjects(bucket Bucket, prefix, continuationToken string) (ListBucketResult, error) {
+	retval := ListBucketResult{}
+
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("prefix", prefix)
+	if continuationToken != "" {
+		query.Set("continuation-token", continuationToken)
+	}
+
+	listUrl := fmt.Sprintf("%s/%s?%s", bucket.endpoint(), url.PathEscape(bucket.Name), query.Encode())
+
+	//	Create a signed request
+	clientRequest, err := http.NewRequest("GET", listUrl, nil)
+	if err != nil {
+		log.WithError(err).Error("problem preparing the request to the object store")
+		return retval, err
+	}
+
+	headers, err := signedHeaders(bucket, "GET", listUrl, time.Now())
+	if err != nil {
+		log.WithError(err).Error("problem signing the request to the object store")
+		return retval, err
+	}
+
+	for name, value := range headers {
+		clientRequest.Header.Set(name, value)
+	}
+
+	//	Execute the request
+	client := &http.Client{}
+	clientResponse, err := client.Do(clientRequest)
+	if err != nil {
+		log.WithError(err).Error("problem sending the request to the object store")
+		return retval, err
+	}
+	defer clientResponse.Body.Close()
+
+	if clientResponse.StatusCode < 200 || clientResponse.StatusCode > 299 {
+		err = fmt.Errorf("unexpected response status: %s", clientResponse.Status)
+		log.WithError(err).WithFields(log.Fields{
+			"bucket": bucket.Name,
+			"prefix": prefix,
+		}).Error("problem listing objects in the bucket")
+		return retval, err
+	}
+
+	//	Decode the response:
+	err = xml.NewDecoder(clientResponse.Body).Decode(&retval)
+	if err != nil {
+		log.WithError(err).Error("problem decoding the response from the object store")
+		return retval, err
+	}
+
+	return retval, nil
+}
+
+// compileLayout turns a key layout into a regular expression (with named version and arch groups)
+// and gets the longest fixed prefix of the layout, used to narrow the object listing
+func compileLayout(layout, packageName string) (*regexp.Regexp, string, error) {
+	layout = strings.ReplaceAll(layout, "{package}", packageName)
+
+	listPrefix := layout
+	if idx := strings.IndexAny(listPrefix, "{*"); idx >= 0 {
+		listPrefix = listPrefix[:idx]
+	}
+
+	if !strings.Contains(layout, "{version}") {
+		return nil, "", fmt.Errorf("the key layout must include a {version} placeholder: %s", layout)
+	}
+
+	pattern := regexp.QuoteMeta(layout)
+	pattern = strings.ReplaceAll(pattern, `\{version\}`, `(?P<version>[^/]+)`)
+	pattern = strings.ReplaceAll(pattern, `\{arch\}`, `(?P<arch>[^/]+)`)
+	pattern = strings.ReplaceAll(pattern, `\*`, `[^/]*`)
+
+	layoutRegex, err := regexp.Compile("^" + pattern + "$")
+	return layoutRegex, listPrefix, err
+}
+
+// endpoint gets the endpoint without a trailing slash
+func (bucket Bucket) endpoint() string {
+	return strings.TrimSuffix(bucket.Endpoint, "/")
+}
+
+// region gets the region of the bucket, or the default region
+func (bucket Bucket) region() string {
+	if bucket.Region == "" {
+		return "us-east-1"
+	}
+
+	return bucket.Region
+}
+
+// objectURL gets the (path style) url for an object in the bucket
+func (bucket Bucket) objectURL(key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+
+	return fmt.Sprintf("%s/%s/%s", bucket.endpoint(), url.PathEscape(bucket.Name), strings.Join(parts, "/"))
+}
@@ -0,0 +1,78 @@
+package s3_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/danesparza/appupgrade/s3"
+	"github.com/danesparza/appupgrade/system"
+)
+
+func TestS3_GetVersionsForPackage_DefaultLayout_Successful(t *testing.T) {
+
+	//	Arrange
+	arch := system.GetArchitecture()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minioadmin/") {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if req.URL.Path != "/builds" || req.URL.Query().Get("prefix") != "daydash/" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprintf(rw, `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult>
+	<Name>builds</Name>
+	<Contents><Key>daydash/v1.0.1/%[1]s/daydash_1.0.1_%[1]s.deb</Key><LastModified>2021-10-01T12:00:00.000Z</LastModified></Contents>
+	<Contents><Key>daydash/v1.0.2/%[1]s/daydash_1.0.2_%[1]s.deb</Key><LastModified>2021-10-02T12:00:00.000Z</LastModified></Contents>
+	<Contents><Key>daydash/v1.0.2/some-other-arch/daydash_1.0.2_other.deb</Key><LastModified>2021-10-02T12:00:00.000Z</LastModified></Contents>
+	<Contents><Key>daydash/v1.0.2/%[1]s/notes.txt</Key><LastModified>2021-10-02T12:00:00.000Z</LastModified></Contents>
+</ListBucketResult>`, arch)
+	}))
+	defer server.Close()
+
+	bucket := s3.Bucket{
+		Endpoint:  server.URL,
+		Name:      "builds",
+		AccessKey: "minioadmin",
+		SecretKey: "minioadmin",
+	}
+
+	//	Act
+	releases, err := s3.GetVersionsForPackage(bucket, "", "", "daydash")
+
+	//	Assert
+	if err != nil {
+		t.Errorf("GetVersionsForPackage - Should get versions without error, but got: %s", err)
+	}
+
+	if len(releases) != 2 {
+		t.Fatalf("GetVersionsForPackage failed: Expected 2 releases for this architecture, but got %d", len(releases))
+	}
+
+	if releases[0].Version != "v1.0.2" {
+		t.Errorf("GetVersionsForPackage failed: Expected the newest release first, but got %s", releases[0].Version)
+	}
+
+	expectedUrl := fmt.Sprintf("%s/builds/daydash/v1.0.2/%[2]s/daydash_1.0.2_%[2]s.deb", server.URL, arch)
+	if releases[0].DownloadUrl != expectedUrl {
+		t.Errorf("GetVersionsForPackage failed: Expected download url %s but got %s", expectedUrl, releases[0].DownloadUrl)
+	}
+}
+
+func TestS3_ParseBucketURL_WithPrefix_Successful(t *testing.T) {
+
+	//	Act
+	bucketName, prefix, err := s3.ParseBucketURL("s3://builds/debs/")
+
+	//	Assert
+	if err != nil || bucketName != "builds" || prefix != "debs" {
+		t.Errorf("ParseBucketURL failed: Expected builds and debs, but got %s and %s (%v)", bucketName, prefix, err)
+	}
+}
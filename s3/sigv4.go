@@ -0,0 +1,123 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash is the sha256 hash of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// signedHeaders gets the headers needed to send a SigV4 signed request (with an empty body) for the given url
+func signedHeaders(bucket Bucket, method, requestUrl string, now time.Time) (map[string]string, error) {
+	parsed, err := url.Parse(requestUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	shortDate := now.Format("20060102")
+	region := bucket.region()
+
+	retval := map[string]string{
+		"x-amz-content-sha256": emptyPayloadHash,
+		"x-amz-date":           amzDate,
+	}
+
+	//	Anonymous requests don't get signed
+	if bucket.AccessKey == "" {
+		return retval, nil
+	}
+
+	//	Build the canonical request
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", parsed.Host, emptyPayloadHash, amzDate)
+	signedHeaderNames := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalPath := parsed.Path
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		uriEncode(canonicalPath, false),
+		canonicalQuery(parsed.Query()),
+		canonicalHeaders,
+		signedHeaderNames,
+		emptyPayloadHash,
+	}, "\n")
+
+	//	Build the string to sign
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", shortDate, region)
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalHash[:]),
+	}, "\n")
+
+	//	Derive the signing key and sign
+	signingKey := hmacSHA256([]byte("AWS4"+bucket.SecretKey), shortDate)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	retval["Authorization"] = fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		bucket.AccessKey, scope, signedHeaderNames, signature)
+
+	return retval, nil
+}
+
+// canonicalQuery gets the query string in the form SigV4 expects: sorted by key and strictly encoded
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := []string{}
+	for _, key := range keys {
+		vals := values[key]
+		sort.Strings(vals)
+		for _, val := range vals {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(val, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// uriEncode encodes a string the way SigV4 expects
+func uriEncode(value string, encodeSlash bool) string {
+	var sb strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9'),
+			b == '-', b == '_', b == '.', b == '~':
+			sb.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+
+	return sb.String()
+}
+
+// hmacSHA256 computes the HMAC-SHA256 of the data with the given key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,364 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/danesparza/appupgrade/aptrepo"
+	"github.com/danesparza/appupgrade/config"
+	"github.com/danesparza/appupgrade/gitea"
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/gitlab"
+	"github.com/danesparza/appupgrade/localdir"
+	"github.com/danesparza/appupgrade/manifest"
+	"github.com/danesparza/appupgrade/oci"
+	"github.com/danesparza/appupgrade/plugin"
+	"github.com/danesparza/appupgrade/s3"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	Register("github", newGitHubSource)
+	Register("manifest", newManifestSource)
+	Register("gitlab", newGitLabSource)
+	Register("gitea", newGiteaSource)
+	Register("forgejo", newGiteaSource)
+	Register("s3", newS3Source)
+	Register("apt", newAptSource)
+	Register("local", newLocalSource)
+	Register("oci", newOCISource)
+	Register("image", newImageSource)
+	Register("plugin", newPluginSource)
+}
+
+// GetType gets the type of the source, inferring it from the url if it isn't set explicitly.
+// An empty string is returned if the type can't be inferred
+func GetType(src config.Source) string {
+	switch {
+	case src.Type != "":
+		return src.Type
+	case src.Command != "":
+		return "plugin"
+	case localdir.IsLocalURL(src.URL):
+		return "local"
+	case oci.IsOCIURL(src.URL):
+		return "oci"
+	case oci.IsImageURL(src.URL):
+		return "image"
+	case s3.IsS3URL(src.URL):
+		return "s3"
+	case manifest.IsManifestURL(src.URL):
+		return "manifest"
+	case gitlab.IsGitLabURL(src.URL):
+		return "gitlab"
+	case gitea.IsGiteaURL(src.URL):
+		return "gitea"
+	case isGitHubURL(src):
+		return "github"
+	}
+
+	return ""
+}
+
+// backend is a release source made from a function that lists releases and a function that opens assets
+type backend struct {
+	name string
+	list func() ([]github.Release, error)
+	open func(release github.Release) (io.ReadCloser, error)
+}
+
+// Name gets the name of the source
+func (b backend) Name() string {
+	return b.name
+}
+
+// ListReleases gets the available releases
+func (b backend) ListReleases() ([]github.Release, error) {
+	return b.list()
+}
+
+// ResolveVersion gets the release for the given version
+func (b backend) ResolveVersion(requestedVersion string) (github.Release, error) {
+	releases, err := b.list()
+	if err != nil {
+		return github.Release{}, err
+	}
+
+	return resolveFromList(releases, requestedVersion)
+}
+
+// OpenAsset opens the package file for the given release
+func (b backend) OpenAsset(release github.Release) (io.ReadCloser, error) {
+	return b.open(release)
+}
+
+// downloaded adapts a function that downloads an asset to a temp file into a function that opens the asset
+func downloaded(download func(release github.Release) (string, error)) func(release github.Release) (io.ReadCloser, error) {
+	return func(release github.Release) (io.ReadCloser, error) {
+		return openTempFile(download(release))
+	}
+}
+
+// isGitHubURL returns true if the url is a repo url on github.com or on the configured github enterprise server
+func isGitHubURL(src config.Source) bool {
+	valid, _, _ := getGitHubServer(src).ParseRepoURL(src.URL)
+	return valid
+}
+
+// getGitHubServer gets the github server for a source.  Settings on the
+// source override the global github settings.  If the global settings are for a github enterprise
+// server, they're only used for repos on that server: repos on github.com still use github.com
+// (and aren't sent the enterprise token)
+func getGitHubServer(src config.Source) github.Server {
+	retval := github.Server{
+		APIURL:      viper.GetString("github.api-url"),
+		DownloadURL: viper.GetString("github.download-url"),
+		Token:       viper.GetString("github.token"),
+	}
+
+	if retval.Host() != "github.com" && src.APIURL == "" && github.IsGitHubComURL(src.URL) {
+		retval = github.DefaultServer
+	}
+
+	if src.APIURL != "" {
+		retval.APIURL = src.APIURL
+	}
+
+	if src.DownloadURL != "" {
+		retval.DownloadURL = src.DownloadURL
+	}
+
+	if src.Token != "" {
+		retval.Token = src.Token
+	}
+
+	return retval
+}
+
+func newGitHubSource(pkg config.Package, src config.Source) (ReleaseSource, error) {
+	server := getGitHubServer(src)
+	valid, user, repo := server.ParseRepoURL(src.URL)
+	if !valid {
+		return nil, fmt.Errorf("not a valid github repo url: %s", src.URL)
+	}
+
+	return backend{
+		name: src.URL,
+		list: func() ([]github.Release, error) {
+			return github.GetVersionsForRepoOnServer(server, user, repo)
+		},
+		open: downloaded(func(release github.Release) (string, error) {
+			return server.DownloadFile(release.DownloadUrl)
+		}),
+	}, nil
+}
+
+func newManifestSource(pkg config.Package, src config.Source) (ReleaseSource, error) {
+	return backend{
+		name: src.URL,
+		list: func() ([]github.Release, error) {
+			return manifest.GetVersionsForManifest(src.URL)
+		},
+		open: downloaded(func(release github.Release) (string, error) {
+			return github.DownloadFile(release.DownloadUrl)
+		}),
+	}, nil
+}
+
+func newGitLabSource(pkg config.Package, src config.Source) (ReleaseSource, error) {
+	project, err := gitlab.ParseProjectURL(src.URL, src.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend{
+		name: src.URL,
+		list: func() ([]github.Release, error) {
+			return gitlab.GetVersionsForProject(project, src.Token)
+		},
+		open: downloaded(func(release github.Release) (string, error) {
+			return gitlab.DownloadFile(project, src.Token, release.DownloadUrl)
+		}),
+	}, nil
+}
+
+func newGiteaSource(pkg config.Package, src config.Source) (ReleaseSource, error) {
+	repo, err := gitea.ParseRepoURL(src.URL, src.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend{
+		name: src.URL,
+		list: func() ([]github.Release, error) {
+			return gitea.GetVersionsForRepo(repo, src.Token)
+		},
+		open: downloaded(func(release github.Release) (string, error) {
+			return gitea.DownloadFile(repo, src.Token, release.DownloadUrl)
+		}),
+	}, nil
+}
+
+// newS3Source creates an S3 source.  If credentials aren't set on
+// the source, the standard AWS environment variables are used
+func newS3Source(pkg config.Package, src config.Source) (ReleaseSource, error) {
+	bucketName, prefix, err := s3.ParseBucketURL(src.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := s3.Bucket{
+		Endpoint:  src.BaseURL,
+		Name:      bucketName,
+		Region:    src.Region,
+		AccessKey: src.AccessKey,
+		SecretKey: src.SecretKey,
+	}
+
+	if bucket.Endpoint == "" {
+		bucket.Endpoint = "https://s3.amazonaws.com"
+	}
+
+	if bucket.AccessKey == "" {
+		bucket.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		bucket.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+
+	return backend{
+		name: src.URL,
+		list: func() ([]github.Release, error) {
+			return s3.GetVersionsForPackage(bucket, prefix, src.Layout, pkg.Name)
+		},
+		open: downloaded(func(release github.Release) (string, error) {
+			return s3.DownloadFile(bucket, release.DownloadUrl)
+		}),
+	}, nil
+}
+
+func newAptSource(pkg config.Package, src config.Source) (ReleaseSource, error) {
+	repo := aptrepo.Repo{
+		URL:       src.URL,
+		Suite:     src.Suite,
+		Component: src.Component,
+		Keyring:   src.Keyring,
+	}
+
+	if repo.Suite == "" {
+		return nil, fmt.Errorf("a suite is required for apt source %s", src.URL)
+	}
+
+	return backend{
+		name: src.URL,
+		list: func() ([]github.Release, error) {
+			return aptrepo.GetVersionsForPackage(repo, pkg.Name)
+		},
+		open: downloaded(func(release github.Release) (string, error) {
+			return github.DownloadFile(release.DownloadUrl)
+		}),
+	}, nil
+}
+
+func newLocalSource(pkg config.Package, src config.Source) (ReleaseSource, error) {
+	dir := localdir.GetDirectory(src.URL)
+
+	return backend{
+		name: src.URL,
+		list: func() ([]github.Release, error) {
+			return localdir.GetVersionsForPackage(dir, pkg.Name)
+		},
+		open: func(release github.Release) (io.ReadCloser, error) {
+			//	Local files are read from where they are
+			return os.Open(release.DownloadUrl)
+		},
+	}, nil
+}
+
+func newOCISource(pkg config.Package, src config.Source) (ReleaseSource, error) {
+	endpoint, repository, err := oci.ParseRepositoryURL(src.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if src.BaseURL != "" {
+		endpoint = src.BaseURL
+	}
+
+	registry := oci.Registry{
+		Endpoint: endpoint,
+		Username: src.Username,
+		Password: src.Password,
+		Token:    src.Token,
+	}
+
+	return backend{
+		name: src.URL,
+		list: func() ([]github.Release, error) {
+			return oci.GetVersionsForRepository(registry, repository)
+		},
+		open: downloaded(func(release github.Release) (string, error) {
+			return oci.DownloadFile(registry, repository, release.DownloadUrl)
+		}),
+	}, nil
+}
+
+// newImageSource creates a source for the tags of a container image repository.  Images
+// are pulled by the container package manager, so there's nothing to open
+func newImageSource(pkg config.Package, src config.Source) (ReleaseSource, error) {
+	endpoint, repository, err := oci.ParseRepositoryURL(src.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if src.BaseURL != "" {
+		endpoint = src.BaseURL
+	}
+
+	registry := oci.Registry{
+		Endpoint: endpoint,
+		Username: src.Username,
+		Password: src.Password,
+		Token:    src.Token,
+	}
+
+	return backend{
+		name: src.URL,
+		list: func() ([]github.Release, error) {
+			return oci.GetVersionsForImage(registry, repository)
+		},
+		open: func(release github.Release) (io.ReadCloser, error) {
+			return nil, fmt.Errorf("container images can't be downloaded: %s", release.DownloadUrl)
+		},
+	}, nil
+}
+
+func newPluginSource(pkg config.Package, src config.Source) (ReleaseSource, error) {
+	if src.Command == "" {
+		return nil, fmt.Errorf("a command is required for plugin source %s", src.URL)
+	}
+
+	releasePlugin := plugin.Plugin{
+		Command: src.Command,
+		Args:    src.Args,
+		Timeout: src.Timeout,
+	}
+
+	if releasePlugin.Timeout == 0 {
+		releasePlugin.Timeout = viper.GetDuration("plugins.timeout")
+	}
+
+	name := src.URL
+	if name == "" {
+		name = "plugin:" + src.Command
+	}
+
+	return backend{
+		name: name,
+		list: func() ([]github.Release, error) {
+			return plugin.GetVersionsForPackage(releasePlugin, pkg.Name, src.URL)
+		},
+		open: downloaded(func(release github.Release) (string, error) {
+			return plugin.DownloadFile(releasePlugin, pkg.Name, src.URL, release)
+		}),
+	}, nil
+}
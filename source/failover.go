@@ -0,0 +1,124 @@
+package source
+
+import (
+	"io"
+
+	"github.com/danesparza/appupgrade/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// Failover is a release source made of several sources that are tried in order.  If a source is
+// unreachable (or rate limited, or has a bad file) the next source is tried
+type Failover struct {
+	Sources  []ReleaseSource
+	answered int // The index of the source that answered the last request
+}
+
+// Name gets the name of the source that answered the last request (or the first source)
+func (f *Failover) Name() string {
+	if f.answered < len(f.Sources) {
+		return f.Sources[f.answered].Name()
+	}
+
+	return ""
+}
+
+// ListReleases gets the releases from the first source that answers
+func (f *Failover) ListReleases() ([]github.Release, error) {
+	var lastErr error
+
+	for index, src := range f.Sources {
+		releases, err := src.ListReleases()
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"source": src.Name(),
+			}).Warn("problem getting versions from source - trying next source")
+			lastErr = err
+			continue
+		}
+
+		f.answered = index
+		return releases, nil
+	}
+
+	return []github.Release{}, lastErr
+}
+
+// ResolveVersion gets the release for the given version from the first source that has it
+func (f *Failover) ResolveVersion(requestedVersion string) (github.Release, error) {
+	var lastErr error = ErrVersionNotFound
+
+	for index, src := range f.Sources {
+		release, err := src.ResolveVersion(requestedVersion)
+		if err != nil {
+			if err != ErrVersionNotFound {
+				log.WithError(err).WithFields(log.Fields{
+					"source":  src.Name(),
+					"version": requestedVersion,
+				}).Warn("problem getting versions from source - trying next source")
+				lastErr = err
+			}
+			continue
+		}
+
+		f.answered = index
+		return release, nil
+	}
+
+	return github.Release{}, lastErr
+}
+
+// OpenAsset opens the package file for the given release.  See DownloadAsset
+func (f *Failover) OpenAsset(release github.Release) (io.ReadCloser, error) {
+	return openTempFile(f.DownloadAsset(release))
+}
+
+// DownloadAsset gets the package file for the release, starting with the source that found the release.
+// If that fails, the same version is looked for in each of the other sources in turn
+func (f *Failover) DownloadAsset(release github.Release) (string, error) {
+	var lastErr error = ErrVersionNotFound
+
+	//	Try the source that answered first
+	candidates := []int{}
+	if f.answered < len(f.Sources) {
+		candidates = append(candidates, f.answered)
+	}
+	for index := range f.Sources {
+		if index != f.answered {
+			candidates = append(candidates, index)
+		}
+	}
+
+	for _, index := range candidates {
+		src := f.Sources[index]
+		candidate := release
+
+		//	Other sources have their own copy of the release
+		if index != f.answered {
+			found, err := src.ResolveVersion(release.Version)
+			if err != nil {
+				if err != ErrVersionNotFound {
+					lastErr = err
+				}
+				continue
+			}
+			candidate = found
+		}
+
+		packageFile, err := DownloadAsset(src, candidate)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"source":      src.Name(),
+				"version":     candidate.Version,
+				"downloadurl": candidate.DownloadUrl,
+			}).Warn("problem downloading the package file for release - trying next source")
+			lastErr = err
+			continue
+		}
+
+		f.answered = index
+		return packageFile, nil
+	}
+
+	return "", lastErr
+}
@@ -0,0 +1,79 @@
+package source
+
+import (
+	"io"
+
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/pkgmgr"
+	"github.com/danesparza/appupgrade/system"
+)
+
+// installable is a release source that only shows the releases the package manager can install
+// on this machine (the right package format, built for the right architecture)
+type installable struct {
+	source         ReleaseSource
+	packageManager pkgmgr.PackageManager
+}
+
+// Name gets the name of the source
+func (i installable) Name() string {
+	return i.source.Name()
+}
+
+// ListReleases gets the available releases that can be installed
+func (i installable) ListReleases() ([]github.Release, error) {
+	releases, err := i.source.ListReleases()
+	if err != nil {
+		return releases, err
+	}
+
+	retval := []github.Release{}
+	for _, release := range releases {
+		if i.canInstall(release) {
+			retval = append(retval, release)
+		}
+	}
+
+	return retval, nil
+}
+
+// ResolveVersion gets the installable release for the given version.  The wrapped source resolves it
+// first (it may know versions it doesn't list).  If it picks a file that can't be installed here, the
+// installable releases it lists are used instead
+func (i installable) ResolveVersion(requestedVersion string) (github.Release, error) {
+	release, err := i.source.ResolveVersion(requestedVersion)
+	if err != nil {
+		return release, err
+	}
+
+	if i.canInstall(release) {
+		return release, nil
+	}
+
+	releases, err := i.ListReleases()
+	if err != nil {
+		return github.Release{}, err
+	}
+
+	return resolveFromList(releases, requestedVersion)
+}
+
+// OpenAsset opens the package file for the given release
+func (i installable) OpenAsset(release github.Release) (io.ReadCloser, error) {
+	return i.source.OpenAsset(release)
+}
+
+// DownloadAsset gets the package file for the release using the wrapped source
+func (i installable) DownloadAsset(release github.Release) (string, error) {
+	return DownloadAsset(i.source, release)
+}
+
+// canInstall returns true if the release's file can be installed.  Releases that aren't
+// named like a package file are left to the source (a plugin may not name its assets)
+func (i installable) canInstall(release github.Release) bool {
+	if !system.IsPackageFile(release.Name) {
+		return true
+	}
+
+	return pkgmgr.CanInstallFile(i.packageManager, release.Name)
+}
@@ -0,0 +1,195 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/danesparza/appupgrade/config"
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/pkgmgr"
+	"github.com/hashicorp/go-version"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrVersionNotFound is returned when a source doesn't have the requested version
+	ErrVersionNotFound = errors.New("version not found")
+
+	// ErrUnknownSourceType is returned when the type of a source can't be found (or isn't registered)
+	ErrUnknownSourceType = errors.New("unknown source type")
+)
+
+// ReleaseSource is a place that releases of a package can be found
+type ReleaseSource interface {
+	// Name gets a display name for the source (usually its url)
+	Name() string
+
+	// ListReleases gets the available releases, newest first
+	ListReleases() ([]github.Release, error)
+
+	// ResolveVersion gets the release for the given version, or ErrVersionNotFound
+	ResolveVersion(requestedVersion string) (github.Release, error)
+
+	// OpenAsset opens the package file for the given release
+	OpenAsset(release github.Release) (io.ReadCloser, error)
+}
+
+// Downloader can be implemented by a ReleaseSource that has its own way of
+// getting a package file to a local path (instead of OpenAsset)
+type Downloader interface {
+	DownloadAsset(release github.Release) (string, error)
+}
+
+// Factory creates a release source for a package from a source configuration
+type Factory func(pkg config.Package, src config.Source) (ReleaseSource, error)
+
+var (
+	factories     = map[string]Factory{}
+	factoriesLock sync.RWMutex
+)
+
+// Register makes a release source factory available for the given source type
+func Register(sourceType string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	factories[sourceType] = factory
+}
+
+// New creates the release source for a single source configuration of a package
+func New(pkg config.Package, src config.Source) (ReleaseSource, error) {
+	sourceType := GetType(src)
+
+	factoriesLock.RLock()
+	factory, registered := factories[sourceType]
+	factoriesLock.RUnlock()
+
+	if !registered {
+		return nil, fmt.Errorf("%w for source %s of package %s", ErrUnknownSourceType, src.URL, pkg.Name)
+	}
+
+	return factory(pkg, src)
+}
+
+// ForPackage creates the release source for a package.  If the package has more than one source
+// configured, they are tried in order (see Failover).  Only releases that the package's package
+// manager can install on this machine are included
+func ForPackage(pkg config.Package) (ReleaseSource, error) {
+	sources := pkg.GetSources()
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no sources configured for package %s", pkg.Name)
+	}
+
+	//	Only releases the package manager can install are used
+	packageManager, err := pkgmgr.ForPackage(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []ReleaseSource{}
+	for _, src := range sources {
+		member, err := New(pkg, src)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, installable{source: member, packageManager: packageManager})
+	}
+
+	if len(members) == 1 {
+		return members[0], nil
+	}
+
+	return &Failover{Sources: members}, nil
+}
+
+// DownloadAsset gets the package file for the release to a local (temporary) path.  If the
+// release has a checksum, the file is verified against it
+func DownloadAsset(src ReleaseSource, release github.Release) (string, error) {
+	if downloader, ok := src.(Downloader); ok {
+		return downloader.DownloadAsset(release)
+	}
+
+	asset, err := src.OpenAsset(release)
+	if err != nil {
+		return "", err
+	}
+	defer asset.Close()
+
+	//	Get a temporary file reference:
+	tempFile, err := ioutil.TempFile("", "*"+path.Ext(release.Name))
+	if err != nil {
+		log.WithError(err).Error("problem creating temp file")
+		return "", err
+	}
+	defer tempFile.Close()
+
+	if _, err := io.Copy(tempFile, asset); err != nil {
+		os.Remove(tempFile.Name())
+		return "", err
+	}
+
+	//	If the source told us what to expect, make sure we got it
+	if release.Checksum != "" {
+		if err := github.VerifyChecksum(tempFile.Name(), release.Checksum); err != nil {
+			os.Remove(tempFile.Name())
+			return "", err
+		}
+	}
+
+	return tempFile.Name(), nil
+}
+
+// resolveFromList finds the requested version in a list of releases
+func resolveFromList(releases []github.Release, requestedVersion string) (github.Release, error) {
+	versionRequested, err := version.NewVersion(requestedVersion)
+	if err != nil {
+		return github.Release{}, err
+	}
+
+	for _, release := range releases {
+		versionFound, err := version.NewVersion(release.Version)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"releaseVersion": release.Version,
+			}).Warn("problem parsing a found release version - skipping to next version")
+			continue
+		}
+
+		if versionRequested.Equal(versionFound) {
+			return release, nil
+		}
+	}
+
+	return github.Release{}, ErrVersionNotFound
+}
+
+// tempFileReader is a file that's removed when it's closed
+type tempFileReader struct {
+	*os.File
+}
+
+// Close closes and removes the file
+func (t tempFileReader) Close() error {
+	err := t.File.Close()
+	os.Remove(t.File.Name())
+	return err
+}
+
+// openTempFile opens a downloaded temp file.  The file is removed when it's closed
+func openTempFile(filePath string, err error) (io.ReadCloser, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return tempFileReader{f}, nil
+}
@@ -0,0 +1,366 @@
+package source_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/danesparza/appupgrade/config"
+	"github.com/danesparza/appupgrade/github"
+	"github.com/danesparza/appupgrade/source"
+	"github.com/spf13/viper"
+)
+
+// newManifestServer serves a manifest with a single release (and its package file)
+func newManifestServer(packageContents string) *httptest.Server {
+	hash := sha256.Sum256([]byte(packageContents))
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/manifest.json":
+			fmt.Fprintf(rw, `{"releases": [{"version": "v1.0.2", "assets": [{"arch": "all", "url": "%s/daydash_1.0.2_all.deb", "sha256": "%s"}]}]}`,
+				server.URL, hex.EncodeToString(hash[:]))
+		case "/daydash_1.0.2_all.deb":
+			fmt.Fprint(rw, packageContents)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return server
+}
+
+func TestSource_ForPackage_UnknownURL_ReturnsError(t *testing.T) {
+
+	//	Arrange
+	pkg := config.Package{Name: "daydash", Source: config.Source{URL: "https://example.com/not/a/known/source"}}
+
+	//	Act
+	_, err := source.ForPackage(pkg)
+
+	//	Assert
+	if !errors.Is(err, source.ErrUnknownSourceType) {
+		t.Errorf("ForPackage failed: Expected ErrUnknownSourceType but got: %v", err)
+	}
+}
+
+func TestSource_Failover_FirstSourceDown_UsesNextSource(t *testing.T) {
+
+	//	Arrange
+	downServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer downServer.Close()
+
+	mirrorServer := newManifestServer("package contents")
+	defer mirrorServer.Close()
+
+	pkg := config.Package{
+		Name: "daydash",
+		Sources: []config.Source{
+			{URL: downServer.URL + "/manifest.json"},
+			{URL: mirrorServer.URL + "/manifest.json"},
+		},
+	}
+
+	releaseSource, err := source.ForPackage(pkg)
+	if err != nil {
+		t.Fatalf("ForPackage - Should create the source without error, but got: %s", err)
+	}
+
+	//	Act
+	releases, err := releaseSource.ListReleases()
+
+	//	Assert
+	if err != nil || len(releases) != 1 {
+		t.Fatalf("ListReleases failed: Expected one release from the mirror, but got %+v (%v)", releases, err)
+	}
+
+	if releaseSource.Name() != mirrorServer.URL+"/manifest.json" {
+		t.Errorf("Name failed: Expected the mirror to have answered, but got %s", releaseSource.Name())
+	}
+
+	release, err := releaseSource.ResolveVersion("1.0.2")
+	if err != nil {
+		t.Fatalf("ResolveVersion - Should find the version without error, but got: %s", err)
+	}
+
+	packageFile, err := source.DownloadAsset(releaseSource, release)
+	if err != nil {
+		t.Fatalf("DownloadAsset - Should download without error, but got: %s", err)
+	}
+	defer os.Remove(packageFile)
+
+	contents, _ := ioutil.ReadFile(packageFile)
+	if string(contents) != "package contents" {
+		t.Errorf("DownloadAsset failed: Unexpected file contents: %s", contents)
+	}
+}
+
+func TestSource_Failover_BadChecksum_UsesNextSource(t *testing.T) {
+
+	//	Arrange
+	//	The first server lists a checksum that doesn't match the file it serves
+	badServer := newManifestServer("package contents")
+	defer badServer.Close()
+	badServer.Config.Handler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/manifest.json":
+			fmt.Fprintf(rw, `{"releases": [{"version": "v1.0.2", "assets": [{"arch": "all", "url": "%s/daydash_1.0.2_all.deb", "sha256": "0000"}]}]}`, badServer.URL)
+		default:
+			fmt.Fprint(rw, "corrupted contents")
+		}
+	})
+
+	goodServer := newManifestServer("package contents")
+	defer goodServer.Close()
+
+	pkg := config.Package{
+		Name: "daydash",
+		Sources: []config.Source{
+			{URL: badServer.URL + "/manifest.json"},
+			{URL: goodServer.URL + "/manifest.json"},
+		},
+	}
+
+	releaseSource, _ := source.ForPackage(pkg)
+
+	//	Act
+	release, err := releaseSource.ResolveVersion("v1.0.2")
+	if err != nil {
+		t.Fatalf("ResolveVersion - Should find the version without error, but got: %s", err)
+	}
+
+	packageFile, err := source.DownloadAsset(releaseSource, release)
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("DownloadAsset - Should fail over to the good source, but got: %s", err)
+	}
+	defer os.Remove(packageFile)
+
+	if releaseSource.Name() != goodServer.URL+"/manifest.json" {
+		t.Errorf("Name failed: Expected the good source to have answered, but got %s", releaseSource.Name())
+	}
+}
+
+func TestSource_ResolveVersion_Missing_ReturnsNotFound(t *testing.T) {
+
+	//	Arrange
+	server := newManifestServer("package contents")
+	defer server.Close()
+
+	releaseSource, _ := source.ForPackage(config.Package{Name: "daydash", Source: config.Source{URL: server.URL + "/manifest.json"}})
+
+	//	Act
+	_, err := releaseSource.ResolveVersion("v9.9.9")
+
+	//	Assert
+	if err != source.ErrVersionNotFound {
+		t.Errorf("ResolveVersion failed: Expected ErrVersionNotFound but got: %v", err)
+	}
+}
+
+func TestSource_ForPackage_TarballAssetPattern_ListsMatchingArchive(t *testing.T) {
+
+	//	Arrange
+	//	A tarball that doesn't say what it was built for can still be picked with the package's asset pattern
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(rw, `[{"tag_name": "v1.0.2", "assets": [
+			{"name": "goservice-1.0.2.tar.gz", "browser_download_url": "http://example.com/goservice-1.0.2.tar.gz"},
+			{"name": "goservice_1.0.2_all.deb", "browser_download_url": "http://example.com/goservice_1.0.2_all.deb"}
+		]}]`)
+	}))
+	defer server.Close()
+
+	pkg := config.Package{
+		Name:           "goservice",
+		Source:         config.Source{URL: server.URL + "/devices/goservice", Type: "gitea", BaseURL: server.URL},
+		PackageManager: "tarball",
+		Asset:          "goservice-*.tar.gz",
+	}
+
+	releaseSource, err := source.ForPackage(pkg)
+	if err != nil {
+		t.Fatalf("ForPackage - Should create the source without error, but got: %s", err)
+	}
+
+	//	Act
+	releases, err := releaseSource.ListReleases()
+
+	//	Assert
+	if err != nil || len(releases) != 1 {
+		t.Fatalf("ListReleases failed: Expected only the tarball matching the asset pattern, but got %+v (%v)", releases, err)
+	}
+
+	if releases[0].DownloadUrl != "http://example.com/goservice-1.0.2.tar.gz" {
+		t.Errorf("ListReleases failed: Unexpected release: %+v", releases[0])
+	}
+}
+
+// aliasSource is a release source that resolves the 'stable' alias itself (it isn't a version in the list).
+// Its own ResolveVersion always picks the first release listed for a version
+type aliasSource struct {
+	releases []github.Release
+}
+
+func (a aliasSource) Name() string {
+	return "alias"
+}
+
+func (a aliasSource) ListReleases() ([]github.Release, error) {
+	return a.releases, nil
+}
+
+func (a aliasSource) ResolveVersion(requestedVersion string) (github.Release, error) {
+	if requestedVersion == "stable" {
+		requestedVersion = "v1.0.1"
+	}
+
+	for _, release := range a.releases {
+		if release.Version == requestedVersion {
+			return release, nil
+		}
+	}
+
+	return github.Release{}, source.ErrVersionNotFound
+}
+
+func (a aliasSource) OpenAsset(release github.Release) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("package contents")), nil
+}
+
+func TestSource_ResolveVersion_UsesSourceResolverUnlessItPicksAnotherPlatform(t *testing.T) {
+
+	//	Arrange
+	releases := []github.Release{
+		{Version: "v1.0.2", Name: "daydash_1.0.2_s390x.deb"},
+		{Version: "v1.0.2", Name: "daydash_1.0.2_all.deb"},
+		{Version: "v1.0.1", Name: "daydash_1.0.1_all.deb"},
+	}
+	source.Register("alias", func(pkg config.Package, src config.Source) (source.ReleaseSource, error) {
+		return aliasSource{releases: releases}, nil
+	})
+
+	releaseSource, err := source.ForPackage(config.Package{Name: "daydash", Source: config.Source{URL: "alias://daydash", Type: "alias"}, PackageManager: "dpkg"})
+	if err != nil {
+		t.Fatalf("ForPackage - Should create the source without error, but got: %s", err)
+	}
+
+	//	Act
+	stable, stableErr := releaseSource.ResolveVersion("stable")
+	otherPlatform, otherPlatformErr := releaseSource.ResolveVersion("v1.0.2")
+	_, missingErr := releaseSource.ResolveVersion("v9.9.9")
+
+	//	Assert
+	if stableErr != nil || stable.Name != "daydash_1.0.1_all.deb" {
+		t.Errorf("ResolveVersion failed: Expected the source to resolve its own alias, but got %+v (%v)", stable, stableErr)
+	}
+
+	if otherPlatformErr != nil || otherPlatform.Name != "daydash_1.0.2_all.deb" {
+		t.Errorf("ResolveVersion failed: Expected the installable release when the source picks another platform, but got %+v (%v)", otherPlatform, otherPlatformErr)
+	}
+
+	if missingErr != source.ErrVersionNotFound {
+		t.Errorf("ResolveVersion failed: Expected ErrVersionNotFound but got: %v", missingErr)
+	}
+}
+
+// recordingTransport answers every request with an empty list of releases, and records where it was sent
+type recordingTransport struct {
+	requests []*http.Request
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.requests = append(r.requests, req)
+
+	recorder := httptest.NewRecorder()
+	fmt.Fprint(recorder, "[]")
+	return recorder.Result(), nil
+}
+
+func TestSource_ForPackage_GitHubEnterpriseAndGitHubCom_UseTheirOwnServer(t *testing.T) {
+
+	//	Arrange
+	viper.Set("github.api-url", "https://ghe.example.com/api/v3")
+	viper.Set("github.token", "enterprisetoken")
+	defer viper.Set("github.api-url", "")
+	defer viper.Set("github.token", "")
+
+	transport := &recordingTransport{}
+	oldTransport := http.DefaultTransport
+	http.DefaultTransport = transport
+	defer func() { http.DefaultTransport = oldTransport }()
+
+	enterprise, err := source.ForPackage(config.Package{Name: "daydash", Source: config.Source{URL: "https://ghe.example.com/devices/daydash"}})
+	if err != nil {
+		t.Fatalf("ForPackage - Should create the enterprise source without error, but got: %s", err)
+	}
+
+	public, err := source.ForPackage(config.Package{Name: "daydash", Source: config.Source{URL: "https://github.com/danesparza/daydash"}})
+	if err != nil {
+		t.Fatalf("ForPackage - Should create the github.com source without error, but got: %s", err)
+	}
+
+	//	Act
+	enterprise.ListReleases()
+	public.ListReleases()
+
+	//	Assert
+	if len(transport.requests) != 2 {
+		t.Fatalf("ListReleases - Expected a request for each source, but got %d", len(transport.requests))
+	}
+
+	if req := transport.requests[0]; req.URL.Host != "ghe.example.com" || req.Header.Get("Authorization") != "token enterprisetoken" {
+		t.Errorf("ListReleases - Expected the enterprise repo to use the enterprise server and token, but got %s (%q)", req.URL, req.Header.Get("Authorization"))
+	}
+
+	if req := transport.requests[1]; req.URL.Host != "api.github.com" || req.Header.Get("Authorization") != "" {
+		t.Errorf("ListReleases - Expected the github.com repo to use github.com without the enterprise token, but got %s (%q)", req.URL, req.Header.Get("Authorization"))
+	}
+}
+
+func TestSource_ForPackage_SelfHostedGitLabWithType_ListsReleases(t *testing.T) {
+
+	//	Arrange
+	//	The test server's host isn't named gitlab.*, so the source type has to be set
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.EscapedPath() != "/api/v4/projects/devices%2Fdaydash/releases" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprintf(rw, `[{"tag_name": "v1.0.2", "assets": {"links": [{"name": "daydash_1.0.2_all.deb", "url": "%s/daydash_1.0.2_all.deb"}]}}]`, server.URL)
+	}))
+	defer server.Close()
+
+	untyped := config.Package{Name: "daydash", Source: config.Source{URL: server.URL + "/devices/daydash"}, PackageManager: "dpkg"}
+	typed := config.Package{Name: "daydash", Source: config.Source{URL: server.URL + "/devices/daydash", Type: "gitlab"}, PackageManager: "dpkg"}
+
+	//	Act
+	_, untypedErr := source.ForPackage(untyped)
+	releaseSource, err := source.ForPackage(typed)
+	if err != nil {
+		t.Fatalf("ForPackage - Should create the gitlab source without error, but got: %s", err)
+	}
+	releases, err := releaseSource.ListReleases()
+
+	//	Assert
+	if !errors.Is(untypedErr, source.ErrUnknownSourceType) {
+		t.Errorf("ForPackage failed: Expected ErrUnknownSourceType without a type, but got: %v", untypedErr)
+	}
+
+	if err != nil || len(releases) != 1 || releases[0].Version != "v1.0.2" {
+		t.Errorf("ListReleases failed: Expected the release from the gitlab api, but got %+v (%v)", releases, err)
+	}
+}
@@ -0,0 +1,188 @@
+package system
+
+import (
+	"os/exec"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var (
+	architecture     string
+	architectureOnce sync.Once
+)
+
+// goArchToDebian maps go architecture names to debian architecture names
+var goArchToDebian = map[string]string{
+	"386":     "i386",
+	"amd64":   "amd64",
+	"arm":     "armhf",
+	"arm64":   "arm64",
+	"ppc64le": "ppc64el",
+	"riscv64": "riscv64",
+	"s390x":   "s390x",
+}
+
+// GetArchitecture gets the debian architecture name of this machine (armhf, arm64, amd64, etc)
+func GetArchitecture() string {
+	architectureOnce.Do(func() {
+		//	Ask dpkg first -- it knows best
+		output, err := exec.Command("dpkg", "--print-architecture").Output()
+		if err == nil && strings.TrimSpace(string(output)) != "" {
+			architecture = strings.TrimSpace(string(output))
+			return
+		}
+
+		//	Otherwise, fall back to what we were compiled for
+		if debArch, ok := goArchToDebian[runtime.GOARCH]; ok {
+			architecture = debArch
+			return
+		}
+
+		architecture = runtime.GOARCH
+	})
+
+	return architecture
+}
+
+// ArchitectureMatches returns true if a package built for the given architecture can be installed
+// on this machine.  Both debian and rpm architecture names are recognized
+func ArchitectureMatches(arch string) bool {
+	arch = strings.TrimSpace(arch)
+	return arch == "" || arch == "all" || arch == "noarch" || arch == GetArchitecture() || arch == GetRPMArchitecture()
+}
+
+var (
+	rpmArchitecture     string
+	rpmArchitectureOnce sync.Once
+)
+
+// debianToRPM maps debian architecture names to rpm architecture names
+var debianToRPM = map[string]string{
+	"i386":    "i686",
+	"amd64":   "x86_64",
+	"armhf":   "armv7hl",
+	"arm64":   "aarch64",
+	"ppc64el": "ppc64le",
+	"riscv64": "riscv64",
+	"s390x":   "s390x",
+}
+
+// GetRPMArchitecture gets the rpm architecture name of this machine (x86_64, aarch64, armv7hl, etc)
+func GetRPMArchitecture() string {
+	rpmArchitectureOnce.Do(func() {
+		//	Ask rpm first (if this is an rpm based system)
+		output, err := exec.Command("rpm", "--eval", "%{_arch}").Output()
+		if err == nil && strings.TrimSpace(string(output)) != "" && !strings.HasPrefix(string(output), "%") {
+			rpmArchitecture = strings.TrimSpace(string(output))
+			return
+		}
+
+		if rpmArch, ok := debianToRPM[GetArchitecture()]; ok {
+			rpmArchitecture = rpmArch
+			return
+		}
+
+		rpmArchitecture = GetArchitecture()
+	})
+
+	return rpmArchitecture
+}
+
+// packageFileArchRegexes get the architecture from debian (name_version_arch.deb)
+// and rpm (name-version-release.arch.rpm) package file names
+var packageFileArchRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`_([a-z][a-z0-9-]*)\.deb$`),
+	regexp.MustCompile(`\.([a-z][a-z0-9_]*)\.rpm$`),
+}
+
+// IsPackageFile returns true if the file name is an installable release asset: a .deb or .rpm package, a tarball
+// or a linux binary (see IsBinary).  Which of them a package can use is up to its package manager
+func IsPackageFile(fileName string) bool {
+	return strings.HasSuffix(fileName, ".deb") || strings.HasSuffix(fileName, ".rpm") || IsArchive(fileName) || IsBinary(fileName)
+}
+
+// IsArchive returns true if the file name is a gzipped tarball
+func IsArchive(fileName string) bool {
+	return strings.HasSuffix(fileName, ".tar.gz") || strings.HasSuffix(fileName, ".tgz")
+}
+
+// nonBinaryExtensions are the extensions of release assets that sit next to binaries (but aren't binaries)
+var nonBinaryExtensions = map[string]bool{
+	".asc": true, ".sig": true, ".pem": true, ".txt": true, ".md": true, ".json": true, ".yaml": true, ".yml": true,
+	".sha256": true, ".sha512": true, ".md5": true, ".sbom": true, ".zip": true, ".gz": true, ".xz": true, ".bz2": true,
+	".deb": true, ".rpm": true, ".tgz": true, ".apk": true, ".exe": true, ".msi": true, ".dmg": true,
+}
+
+// IsBinary returns true if the file name looks like a single linux binary (myapp_linux_arm64, for example)
+func IsBinary(fileName string) bool {
+	if !strings.Contains(strings.ToLower(fileName), "linux") {
+		return false
+	}
+
+	return !nonBinaryExtensions[strings.ToLower(path.Ext(fileName))]
+}
+
+// nameArchRegex finds the architecture names commonly used in release asset names
+var nameArchRegex = regexp.MustCompile(`(?:^|[^a-z0-9])(amd64|x86_64|x86-64|arm64|aarch64|armhf|armv7l?|armv6l?|arm|i386|i686|386|ppc64le|ppc64el|riscv64|s390x)(?:[^a-z0-9]|$)`)
+
+// nameArchAliases are the names each debian architecture goes by in release asset names
+var nameArchAliases = map[string][]string{
+	"amd64":   {"amd64", "x86_64", "x86-64"},
+	"arm64":   {"arm64", "aarch64"},
+	"armhf":   {"armhf", "armv7", "armv7l", "arm"},
+	"i386":    {"i386", "i686", "386"},
+	"ppc64el": {"ppc64el", "ppc64le"},
+	"riscv64": {"riscv64"},
+	"s390x":   {"s390x"},
+}
+
+// NameArchitectureMatches returns true if a release asset (like a tarball or binary) can run on
+// this machine, going by the architecture in its name.  Names without an architecture match
+func NameArchitectureMatches(fileName string) bool {
+	matches := nameArchRegex.FindAllStringSubmatch(strings.ToLower(fileName), -1)
+	if len(matches) == 0 {
+		return true
+	}
+
+	for _, match := range matches {
+		for _, alias := range nameArchAliases[GetArchitecture()] {
+			if match[1] == alias {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// nameOSRegex finds the names of operating systems other than linux commonly used in release asset names
+var nameOSRegex = regexp.MustCompile(`(?:^|[^a-z0-9])(darwin|macos|osx|apple|windows|win32|win64|freebsd|openbsd|netbsd|dragonfly|solaris|illumos|aix|android|ios|plan9)(?:[^a-z0-9]|$)`)
+
+// sourceNameRegex finds the words that mark a release asset as the source code (myapp-1.0-src.tar.gz, for example)
+var sourceNameRegex = regexp.MustCompile(`(?:^|[^a-z0-9])(src|source|sources)(?:[^a-z0-9]|$)`)
+
+// NameOSMatches returns true if a release asset (like a tarball or binary) is built for linux, going by its name.
+// Names that don't mention an operating system match
+func NameOSMatches(fileName string) bool {
+	return !nameOSRegex.MatchString(strings.ToLower(fileName))
+}
+
+// IsSourceArchive returns true if the release asset's name says it's the source code, not a build
+func IsSourceArchive(fileName string) bool {
+	return sourceNameRegex.MatchString(strings.ToLower(fileName))
+}
+
+// GetPackageFileArchitecture gets the architecture from a package file name, or
+// an empty string if the name doesn't follow debian or rpm naming
+func GetPackageFileArchitecture(fileName string) string {
+	for _, archRegex := range packageFileArchRegexes {
+		if matches := archRegex.FindStringSubmatch(fileName); matches != nil {
+			return matches[1]
+		}
+	}
+
+	return ""
+}
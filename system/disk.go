@@ -0,0 +1,26 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// GetFreeSpace gets the space available (to unprivileged users) on the filesystem the path is on, in bytes.
+// If the path doesn't exist yet, its closest existing parent directory is used
+func GetFreeSpace(path string) (uint64, error) {
+	path = filepath.Clean(path)
+	for {
+		if _, err := os.Stat(path); err == nil || filepath.Dir(path) == path {
+			break
+		}
+		path = filepath.Dir(path)
+	}
+
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+
+	return stat.Bavail * uint64(stat.Bsize), nil
+}